@@ -338,7 +338,10 @@ func commitCheckHandler(t *BuildTest, command *BuildCommand) error {
 // key file, which we need because each user generates a deployment key for test161.
 func (t *BuildTest) setCommandEnv() {
 	t.cmdEnv = os.Environ()
-	if cmd := GetDeployKeySSHCmd(t.conf.Users, t.env.KeyDir); cmd != "" {
+	if len(t.conf.Users) == 0 {
+		// Local builds don't need a key
+		return
+	} else if cmd := GetDeployKeySSHCmd(t.conf.Users, t.env.KeyDir); cmd != "" {
 		t.cmdEnv = append(t.cmdEnv, cmd)
 	} else {
 		t.env.Log.Println("Missing deployment key for", t.conf.Users)
@@ -590,26 +593,96 @@ func (t *BuildTest) addOverlayCommand() {
 
 // Add the chunk of commands needed to build OS/161
 func (t *BuildTest) addBuildCommands() error {
-	confDir := path.Join(t.srcDir, "kern/conf")
-	compDir := path.Join(path.Join(t.srcDir, "kern/compile"), t.conf.KConfig)
-
-	os.RemoveAll(compDir)
+	os.RemoveAll(t.kernelCompileDir())
 
 	t.addCommand("./configure --ostree="+t.rootDir, t.srcDir)
 
 	if t.conf.RequiresUserland {
+		t.addUserlandCommands(true)
+	}
+
+	t.addKernelCommands(true, true)
+
+	return nil
+}
+
+func (t *BuildTest) kernelCompileDir() string {
+	return path.Join(path.Join(t.srcDir, "kern/compile"), t.conf.KConfig)
+}
+
+// Add the commands to build and install userland, optionally cleaning first.
+func (t *BuildTest) addUserlandCommands(clean bool) {
+	if clean {
 		t.addCommand("bmake clean", t.srcDir)
-		t.addCommand("bmake", t.srcDir)
-		t.addCommand("bmake install", t.srcDir)
 	}
+	t.addCommand("bmake", t.srcDir)
+	t.addCommand("bmake install", t.srcDir)
+}
+
+// Add the commands to build and install the kernel. configure runs config and
+// depend first, which is needed if the compile directory doesn't exist yet or
+// the kernel configuration changed.
+func (t *BuildTest) addKernelCommands(configure, clean bool) {
+	compDir := t.kernelCompileDir()
 
-	t.addCommand("./config "+t.conf.KConfig, confDir)
-	t.addCommand("bmake clean", compDir)
-	t.addCommand("bmake depend", compDir)
+	if configure {
+		t.addCommand("./config "+t.conf.KConfig, path.Join(t.srcDir, "kern/conf"))
+	}
+	if clean {
+		t.addCommand("bmake clean", compDir)
+	}
+	if configure {
+		t.addCommand("bmake depend", compDir)
+	}
 	t.addCommand("bmake", compDir)
 	t.addCommand("bmake install", compDir)
+}
 
-	return nil
+// LocalBuildSteps selects the parts of a local OS/161 source tree to rebuild.
+type LocalBuildSteps struct {
+	Userland        bool // Rebuild and install userland
+	Kernel          bool // Rebuild and install the kernel
+	KernelConfigure bool // Re-run config and depend for the kernel first
+}
+
+// ToLocalBuildTest creates a BuildTest that rebuilds an existing, configured
+// OS/161 source tree in place, e.g. a student's working copy. Unlike
+// ToBuildTest, nothing is cloned or cleaned, so bmake only rebuilds what
+// changed. Only KConfig is used from the BuildConf.
+func (b *BuildConf) ToLocalBuildTest(env *TestEnvironment, srcDir, rootDir string,
+	steps LocalBuildSteps) *BuildTest {
+
+	t := &BuildTest{
+		ID:              uuid.NewV4().String(),
+		Name:            "build",
+		Description:     "Rebuild local sources",
+		Commands:        make([]*BuildCommand, 0),
+		Result:          TEST_RESULT_NONE,
+		DependencyID:    "build",
+		IsDependency:    true,
+		PointsAvailable: uint(0),
+		PointsEarned:    uint(0),
+		ScoringMethod:   TEST_SCORING_ENTIRE,
+		dir:             srcDir,
+		srcDir:          srcDir,
+		rootDir:         rootDir,
+		conf:            b,
+		env:             env,
+	}
+
+	if steps.Userland {
+		t.addUserlandCommands(false)
+	}
+
+	// The compile directory won't exist if the kernel was never configured
+	if _, err := os.Stat(t.kernelCompileDir()); err != nil {
+		steps.KernelConfigure = true
+	}
+	if steps.Kernel || steps.KernelConfigure {
+		t.addKernelCommands(steps.KernelConfigure, false)
+	}
+
+	return t
 }
 
 // Add an individual build command by specifying the command line and
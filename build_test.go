@@ -2,6 +2,8 @@ package test161
 
 import (
 	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
 	"testing"
 )
 
@@ -96,3 +98,37 @@ func TestHexString(t *testing.T) {
 		assert.Equal(test.expected, isHexString(test.input))
 	}
 }
+
+func TestLocalBuildCommands(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	src := t.TempDir()
+	conf := &BuildConf{KConfig: "ASST1"}
+	env := defaultEnv.CopyEnvironment()
+
+	lines := func(test *BuildTest) []string {
+		res := make([]string, 0)
+		for _, c := range test.Commands {
+			res = append(res, c.Input.Line)
+		}
+		return res
+	}
+
+	// The kernel hasn't been configured yet
+	test := conf.ToLocalBuildTest(env, src, "/root", LocalBuildSteps{Kernel: true})
+	assert.Equal([]string{"./config ASST1", "bmake depend", "bmake", "bmake install"}, lines(test))
+
+	assert.Nil(os.MkdirAll(path.Join(src, "kern/compile/ASST1"), 0770))
+
+	test = conf.ToLocalBuildTest(env, src, "/root", LocalBuildSteps{Kernel: true})
+	assert.Equal([]string{"bmake", "bmake install"}, lines(test))
+	assert.Equal(path.Join(src, "kern/compile/ASST1"), test.Commands[0].startDir)
+
+	test = conf.ToLocalBuildTest(env, src, "/root", LocalBuildSteps{Userland: true, Kernel: true})
+	assert.Equal([]string{"bmake", "bmake install", "bmake", "bmake install"}, lines(test))
+	assert.Equal(src, test.Commands[0].startDir)
+
+	test = conf.ToLocalBuildTest(env, src, "/root", LocalBuildSteps{Userland: true})
+	assert.Equal([]string{"bmake", "bmake install"}, lines(test))
+}
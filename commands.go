@@ -274,7 +274,12 @@ func (c *Command) Instantiate(env *TestEnvironment) error {
 			}
 		}
 	} else if len(args) > 0 {
-		// Expand the provided arguments as well
+		// Expand the provided arguments as well. Matrix parameters, if any,
+		// are available to the argument templates.
+		var argData interface{} = "No data"
+		if c.Test != nil && len(c.Test.Params) > 0 {
+			argData = c.Test.Params
+		}
 		argLine := ""
 		for i, arg := range args {
 			if i > 0 {
@@ -282,7 +287,7 @@ func (c *Command) Instantiate(env *TestEnvironment) error {
 			}
 			argLine += arg
 		}
-		if temp, err := expandLine(argLine, "No data"); err != nil {
+		if temp, err := expandLine(argLine, argData); err != nil {
 			return err
 		} else {
 			// Break
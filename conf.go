@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,6 +17,7 @@ import (
 	"dario.cat/mergo"
 	"github.com/ericaro/frontmatter"
 	uuid "github.com/kevinburke/go.uuid"
+	yaml "gopkg.in/yaml.v2"
 )
 
 // Many of the values below that come in from YAML are string types. This
@@ -68,6 +70,7 @@ type MiscConf struct {
 	TempDir          string  `yaml:"tempdir" json:"-" bson:"-"`
 	RetryCharacters  string  `yaml:"retrycharacters" json:"retrycharacters"`
 	KillOnExit       string  `yaml:"killonexit" json:"killonexit"`
+	Weight           float64 `yaml:"weight" json:"weight"`
 }
 
 type CommandConf struct {
@@ -161,18 +164,186 @@ func TestFromString(data string) (*Test, error) {
 		return nil, err
 	}
 
-	// Check for empty commands and expand syntatic sugar before getting
-	// started. Doing this first makes the main loop and retry logic simpler.
+	if err = t.init(); err != nil {
+		return nil, err
+	}
 
-	t.ID = uuid.NewV4().String()
-	err = t.initCommands()
+	return t, nil
+}
+
+// TestsFromFile parses the test file and expands its parameter matrix, if it
+// declares one, into one Test per combination of parameters. Base tests named
+// by extends are resolved relative to the file; tests that extend fragments or
+// tests relative to the test directory need to be loaded from a TestGroup.
+func TestsFromFile(filename string) ([]*Test, error) {
+	loader := &testLoader{}
+	return loader.testsFromFile(filename)
+}
+
+// TestsFromString parses the test string and expands its parameter matrix.
+// Tests without a matrix produce a single Test, exactly like TestFromString.
+func TestsFromString(data string) ([]*Test, error) {
+	return testsFromConf(func() (*Test, error) {
+		return confFromString(data)
+	})
+}
+
+// Create the tests for a single test file. parse is called once per test
+// instance and returns its (possibly inherited) configuration.
+func testsFromConf(parse func() (*Test, error)) ([]*Test, error) {
+
+	t, err := parse()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(t.Matrix) == 0 {
+		if err = t.init(); err != nil {
+			return nil, err
+		}
+		return []*Test{t}, nil
+	}
+
+	combos, err := matrixCombinations(t.Matrix)
 	if err != nil {
 		return nil, err
 	}
 
+	// Each instance is parsed separately so that it gets its own commands,
+	// random seed and configuration.
+	tests := make([]*Test, 0, len(combos))
+	for _, params := range combos {
+		instance, err := parse()
+		if err != nil {
+			return nil, err
+		}
+		if err = instance.applyParams(params); err != nil {
+			return nil, err
+		}
+		if err = instance.init(); err != nil {
+			return nil, err
+		}
+		tests = append(tests, instance)
+	}
+
+	return tests, nil
+}
+
+// Check for empty commands and expand syntatic sugar before getting
+// started. Doing this first makes the main loop and retry logic simpler.
+func (t *Test) init() error {
+	t.ID = uuid.NewV4().String()
+	if err := t.initCommands(); err != nil {
+		return err
+	}
+
 	t.Result = TEST_RESULT_NONE
 
-	return t, nil
+	return nil
+}
+
+// Expand a parameter matrix into every combination of its values. Keys are
+// sorted so that the combinations, and therefore the derived test IDs, are
+// stable.
+func matrixCombinations(matrix map[string][]interface{}) ([]map[string]interface{}, error) {
+	keys := make([]string, 0, len(matrix))
+	for key, values := range matrix {
+		if strings.TrimSpace(key) == "" {
+			return nil, errors.New("test161: empty matrix parameter name")
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("test161: matrix parameter '%v' has no values", key)
+		}
+		for _, v := range values {
+			switch v.(type) {
+			case string, int, int64, uint64, float64, bool:
+			default:
+				return nil, fmt.Errorf("test161: matrix parameter '%v' has a non-scalar value: %v", key, v)
+			}
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	combos := []map[string]interface{}{map[string]interface{}{}}
+	for _, key := range keys {
+		next := make([]map[string]interface{}, 0, len(combos)*len(matrix[key]))
+		for _, combo := range combos {
+			for _, v := range matrix[key] {
+				params := make(map[string]interface{}, len(combo)+1)
+				for k, prev := range combo {
+					params[k] = prev
+				}
+				params[key] = v
+				next = append(next, params)
+			}
+		}
+		combos = next
+	}
+
+	return combos, nil
+}
+
+// Apply a single combination of matrix parameters to the test. Parameters
+// whose name is a front matter path (e.g. sys161.cpus) override that setting.
+// All parameters are available to command arguments as template data.
+func (t *Test) applyParams(params map[string]interface{}) error {
+	t.Params = make(map[string]string, len(params))
+
+	for key, value := range params {
+		t.Params[key] = fmt.Sprint(value)
+
+		// Build the nested YAML document for the dotted path and decode it on
+		// top of the existing configuration.
+		var override interface{} = value
+		parts := strings.Split(key, ".")
+		for i := len(parts) - 1; i >= 0; i-- {
+			override = map[string]interface{}{parts[i]: override}
+		}
+		text, err := yaml.Marshal(override)
+		if err != nil {
+			return err
+		}
+		if err = yaml.Unmarshal(text, t); err != nil {
+			return fmt.Errorf("test161: cannot apply matrix parameter '%v': %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+// ParamLabel returns the suffix that distinguishes this matrix instance from
+// its siblings, e.g. "[cpus=1,ram=2M]", or "" if the test has no matrix.
+func (t *Test) ParamLabel() string {
+	if len(t.Params) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(t.Params))
+	for key := range t.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+t.Params[key])
+	}
+	return "[" + strings.Join(pairs, ",") + "]"
+}
+
+// Check whether the test's matrix parameters include every key=value pair in
+// the selector (the text between the brackets of a derived test ID).
+func (t *Test) matchesParams(selector string) (bool, error) {
+	for _, pair := range strings.Split(selector, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return false, fmt.Errorf("Invalid matrix selector: [%v]", selector)
+		}
+		if value, ok := t.Params[strings.TrimSpace(kv[0])]; !ok || value != strings.TrimSpace(kv[1]) {
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
 func (t *Test) MergeConf(defaults Test) error {
@@ -1,9 +1,11 @@
 package test161
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -607,3 +609,61 @@ func TestConfFromFile(t *testing.T) {
 	assert.NotNil(err)
 	assert.Nil(test)
 }
+
+func TestConfMatrix(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	tests, err := TestsFromString(`---
+name: matrix
+matrix:
+  sys161.cpus: [1, 4]
+  sys161.ram: [1M, 2M]
+  count: [5]
+---
+lt1
+$ /testbin/add {{.count}} 1
+`)
+	assert.Nil(err)
+	assert.Equal(4, len(tests))
+
+	labels := make([]string, 0)
+	for _, test := range tests {
+		labels = append(labels, test.ParamLabel())
+		assert.Equal(test.Params["sys161.cpus"], fmt.Sprint(test.Sys161.CPUs))
+		assert.Equal(test.Params["sys161.ram"], test.Sys161.RAM)
+		assert.Equal("matrix", test.Name)
+		// boot, lt1, s, add, exit, q
+		assert.Equal(6, len(test.Commands))
+	}
+	sort.Strings(labels)
+	assert.Equal([]string{
+		"[count=5,sys161.cpus=1,sys161.ram=1M]",
+		"[count=5,sys161.cpus=1,sys161.ram=2M]",
+		"[count=5,sys161.cpus=4,sys161.ram=1M]",
+		"[count=5,sys161.cpus=4,sys161.ram=2M]",
+	}, labels)
+
+	// Each instance gets its own commands
+	assert.False(tests[0].Commands[1] == tests[1].Commands[1])
+
+	// Matrix parameters are available to command arguments
+	assert.Nil(tests[0].Commands[3].Instantiate(defaultEnv))
+	assert.Equal("/testbin/add 5 1", tests[0].Commands[3].Input.Line)
+
+	// No matrix
+	tests, err = TestsFromString("q")
+	assert.Nil(err)
+	assert.Equal(1, len(tests))
+	if len(tests) == 1 {
+		assert.Equal("", tests[0].ParamLabel())
+	}
+
+	// Bad matrices
+	_, err = TestsFromString("---\nmatrix:\n  sys161.cpus: []\n---\nq\n")
+	assert.NotNil(err)
+	_, err = TestsFromString("---\nmatrix:\n  sys161.cpus: [eight]\n---\nq\n")
+	assert.NotNil(err)
+	_, err = TestsFromString("---\nmatrix:\n  sys161.cpus: [[1, 2]]\n---\nq\n")
+	assert.NotNil(err)
+}
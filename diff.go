@@ -0,0 +1,260 @@
+package test161
+
+import (
+	"fmt"
+	"strings"
+)
+
+// When a command is incorrect, we record why: the reason it failed, how each
+// of the expected output lines was matched, and a diff-style explanation that
+// shows the expected lines that are missing among the command's output.
+
+// The number of output lines shown around missing and unverified lines in a
+// command's Diff
+const DIFF_CONTEXT = 3
+
+// Why a secure output line failed verification
+const (
+	VERIFY_REUSED_SALT = "reused salt"
+	VERIFY_BAD_HMAC    = "bad HMAC"
+	VERIFY_UNKNOWN_KEY = "unknown key"
+)
+
+// OutputMatch records how an expected output line was matched when a command
+// was evaluated.
+type OutputMatch struct {
+	Text    string `json:"text" bson:"text"`
+	Trusted bool   `json:"trusted" bson:"trusted"`
+	KeyName string `json:"keyname,omitempty" bson:"keyname,omitempty"`
+
+	// The index of the output line that matched, or -1 if the line is missing
+	Line int `json:"line" bson:"line"`
+
+	// Why a missing line didn't match
+	Reason string `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// Whether an output line satisfies an expected line. Trusted lines need to be
+// signed with the expected key, but only if we have that key, which we don't
+// on the client side.
+func outputLineMatches(expected *ExpectedOutputLine, actual *OutputLine, keyMap map[string]string) bool {
+	if actual.Line != expected.Text {
+		return false
+	}
+	_, hasKey := keyMap[expected.KeyName]
+	return !expected.Trusted || !hasKey || (actual.Trusted && actual.KeyName == expected.KeyName)
+}
+
+// Match the expected output lines in order, allowing extra output lines in
+// between. Returns the index of the output line that matched each expected
+// line, stopping at the first expected line that can't be found.
+func matchExpectedOutput(expected []*ExpectedOutputLine, output []*OutputLine, keyMap map[string]string) []int {
+	matched := make([]int, 0, len(expected))
+	actualIndex := 0
+	for actualIndex < len(output) && len(matched) < len(expected) {
+		if outputLineMatches(expected[len(matched)], output[actualIndex], keyMap) {
+			matched = append(matched, actualIndex)
+		}
+		actualIndex++
+	}
+	return matched
+}
+
+// The message of a secprintf line that failed verification, which is left
+// as is.
+func unverifiedMessage(line *OutputLine) (string, bool) {
+	if len(line.VerifyError) == 0 {
+		return "", false
+	}
+	if res := os161Secure.FindStringSubmatch(line.Line); len(res) == 5 {
+		return res[4], true
+	}
+	return "", false
+}
+
+// Figure out why an expected line is missing, looking at the output from start
+// on first, then before it.
+func missingReason(expected *ExpectedOutputLine, output []*OutputLine, start int, keyMap map[string]string) string {
+	describe := func(i int) string {
+		actual := output[i]
+		if outputLineMatches(expected, actual, keyMap) {
+			if i < start {
+				return fmt.Sprintf("found at output line %v, before the previous expected line", i+1)
+			}
+			return fmt.Sprintf("found at output line %v, but an earlier expected line is missing", i+1)
+		}
+		if actual.Line == expected.Text {
+			if actual.Trusted {
+				return fmt.Sprintf("output line %v matches, but is signed with key '%v' instead of '%v'",
+					i+1, actual.KeyName, expected.KeyName)
+			}
+			return fmt.Sprintf("output line %v matches, but isn't signed with key '%v'", i+1, expected.KeyName)
+		}
+		if msg, ok := unverifiedMessage(actual); ok && msg == expected.Text {
+			return fmt.Sprintf("output line %v matches, but failed verification (%v)", i+1, actual.VerifyError)
+		}
+		return ""
+	}
+
+	for i := start; i < len(output); i++ {
+		if reason := describe(i); len(reason) > 0 {
+			return reason
+		}
+	}
+	for i := 0; i < start && i < len(output); i++ {
+		if reason := describe(i); len(reason) > 0 {
+			return reason
+		}
+	}
+	return "not found in the output"
+}
+
+// Record how the expected output was matched.
+func (c *Command) matchOutput(keyMap map[string]string) {
+	matched := matchExpectedOutput(c.ExpectedOutput, c.Output, keyMap)
+
+	c.Matches = make([]*OutputMatch, 0, len(c.ExpectedOutput))
+	start := 0
+	for i, expected := range c.ExpectedOutput {
+		m := &OutputMatch{
+			Text:    expected.Text,
+			Trusted: expected.Trusted,
+			KeyName: expected.KeyName,
+			Line:    -1,
+		}
+		if i < len(matched) {
+			m.Line = matched[i]
+			start = matched[i] + 1
+		} else {
+			m.Reason = missingReason(expected, c.Output, start, keyMap)
+		}
+		c.Matches = append(c.Matches, m)
+	}
+}
+
+// Explain why an incorrect command failed. This is called at the end of
+// evaluate.
+func (c *Command) explainFailure(keyMap map[string]string, eof bool) {
+	c.FailReason, c.Matches, c.Diff = "", nil, ""
+	if c.Status != COMMAND_STATUS_INCORRECT {
+		return
+	}
+
+	switch {
+	case c.TimesOut == CMD_OPT_NO && c.TimedOut:
+		c.FailReason = "timed out"
+	case c.Panic == CMD_OPT_NO && eof && !(c.TimesOut != CMD_OPT_NO && c.TimedOut):
+		c.FailReason = "unexpected shutdown"
+	case c.Panic == CMD_OPT_YES && !eof:
+		c.FailReason = "expected a panic"
+	case c.TimesOut == CMD_OPT_YES && !c.TimedOut:
+		c.FailReason = "expected a timeout"
+	default:
+		c.FailReason = "missing expected output"
+	}
+
+	if len(c.ExpectedOutput) > 0 {
+		c.matchOutput(keyMap)
+	}
+	c.Diff = c.outputDiff()
+}
+
+type diffLine struct {
+	prefix string
+	text   string
+	note   string
+}
+
+// Render the output as a diff against the expected output:
+//
+//	'  ' output that isn't expected, which is allowed
+//	'= ' output that matched an expected line
+//	'- ' an expected line that's missing, with the reason
+//	'! ' a secure output line that failed verification
+//
+// Only the lines around missing and unverified lines are shown, or the end of
+// the output if there aren't any.
+func (c *Command) outputDiff() string {
+	matchedAt := make(map[int]bool)
+	insertAt := 0
+	missing := make([]*OutputMatch, 0)
+	for _, m := range c.Matches {
+		if m.Line >= 0 {
+			matchedAt[m.Line] = true
+			insertAt = m.Line + 1
+		} else {
+			missing = append(missing, m)
+		}
+	}
+
+	lines := make([]*diffLine, 0, len(c.Output)+len(missing))
+	interesting := make([]bool, 0, cap(lines))
+	addMissing := func() {
+		for _, m := range missing {
+			lines = append(lines, &diffLine{"- ", m.Text, m.Reason})
+			interesting = append(interesting, true)
+		}
+	}
+
+	for i, line := range c.Output {
+		if i == insertAt {
+			addMissing()
+		}
+		dl := &diffLine{"  ", line.Line, ""}
+		if matchedAt[i] {
+			dl.prefix = "= "
+		} else if len(line.VerifyError) > 0 {
+			dl.prefix = "! "
+			dl.note = "failed verification: " + line.VerifyError
+		}
+		lines = append(lines, dl)
+		interesting = append(interesting, dl.prefix == "! ")
+	}
+	if insertAt >= len(c.Output) {
+		addMissing()
+	}
+
+	// Show the end of the output if nothing else stands out
+	found := false
+	for _, ok := range interesting {
+		found = found || ok
+	}
+	if !found && len(lines) > 0 {
+		interesting[len(lines)-1] = true
+	}
+
+	show := make([]bool, len(lines))
+	for i, ok := range interesting {
+		if !ok {
+			continue
+		}
+		for j := i - DIFF_CONTEXT; j <= i+DIFF_CONTEXT; j++ {
+			if j >= 0 && j < len(lines) {
+				show[j] = true
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v: %v\n", c.Input.Line, c.FailReason)
+	elided := false
+	for i, dl := range lines {
+		if !show[i] {
+			elided = true
+			continue
+		}
+		if elided {
+			b.WriteString("  ...\n")
+			elided = false
+		}
+		b.WriteString(dl.prefix + dl.text)
+		if len(dl.note) > 0 {
+			b.WriteString("    (" + dl.note + ")")
+		}
+		b.WriteString("\n")
+	}
+	if elided {
+		b.WriteString("  ...\n")
+	}
+	return b.String()
+}
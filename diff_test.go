@@ -0,0 +1,160 @@
+package test161
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func diffCommand(output ...string) *Command {
+	c := &Command{
+		Input:    InputLine{Line: "sem1"},
+		Panic:    CMD_OPT_NO,
+		TimesOut: CMD_OPT_NO,
+		ExpectedOutput: []*ExpectedOutputLine{
+			{Text: "sem1: starting", Trusted: false},
+			{Text: "sem1: SUCCESS", Trusted: true, KeyName: "sem1"},
+		},
+	}
+	for _, line := range output {
+		c.Output = append(c.Output, &OutputLine{Line: line})
+	}
+	return c
+}
+
+func TestCommandDiffCorrect(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	c := diffCommand("sem1: starting", "sem1: SUCCESS")
+	c.evaluate(nil, false)
+	assert.Equal(COMMAND_STATUS_CORRECT, c.Status)
+	assert.Equal("", c.FailReason)
+	assert.Nil(c.Matches)
+	assert.Equal("", c.Diff)
+}
+
+func TestCommandDiffMissing(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	output := []string{"sem1: starting"}
+	for i := 0; i < 10; i++ {
+		output = append(output, fmt.Sprintf("line %v", i))
+	}
+	c := diffCommand(output...)
+	c.evaluate(nil, false)
+	assert.Equal(COMMAND_STATUS_INCORRECT, c.Status)
+	assert.Equal("missing expected output", c.FailReason)
+
+	if assert.Equal(2, len(c.Matches)) {
+		assert.Equal(0, c.Matches[0].Line)
+		assert.Equal(-1, c.Matches[1].Line)
+		assert.Equal("not found in the output", c.Matches[1].Reason)
+	}
+
+	expected := strings.Join([]string{
+		"sem1: missing expected output",
+		"= sem1: starting",
+		"- sem1: SUCCESS    (not found in the output)",
+		"  line 0",
+		"  line 1",
+		"  line 2",
+		"  ...",
+	}, "\n") + "\n"
+	assert.Equal(expected, c.Diff)
+}
+
+func TestCommandDiffUntrusted(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	keyMap := map[string]string{"sem1": "secret"}
+
+	// Signed with the wrong key
+	c := diffCommand("sem1: starting", "sem1: SUCCESS")
+	c.Output[1].Trusted = true
+	c.Output[1].KeyName = "lt1"
+	c.evaluate(keyMap, false)
+	assert.Equal(COMMAND_STATUS_INCORRECT, c.Status)
+	assert.Equal("output line 2 matches, but is signed with key 'lt1' instead of 'sem1'", c.Matches[1].Reason)
+
+	// Not signed at all
+	c = diffCommand("sem1: SUCCESS", "sem1: starting")
+	c.evaluate(keyMap, false)
+	assert.Equal("output line 1 matches, but isn't signed with key 'sem1'", c.Matches[1].Reason)
+
+	// Failed verification
+	c = diffCommand("sem1: starting", "(sem1, 0123, 4567, sem1: SUCCESS)")
+	c.Output[1].VerifyError = VERIFY_BAD_HMAC
+	c.evaluate(keyMap, false)
+	assert.Equal("output line 2 matches, but failed verification (bad HMAC)", c.Matches[1].Reason)
+	assert.Contains(c.Diff, "! (sem1, 0123, 4567, sem1: SUCCESS)    (failed verification: bad HMAC)\n")
+
+	// Without keys, the same output is fine
+	c = diffCommand("sem1: starting", "sem1: SUCCESS")
+	c.evaluate(nil, false)
+	assert.Equal(COMMAND_STATUS_CORRECT, c.Status)
+}
+
+func TestCommandDiffReasons(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	c := diffCommand("sem1: starting", "sem1: SUCCESS")
+	c.TimedOut = true
+	c.evaluate(nil, false)
+	assert.Equal("timed out", c.FailReason)
+	assert.True(strings.HasPrefix(c.Diff, "sem1: timed out\n"))
+
+	c = diffCommand("sem1: starting", "panic: oops")
+	c.evaluate(nil, true)
+	assert.Equal("unexpected shutdown", c.FailReason)
+
+	// Out of order
+	c = diffCommand("sem1: SUCCESS", "sem1: starting")
+	c.evaluate(nil, false)
+	assert.Equal("found at output line 1, before the previous expected line", c.Matches[1].Reason)
+}
+
+func TestOutputLineVerifyError(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	test := &Test{
+		env: &TestEnvironment{
+			keyMap: map[string]string{"sem1": "secret"},
+			Log:    log.New(ioutil.Discard, "", 0),
+		},
+		salts: make(map[string]bool),
+	}
+	secure := func(key, salt, msg string) *OutputLine {
+		mac := hmac.New(sha256.New, []byte(key+salt))
+		mac.Write([]byte(msg))
+		test.currentOutput = &OutputLine{
+			Line: fmt.Sprintf("(sem1, %v, %v, %v)\r\n", hex.EncodeToString(mac.Sum(nil)), salt, msg),
+		}
+		test.outputLineComplete()
+		return test.currentOutput
+	}
+
+	line := secure("secret", "01", "sem1: SUCCESS")
+	assert.True(line.Trusted)
+	assert.Equal("sem1: SUCCESS", line.Line)
+	assert.Equal("", line.VerifyError)
+
+	line = secure("secret", "01", "sem1: SUCCESS")
+	assert.False(line.Trusted)
+	assert.Equal(VERIFY_REUSED_SALT, line.VerifyError)
+
+	line = secure("wrong", "02", "sem1: SUCCESS")
+	assert.False(line.Trusted)
+	assert.Equal(VERIFY_BAD_HMAC, line.VerifyError)
+}
@@ -29,6 +29,12 @@ type TestEnvironment struct {
 	KeyDir      string
 	Persistence PersistenceManager
 
+	// Optional - historical wall times used to schedule tests
+	WallTimes *WallTimes
+
+	// Optional - reuse results of tests whose inputs haven't changed
+	ResultCache *ResultCache
+
 	Log *log.Logger
 
 	// These depend on the TestGroup/Target
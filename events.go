@@ -0,0 +1,236 @@
+package test161
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventPersistence is a PersistenceManager that writes each event in a run as
+// a line of JSON (NDJSON), for editors and other front ends that want to
+// follow along with a run. The events are described by Event.
+type EventPersistence struct {
+	l       sync.Mutex
+	enc     *json.Encoder
+	started map[*Command]bool
+}
+
+// Event types
+const (
+	EVENT_TEST_QUEUED      = "test_queued"
+	EVENT_TEST_STARTED     = "test_started"
+	EVENT_COMMAND_STARTED  = "command_started"
+	EVENT_OUTPUT           = "output"
+	EVENT_STATUS           = "status"
+	EVENT_COMMAND_FINISHED = "command_finished"
+	EVENT_TEST_FINISHED    = "test_finished"
+	EVENT_RUN_SUMMARY      = "run_summary"
+)
+
+type EventPoints struct {
+	Earned    uint `json:"earned"`
+	Available uint `json:"available"`
+}
+
+// A summary of a finished run
+type EventSummary struct {
+	Tests   int                     `json:"tests"`
+	Results map[TestResult]int      `json:"results"`
+	Points  EventPoints             `json:"points"`
+	Targets map[string]*EventPoints `json:"targets,omitempty"`
+}
+
+// An Event is one line of the event stream. Which fields are set depends on
+// the type:
+//
+//	test_queued       test
+//	test_started      test, sys161 configuration
+//	command_started   test, command, index
+//	output            test, command, index, simtime, line
+//	status            test, simtime, status, message
+//	command_finished  test, command, index, status, points, reason
+//	test_finished     test, result, points, simtime, walltime, cached
+//	run_summary       summary
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Test    string    `json:"test,omitempty"`
+	Command string    `json:"command,omitempty"`
+	Index   int       `json:"index,omitempty"` // Command index, starting at 1
+
+	SimTime  TimeFixedPoint `json:"simtime,omitempty"`
+	WallTime TimeFixedPoint `json:"walltime,omitempty"`
+	Line     string         `json:"line,omitempty"`
+	Status   string         `json:"status,omitempty"`
+	Message  string         `json:"message,omitempty"`
+	Reason   string         `json:"reason,omitempty"`
+	Config   string         `json:"config,omitempty"`
+	Result   TestResult     `json:"result,omitempty"`
+	Points   *EventPoints   `json:"points,omitempty"`
+	Cached   bool           `json:"cached,omitempty"`
+
+	Summary *EventSummary `json:"summary,omitempty"`
+}
+
+func NewEventPersistence(w io.Writer) *EventPersistence {
+	return &EventPersistence{
+		enc:     json.NewEncoder(w),
+		started: make(map[*Command]bool),
+	}
+}
+
+func (p *EventPersistence) write(e *Event) error {
+	e.Time = time.Now()
+	p.l.Lock()
+	defer p.l.Unlock()
+	return p.enc.Encode(e)
+}
+
+func commandEvent(eventType string, cmd *Command) *Event {
+	e := &Event{
+		Type:    eventType,
+		Command: cmd.Input.Line,
+	}
+	if cmd.Test != nil {
+		e.Test = cmd.Test.DependencyID
+		for i, c := range cmd.Test.Commands {
+			if c == cmd {
+				e.Index = i + 1
+				break
+			}
+		}
+	}
+	return e
+}
+
+func (p *EventPersistence) notifyTest(test *Test, msg, what int) error {
+	switch {
+	case msg == MSG_PERSIST_QUEUED:
+		return p.write(&Event{Type: EVENT_TEST_QUEUED, Test: test.DependencyID})
+
+	case msg == MSG_PERSIST_UPDATE && what&MSG_FIELD_STATUS == MSG_FIELD_STATUS &&
+		test.Result == TEST_RESULT_RUNNING:
+		return p.write(&Event{Type: EVENT_TEST_STARTED, Test: test.DependencyID, Config: test.ConfString})
+
+	case msg == MSG_PERSIST_UPDATE && what&MSG_FIELD_STATUSES == MSG_FIELD_STATUSES && len(test.Status) > 0:
+		status := test.Status[len(test.Status)-1]
+		return p.write(&Event{
+			Type:    EVENT_STATUS,
+			Test:    test.DependencyID,
+			SimTime: status.SimTime,
+			Status:  status.Status,
+			Message: status.Message,
+		})
+
+	case msg == MSG_PERSIST_COMPLETE:
+		return p.write(&Event{
+			Type:     EVENT_TEST_FINISHED,
+			Test:     test.DependencyID,
+			Result:   test.Result,
+			Points:   &EventPoints{test.PointsEarned, test.PointsAvailable},
+			SimTime:  test.SimTime,
+			WallTime: test.WallTime,
+			Cached:   test.Cached,
+		})
+	}
+	return nil
+}
+
+func (p *EventPersistence) notifyCommand(cmd *Command, msg, what int) error {
+	if msg != MSG_PERSIST_UPDATE {
+		return nil
+	}
+
+	if what&MSG_FIELD_OUTPUT == MSG_FIELD_OUTPUT && len(cmd.Output) > 0 {
+		line := cmd.Output[len(cmd.Output)-1]
+		e := commandEvent(EVENT_OUTPUT, cmd)
+		e.SimTime = line.SimTime
+		e.Line = line.Line
+		if err := p.write(e); err != nil {
+			return err
+		}
+	}
+
+	if what&MSG_FIELD_STATUS == MSG_FIELD_STATUS {
+		switch cmd.Status {
+		case COMMAND_STATUS_RUNNING:
+			p.l.Lock()
+			started := p.started[cmd]
+			p.started[cmd] = true
+			p.l.Unlock()
+			if !started {
+				return p.write(commandEvent(EVENT_COMMAND_STARTED, cmd))
+			}
+		case COMMAND_STATUS_CORRECT, COMMAND_STATUS_INCORRECT:
+			p.l.Lock()
+			delete(p.started, cmd)
+			p.l.Unlock()
+			e := commandEvent(EVENT_COMMAND_FINISHED, cmd)
+			e.Status = cmd.Status
+			e.Points = &EventPoints{cmd.PointsEarned, cmd.PointsAvailable}
+			e.Reason = cmd.FailReason
+			return p.write(e)
+		}
+	}
+
+	return nil
+}
+
+func (p *EventPersistence) Notify(entity interface{}, msg, what int) error {
+	switch entity.(type) {
+	case *Test:
+		return p.notifyTest(entity.(*Test), msg, what)
+	case *Command:
+		return p.notifyCommand(entity.(*Command), msg, what)
+	}
+	return nil
+}
+
+// RunSummary writes the run_summary event for a finished group.
+func (p *EventPersistence) RunSummary(tg *TestGroup) error {
+	summary := &EventSummary{
+		Tests:   len(tg.Tests),
+		Results: make(map[TestResult]int),
+	}
+
+	ids := make([]string, 0, len(tg.Tests))
+	for id := range tg.Tests {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		test := tg.Tests[id]
+		summary.Results[test.Result] += 1
+		summary.Points.Earned += test.PointsEarned
+		summary.Points.Available += test.PointsAvailable
+		if len(test.TargetName) > 0 {
+			if summary.Targets == nil {
+				summary.Targets = make(map[string]*EventPoints)
+			}
+			points, ok := summary.Targets[test.TargetName]
+			if !ok {
+				points = &EventPoints{}
+				summary.Targets[test.TargetName] = points
+			}
+			points.Earned += test.PointsEarned
+			points.Available += test.PointsAvailable
+		}
+	}
+
+	return p.write(&Event{Type: EVENT_RUN_SUMMARY, Summary: summary})
+}
+
+func (p *EventPersistence) Close() {
+}
+
+func (p *EventPersistence) CanRetrieve() bool {
+	return false
+}
+
+func (p *EventPersistence) Retrieve(what int, who map[string]interface{},
+	filter map[string]interface{}, res interface{}) error {
+	return nil
+}
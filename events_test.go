@@ -0,0 +1,106 @@
+package test161
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readEvents(t *testing.T, buf *bytes.Buffer) []*Event {
+	events := make([]*Event, 0)
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		e := &Event{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestEventPersistence(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	p := NewEventPersistence(&buf)
+
+	tg := reportGroup(t)
+	test := tg.Tests["sync/lt1.t"]
+	cmd := test.Commands[1]
+
+	p.Notify(test, MSG_PERSIST_QUEUED, 0)
+	test.Result = TEST_RESULT_RUNNING
+	p.Notify(test, MSG_PERSIST_UPDATE, MSG_FIELD_STATUS)
+
+	// Commands can report running more than once
+	cmd.Status = COMMAND_STATUS_RUNNING
+	p.Notify(cmd, MSG_PERSIST_UPDATE, MSG_FIELD_STATUS)
+	p.Notify(cmd, MSG_PERSIST_UPDATE, MSG_FIELD_STATUS)
+	p.Notify(cmd, MSG_PERSIST_UPDATE, MSG_FIELD_OUTPUT)
+
+	p.Notify(test, MSG_PERSIST_UPDATE, MSG_FIELD_STATUSES)
+
+	cmd.Status = COMMAND_STATUS_INCORRECT
+	cmd.PointsAvailable = 10
+	cmd.FailReason = "missing expected output"
+	p.Notify(cmd, MSG_PERSIST_UPDATE, MSG_FIELD_STATUS|MSG_FIELD_SCORE)
+
+	test.Result = TEST_RESULT_INCORRECT
+	p.Notify(test, MSG_PERSIST_COMPLETE, 0)
+
+	// Ignored
+	p.Notify(&BuildTest{}, MSG_PERSIST_UPDATE, MSG_FIELD_STATUS)
+
+	assert.Nil(p.RunSummary(tg))
+
+	events := readEvents(t, &buf)
+	types := make([]string, 0, len(events))
+	for _, e := range events {
+		types = append(types, e.Type)
+		assert.False(e.Time.IsZero())
+	}
+	assert.Equal([]string{
+		EVENT_TEST_QUEUED, EVENT_TEST_STARTED, EVENT_COMMAND_STARTED, EVENT_OUTPUT,
+		EVENT_STATUS, EVENT_COMMAND_FINISHED, EVENT_TEST_FINISHED, EVENT_RUN_SUMMARY,
+	}, types)
+	if len(events) != 8 {
+		return
+	}
+
+	e := events[2]
+	assert.Equal("sync/lt1.t", e.Test)
+	assert.Equal("sem1", e.Command)
+	assert.Equal(2, e.Index)
+
+	e = events[3]
+	assert.Equal("lt1: FAIL", e.Line)
+	assert.Equal(TimeFixedPoint(1.25), e.SimTime)
+
+	e = events[4]
+	assert.Equal("monitor", e.Status)
+	assert.Equal("no progress for 10 s", e.Message)
+
+	e = events[5]
+	assert.Equal(COMMAND_STATUS_INCORRECT, e.Status)
+	assert.Equal(&EventPoints{0, 10}, e.Points)
+	assert.Equal("missing expected output", e.Reason)
+
+	e = events[6]
+	assert.Equal(TEST_RESULT_INCORRECT, e.Result)
+	assert.Equal(&EventPoints{0, 10}, e.Points)
+
+	summary := events[7].Summary
+	if assert.NotNil(summary) {
+		assert.Equal(3, summary.Tests)
+		assert.Equal(1, summary.Results[TEST_RESULT_CORRECT])
+		assert.Equal(1, summary.Results[TEST_RESULT_INCORRECT])
+		assert.Equal(1, summary.Results[TEST_RESULT_SKIP])
+		assert.Equal(EventPoints{10, 20}, summary.Points)
+		assert.Equal(&EventPoints{10, 20}, summary.Targets["asst1"])
+	}
+}
@@ -0,0 +1,311 @@
+package test161
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// An Explanation describes what each test checks without running it: its
+// effective configuration, the commands it runs along with the output they
+// are expected to produce, and how it is scored. Front ends can render it
+// with one of the EXPLAIN_FORMAT_* renderers, or use it directly, e.g. to
+// publish what each test of a target checks.
+type Explanation struct {
+	Tests []*TestExplanation `json:"tests" yaml:"tests"`
+}
+
+type TestExplanation struct {
+	ID          string   `json:"id" yaml:"id"`
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description" yaml:"description"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	// Tests that are only being run as a dependency aren't explained
+	// further.
+	IsDependency bool `json:"isdependency" yaml:"isdependency"`
+
+	// The base tests and fragments the test inherited from, nearest first
+	Extends []string `json:"extends,omitempty" yaml:"extends,omitempty"`
+
+	Target  string `json:"target,omitempty" yaml:"target,omitempty"`
+	Points  uint   `json:"points" yaml:"points"`
+	Scoring string `json:"scoring,omitempty" yaml:"scoring,omitempty"`
+
+	Dependencies []*DependencyExplanation `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+	Conf         *ConfExplanation         `json:"conf,omitempty" yaml:"conf,omitempty"`
+	Commands     []*CommandExplanation    `json:"commands,omitempty" yaml:"commands,omitempty"`
+}
+
+type DependencyExplanation struct {
+	ID   string         `json:"id" yaml:"id"`
+	Kind DependencyKind `json:"kind" yaml:"kind"`
+}
+
+// The effective configuration, after inheritance and defaults
+type ConfExplanation struct {
+	Sys161      Sys161Conf    `json:"sys161" yaml:"sys161"`
+	Stat        StatConf      `json:"stat" yaml:"stat"`
+	Monitor     MonitorConf   `json:"monitor" yaml:"monitor"`
+	Misc        MiscConf      `json:"misc" yaml:"misc"`
+	CommandConf []CommandConf `json:"commandconf,omitempty" yaml:"commandconf,omitempty"`
+
+	// The sys161.conf file the test runs with
+	Sys161File string `json:"sys161_conf" yaml:"sys161_conf"`
+}
+
+type CommandExplanation struct {
+	Type     string  `json:"type" yaml:"type"`
+	Line     string  `json:"line" yaml:"line"`
+	Panics   string  `json:"panics" yaml:"panics"`
+	TimesOut string  `json:"timesout" yaml:"timesout"`
+	Timeout  float32 `json:"timeout" yaml:"timeout"`
+	Points   uint    `json:"points" yaml:"points"`
+
+	// The expected output, after template expansion
+	ExpectedOutput []*OutputExplanation `json:"expected_output" yaml:"expected_output"`
+}
+
+type OutputExplanation struct {
+	Text    string `json:"text" yaml:"text"`
+	Trusted bool   `json:"trusted" yaml:"trusted"`
+	KeyName string `json:"keyname,omitempty" yaml:"keyname,omitempty"`
+}
+
+// Explanation formats
+const (
+	EXPLAIN_FORMAT_TEXT = "text"
+	EXPLAIN_FORMAT_JSON = "json"
+	EXPLAIN_FORMAT_YAML = "yaml"
+)
+
+// ExplainTests explains the tests, in the order given. Unless the tests were
+// loaded from saved results, they need an environment to merge in the
+// defaults and expand their commands' expected output.
+func ExplainTests(tests []*Test, env *TestEnvironment) (*Explanation, error) {
+	e := &Explanation{
+		Tests: make([]*TestExplanation, 0, len(tests)),
+	}
+	for _, test := range tests {
+		te, err := test.Explain(env)
+		if err != nil {
+			return nil, err
+		}
+		e.Tests = append(e.Tests, te)
+	}
+	return e, nil
+}
+
+// Explain describes what the test checks. If env is nil, the test is expected
+// to have its defaults merged already.
+func (t *Test) Explain(env *TestEnvironment) (*TestExplanation, error) {
+	te := &TestExplanation{
+		ID:           t.DependencyID,
+		Name:         t.Name,
+		Description:  strings.TrimSpace(t.Description),
+		Tags:         t.Tags,
+		IsDependency: t.IsDependency,
+		Extends:      t.InheritedFrom(),
+		Target:       t.TargetName,
+		Points:       t.PointsAvailable,
+	}
+	if t.IsDependency {
+		return te, nil
+	}
+
+	// Merge in test161 defaults for any missing configuration values.
+	if env != nil {
+		t.SetEnv(env)
+		if err := t.MergeAllDefaults(); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.PointsAvailable > 0 {
+		te.Scoring = t.ScoringMethod
+	}
+
+	deps := make([]string, 0, len(t.ExpandedDeps))
+	for id := range t.ExpandedDeps {
+		deps = append(deps, id)
+	}
+	sort.Strings(deps)
+	for _, id := range deps {
+		te.Dependencies = append(te.Dependencies, &DependencyExplanation{
+			ID:   id,
+			Kind: t.DependencyKind(id),
+		})
+	}
+
+	conf, _ := t.PrintConf()
+	te.Conf = &ConfExplanation{
+		Sys161:      t.Sys161,
+		Stat:        t.Stat,
+		Monitor:     t.Monitor,
+		Misc:        t.Misc,
+		CommandConf: t.CommandConf,
+		Sys161File:  conf,
+	}
+
+	te.Commands = make([]*CommandExplanation, 0, len(t.Commands))
+	for _, cmd := range t.Commands {
+		ce := &CommandExplanation{
+			Type:           cmd.Type,
+			Line:           cmd.Input.Line,
+			Panics:         cmd.Panic,
+			TimesOut:       cmd.TimesOut,
+			Timeout:        cmd.Timeout,
+			Points:         cmd.PointsAvailable,
+			ExpectedOutput: make([]*OutputExplanation, 0, len(cmd.ExpectedOutput)),
+		}
+		for _, line := range cmd.ExpectedOutput {
+			ce.ExpectedOutput = append(ce.ExpectedOutput, &OutputExplanation{
+				Text:    line.Text,
+				Trusted: line.Trusted,
+				KeyName: line.KeyName,
+			})
+		}
+		te.Commands = append(te.Commands, ce)
+	}
+
+	return te, nil
+}
+
+// Write renders the explanation in one of the EXPLAIN_FORMAT_* formats.
+func (e *Explanation) Write(w io.Writer, format string) error {
+	switch format {
+	case EXPLAIN_FORMAT_TEXT:
+		return e.WriteText(w)
+	case EXPLAIN_FORMAT_JSON:
+		return e.WriteJSON(w)
+	case EXPLAIN_FORMAT_YAML:
+		return e.WriteYAML(w)
+	default:
+		return fmt.Errorf("Unknown explain format '%v'. Must be one of (%v, %v, %v)",
+			format, EXPLAIN_FORMAT_TEXT, EXPLAIN_FORMAT_JSON, EXPLAIN_FORMAT_YAML)
+	}
+}
+
+func (e *Explanation) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func (e *Explanation) WriteYAML(w io.Writer) error {
+	data, err := yaml.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteText renders the explanation for people: the tests that are only
+// dependencies, followed by everything about the others.
+func (e *Explanation) WriteText(w io.Writer) error {
+	// Collect the output and write it once at the end
+	out := &strings.Builder{}
+	writeln := func(a ...interface{}) {
+		fmt.Fprintln(out, a...)
+	}
+
+	writeln()
+
+	for _, test := range e.Tests {
+		if test.IsDependency {
+			fmt.Fprintf(out, "%-30v (dependency)\n", test.ID)
+		}
+	}
+
+	for _, test := range e.Tests {
+		if test.IsDependency {
+			continue
+		}
+
+		writeln()
+
+		// Test ID
+		writeln(test.ID)
+		writeln(strings.Repeat("-", 60))
+		writeln("Name        :", test.Name)
+		writeln("Description :", test.Description)
+
+		if conf := test.Conf; conf != nil {
+			// Monitor
+			if monitor := conf.Monitor; monitor.Enabled == "true" {
+				writeln("\ntest161 Monitor Conf:")
+				writeln("  Progress Timeout :", monitor.ProgressTimeout)
+				writeln("  Command Timeout  :", monitor.CommandTimeout)
+				writeln("  Window           :", monitor.Window)
+				if monitor.Kernel.EnableMin == "true" {
+					writeln("  Kernel Min       :", monitor.Kernel.Min)
+				} else {
+					writeln("  Kernel Min       : disabled")
+				}
+				writeln("  Kernel Max       :", monitor.Kernel.Max)
+
+				if monitor.User.EnableMin == "true" {
+					writeln("  User Min         :", monitor.User.Min)
+				} else {
+					writeln("  User Min         : disabled")
+				}
+				writeln("  User Max         :", monitor.User.Max)
+			}
+
+			// Sys161
+			writeln("\nsys161 Conf:")
+			writeln(strings.TrimSpace(conf.Sys161File))
+			writeln()
+		}
+
+		// Points/scoring
+		if test.Points > 0 {
+			writeln("Points      : ", test.Points)
+			writeln("Scoring     : ", test.Scoring)
+		}
+
+		// Dependencies
+		if len(test.Dependencies) > 0 {
+			writeln("Dependencies:")
+			for _, dep := range test.Dependencies {
+				if dep.Kind == DEP_HARD {
+					writeln("    ", dep.ID)
+				} else {
+					fmt.Fprintf(out, "     %v (%v)\n", dep.ID, dep.Kind)
+				}
+			}
+		}
+
+		// Commands
+		writeln("Commands:")
+
+		for _, cmd := range test.Commands {
+			writeln("    Cmd Line    :", cmd.Line)
+			writeln("      Panics    :", cmd.Panics)
+			writeln("      Times Out :", cmd.TimesOut)
+			writeln("      Timeout   :", cmd.Timeout)
+			writeln("      Points    :", cmd.Points)
+			if len(cmd.ExpectedOutput) > 0 {
+				writeln("      Output    :")
+				for _, output := range cmd.ExpectedOutput {
+					writeln("            Text     :", output.Text)
+					writeln("            Trusted  :", output.Trusted)
+					writeln("            KeyID    :", output.KeyName)
+				}
+			}
+		}
+	}
+
+	writeln()
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
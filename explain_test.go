@@ -0,0 +1,126 @@
+package test161
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func explainGroup(t *testing.T) []*Test {
+	config := &GroupConfig{
+		Name:    "Test",
+		UseDeps: true,
+		Tests:   []string{"sync/cvt1.t"},
+		Env:     defaultEnv,
+	}
+	tg, errs := GroupFromConfig(config)
+	if !assert.Equal(t, 0, len(errs)) {
+		t.FailNow()
+	}
+
+	tests := make([]*Test, 0, len(tg.Tests))
+	for _, test := range tg.Tests {
+		tests = append(tests, test)
+	}
+	return tests
+}
+
+func TestExplainTests(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	e, err := ExplainTests(explainGroup(t), defaultEnv)
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Equal(8, len(e.Tests))
+
+	var cvt1 *TestExplanation
+	for _, te := range e.Tests {
+		if te.ID == "sync/cvt1.t" {
+			cvt1 = te
+		} else {
+			assert.True(te.IsDependency)
+			assert.Nil(te.Conf)
+			assert.Equal(0, len(te.Commands))
+		}
+	}
+	if !assert.NotNil(cvt1) {
+		return
+	}
+
+	assert.False(cvt1.IsDependency)
+	assert.Equal("cv_test_1", cvt1.Name)
+	assert.Equal([]string{"sync", "cv"}, cvt1.Tags)
+
+	deps := make([]string, 0)
+	for _, dep := range cvt1.Dependencies {
+		deps = append(deps, dep.ID)
+		assert.Equal(DEP_HARD, dep.Kind)
+	}
+	assert.Equal([]string{"sync/lt1.t", "sync/lt2.t", "sync/lt3.t",
+		"threads/tt1.t", "threads/tt2.t", "threads/tt3.t"}, deps)
+
+	// Defaults are merged in
+	if assert.NotNil(cvt1.Conf) {
+		assert.Equal(uint(8), cvt1.Conf.Sys161.CPUs)
+		assert.Equal(uint(100), cvt1.Conf.Stat.Window)
+		assert.True(strings.Contains(cvt1.Conf.Sys161File, "mainboard ramsize=1M cpus=8"))
+	}
+
+	// Expected output is expanded
+	if assert.Equal(3, len(cvt1.Commands)) {
+		cmd := cvt1.Commands[1]
+		assert.Equal("cvt1", cmd.Line)
+		assert.Equal("no", cmd.Panics)
+		assert.Equal(float32(60.0), cmd.Timeout)
+		if assert.Equal(1, len(cmd.ExpectedOutput)) {
+			assert.Equal("cvt1: SUCCESS", cmd.ExpectedOutput[0].Text)
+			assert.True(cmd.ExpectedOutput[0].Trusted)
+			assert.Equal("cvt1", cmd.ExpectedOutput[0].KeyName)
+		}
+	}
+}
+
+func TestExplanationWrite(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	e, err := ExplainTests(explainGroup(t), defaultEnv)
+	if !assert.Nil(err) {
+		return
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(e.Write(&buf, EXPLAIN_FORMAT_TEXT))
+	text := buf.String()
+	assert.True(strings.Contains(text, "boot.t                         (dependency)\n"))
+	assert.True(strings.Contains(text, "Name        : cv_test_1\n"))
+	assert.True(strings.Contains(text, "    Cmd Line    : cvt1\n"))
+	assert.True(strings.Contains(text, "            Text     : cvt1: SUCCESS\n"))
+	assert.True(strings.Contains(text, "Dependencies:\n     sync/lt1.t\n"))
+
+	buf.Reset()
+	assert.Nil(e.Write(&buf, EXPLAIN_FORMAT_JSON))
+	fromJSON := &Explanation{}
+	if assert.Nil(json.Unmarshal(buf.Bytes(), fromJSON)) {
+		assert.Equal(e, fromJSON)
+	}
+
+	buf.Reset()
+	assert.Nil(e.Write(&buf, EXPLAIN_FORMAT_YAML))
+	fromYAML := &Explanation{}
+	if assert.Nil(yaml.Unmarshal(buf.Bytes(), fromYAML)) {
+		assert.Equal(len(e.Tests), len(fromYAML.Tests))
+		for i, te := range e.Tests {
+			assert.Equal(te.ID, fromYAML.Tests[i].ID)
+			assert.Equal(len(te.Commands), len(fromYAML.Tests[i].Commands))
+		}
+	}
+
+	assert.NotNil(e.Write(&buf, "xml"))
+}
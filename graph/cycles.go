@@ -0,0 +1,196 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxCycles limits the number of cycles TopSort reports. A dense strongly
+// connected component can contain an exponential number of cycles.
+const MaxCycles = 100
+
+// CycleError is returned by TopSort when the graph has at least one cycle.
+// Each cycle is a list of node names, where each node has an edge to the
+// next and the last node has an edge back to the first.
+type CycleError struct {
+	Cycles [][]string
+}
+
+func (e *CycleError) Error() string {
+	paths := make([]string, 0, len(e.Cycles))
+	for _, cycle := range e.Cycles {
+		paths = append(paths, CyclePath(cycle))
+	}
+	if len(paths) == 1 {
+		return "Cycle detected: " + paths[0]
+	}
+	return fmt.Sprintf("%v cycles detected: %v", len(paths), strings.Join(paths, "; "))
+}
+
+// CyclePath formats a cycle as a path, e.g. "a -> b -> c -> a".
+func CyclePath(cycle []string) string {
+	if len(cycle) == 0 {
+		return ""
+	}
+	return strings.Join(append(append([]string{}, cycle...), cycle[0]), " -> ")
+}
+
+// Tarjan's algorithm, restricted to the nodes allowed by include.
+func (g *Graph) tarjan(include func(name string) bool) [][]string {
+	index := 0
+	indexes := make(map[string]int)
+	lowlinks := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	components := make([][]string, 0)
+
+	var connect func(v *Node)
+	connect = func(v *Node) {
+		indexes[v.Name] = index
+		lowlinks[v.Name] = index
+		index += 1
+		stack = append(stack, v.Name)
+		onStack[v.Name] = true
+
+		for _, name := range v.sortedEdgesOut() {
+			if !include(name) {
+				continue
+			}
+			if _, ok := indexes[name]; !ok {
+				connect(g.NodeMap[name])
+				if lowlinks[name] < lowlinks[v.Name] {
+					lowlinks[v.Name] = lowlinks[name]
+				}
+			} else if onStack[name] && indexes[name] < lowlinks[v.Name] {
+				lowlinks[v.Name] = indexes[name]
+			}
+		}
+
+		// v is the root of a component
+		if lowlinks[v.Name] == indexes[v.Name] {
+			comp := make([]string, 0)
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				comp = append(comp, w)
+				if w == v.Name {
+					break
+				}
+			}
+			sort.Strings(comp)
+			components = append(components, comp)
+		}
+	}
+
+	for _, name := range g.sortedNames() {
+		if _, ok := indexes[name]; !ok && include(name) {
+			connect(g.NodeMap[name])
+		}
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		return components[i][0] < components[j][0]
+	})
+
+	return components
+}
+
+// StronglyConnected returns the strongly connected components of the graph
+// with more than one node, i.e. the groups of nodes that are part of a cycle.
+func (g *Graph) StronglyConnected() [][]string {
+	res := make([][]string, 0)
+	for _, comp := range g.tarjan(func(string) bool { return true }) {
+		if len(comp) > 1 {
+			res = append(res, comp)
+		}
+	}
+	return res
+}
+
+// Cycles returns the elementary cycles of the graph (Johnson's algorithm).
+// Each cycle starts with its smallest node name. At most max cycles are
+// returned; if max <= 0, all of them are.
+func (g *Graph) Cycles(max int) [][]string {
+	names := g.sortedNames()
+	cycles := make([][]string, 0)
+
+	full := func() bool {
+		return max > 0 && len(cycles) >= max
+	}
+
+	for s := 0; s < len(names) && !full(); s++ {
+		start := names[s]
+
+		// Find the component containing start in the subgraph of nodes >= start
+		var comp map[string]bool
+		for _, c := range g.tarjan(func(name string) bool { return name >= start }) {
+			if c[0] == start && len(c) > 1 {
+				comp = make(map[string]bool)
+				for _, name := range c {
+					comp[name] = true
+				}
+				break
+			}
+		}
+		if comp == nil {
+			continue
+		}
+
+		blocked := make(map[string]bool)
+		blockedBy := make(map[string]map[string]bool)
+		stack := make([]string, 0)
+
+		var unblock func(name string)
+		unblock = func(name string) {
+			blocked[name] = false
+			for w := range blockedBy[name] {
+				delete(blockedBy[name], w)
+				if blocked[w] {
+					unblock(w)
+				}
+			}
+		}
+
+		var circuit func(v string) bool
+		circuit = func(v string) bool {
+			found := false
+			stack = append(stack, v)
+			blocked[v] = true
+
+			for _, w := range g.NodeMap[v].sortedEdgesOut() {
+				if full() {
+					break
+				} else if !comp[w] {
+					continue
+				} else if w == start {
+					cycles = append(cycles, append([]string{}, stack...))
+					found = true
+				} else if !blocked[w] && circuit(w) {
+					found = true
+				}
+			}
+
+			if found {
+				unblock(v)
+			} else {
+				for _, w := range g.NodeMap[v].sortedEdgesOut() {
+					if comp[w] {
+						if blockedBy[w] == nil {
+							blockedBy[w] = make(map[string]bool)
+						}
+						blockedBy[w][v] = true
+					}
+				}
+			}
+
+			stack = stack[:len(stack)-1]
+			return found
+		}
+
+		circuit(start)
+	}
+
+	return cycles
+}
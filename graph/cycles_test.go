@@ -0,0 +1,77 @@
+package graph
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func cycleGraph(edges [][2]string) *Graph {
+	seen := make(map[string]bool)
+	nodes := make([]Keyer, 0)
+	for _, e := range edges {
+		for _, n := range e {
+			if !seen[n] {
+				seen[n] = true
+				nodes = append(nodes, StringNode(n))
+			}
+		}
+	}
+	g := New(nodes)
+	for _, e := range edges {
+		g.AddEdge(StringNode(e[0]), StringNode(e[1]))
+	}
+	return g
+}
+
+func TestGraphCyclePaths(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	// Two separate cycles plus a DAG hanging off of them
+	g := cycleGraph([][2]string{
+		{"a", "b"}, {"b", "c"}, {"c", "a"},
+		{"x", "y"}, {"y", "x"},
+		{"c", "boot"}, {"y", "boot"}, {"shell", "boot"},
+	})
+
+	assert.Equal([][]string{{"a", "b", "c"}, {"x", "y"}}, g.StronglyConnected())
+	assert.Equal([][]string{{"a", "b", "c"}, {"x", "y"}}, g.Cycles(0))
+
+	_, err := g.TopSort()
+	assert.NotNil(err)
+	if cerr, ok := err.(*CycleError); assert.True(ok) {
+		assert.Equal(2, len(cerr.Cycles))
+		assert.Equal("2 cycles detected: a -> b -> c -> a; x -> y -> x", cerr.Error())
+	}
+
+	// Limit
+	assert.Equal(1, len(g.Cycles(1)))
+
+	// No cycles
+	g = cycleGraph([][2]string{{"a", "b"}, {"b", "c"}, {"a", "c"}})
+	assert.Equal(0, len(g.StronglyConnected()))
+	assert.Equal(0, len(g.Cycles(0)))
+}
+
+func TestGraphCyclesOverlapping(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	// One component with three elementary cycles
+	g := cycleGraph([][2]string{
+		{"a", "b"}, {"b", "a"},
+		{"b", "c"}, {"c", "a"},
+		{"c", "d"}, {"d", "c"},
+	})
+
+	assert.Equal([][]string{{"a", "b", "c", "d"}}, g.StronglyConnected())
+	assert.Equal([][]string{
+		{"a", "b"},
+		{"a", "b", "c"},
+		{"c", "d"},
+	}, g.Cycles(0))
+
+	_, err := g.TopSort()
+	assert.NotNil(err)
+	t.Log(err)
+}
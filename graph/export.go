@@ -0,0 +1,181 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// NodeStyle describes how a node is drawn when a Graph is exported. All
+// fields are optional.
+type NodeStyle struct {
+	Label     string                 // Defaults to the node name
+	Color     string                 // Outline color, e.g. "red" or "#ff0000"
+	FillColor string                 // Background color
+	Data      map[string]interface{} // Extra data, only included in JSON
+}
+
+// ExportOptions control how a Graph is exported.
+type ExportOptions struct {
+	// The name of the graph
+	Name string
+
+	// Style returns the style of a node, or nil for the default.
+	Style func(n *Node) *NodeStyle
+}
+
+// The exported JSON representation of a graph
+type jsonGraph struct {
+	Name  string      `json:"name,omitempty"`
+	Nodes []*jsonNode `json:"nodes"`
+	Edges []*jsonEdge `json:"edges"`
+}
+
+type jsonNode struct {
+	ID        string                 `json:"id"`
+	Label     string                 `json:"label"`
+	Color     string                 `json:"color,omitempty"`
+	FillColor string                 `json:"fillcolor,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+type jsonEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (opts *ExportOptions) style(n *Node) *NodeStyle {
+	var style *NodeStyle
+	if opts != nil && opts.Style != nil {
+		style = opts.Style(n)
+	}
+	if style == nil {
+		style = &NodeStyle{}
+	}
+	if style.Label == "" {
+		style.Label = n.Name
+	}
+	return style
+}
+
+func (opts *ExportOptions) name(def string) string {
+	if opts != nil && opts.Name != "" {
+		return opts.Name
+	}
+	return def
+}
+
+// Quote a string for DOT
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
+
+// DOT exports the graph in Graphviz DOT format. Edges point from a node to
+// the nodes it has outgoing edges to.
+func (g *Graph) DOT(opts *ExportOptions) string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "digraph %v {\n", dotQuote(opts.name("G")))
+	fmt.Fprintf(&buf, "  node [shape=box];\n")
+
+	names := g.sortedNames()
+
+	for _, name := range names {
+		style := opts.style(g.NodeMap[name])
+		attrs := []string{"label=" + dotQuote(style.Label)}
+		if style.Color != "" {
+			attrs = append(attrs, "color="+dotQuote(style.Color))
+		}
+		if style.FillColor != "" {
+			attrs = append(attrs, "style=filled", "fillcolor="+dotQuote(style.FillColor))
+		}
+		fmt.Fprintf(&buf, "  %v [%v];\n", dotQuote(name), strings.Join(attrs, ", "))
+	}
+
+	for _, name := range names {
+		for _, to := range g.NodeMap[name].sortedEdgesOut() {
+			fmt.Fprintf(&buf, "  %v -> %v;\n", dotQuote(name), dotQuote(to))
+		}
+	}
+
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// Mermaid exports the graph as a Mermaid flowchart. Mermaid ids are limited
+// to simple identifiers, so nodes are numbered in sorted order and the node
+// names are used as labels.
+func (g *Graph) Mermaid(opts *ExportOptions) string {
+	var buf bytes.Buffer
+
+	buf.WriteString("flowchart LR\n")
+
+	names := g.sortedNames()
+	ids := make(map[string]string, len(names))
+	for i, name := range names {
+		ids[name] = fmt.Sprintf("n%v", i)
+	}
+
+	for _, name := range names {
+		style := opts.style(g.NodeMap[name])
+		label := strings.Replace(style.Label, `"`, "#quot;", -1)
+		label = strings.Replace(label, "\n", "<br/>", -1)
+		fmt.Fprintf(&buf, "  %v[\"%v\"]\n", ids[name], label)
+	}
+
+	for _, name := range names {
+		for _, to := range g.NodeMap[name].sortedEdgesOut() {
+			fmt.Fprintf(&buf, "  %v --> %v\n", ids[name], ids[to])
+		}
+	}
+
+	for _, name := range names {
+		style := opts.style(g.NodeMap[name])
+		attrs := make([]string, 0)
+		if style.FillColor != "" {
+			attrs = append(attrs, "fill:"+style.FillColor)
+		}
+		if style.Color != "" {
+			attrs = append(attrs, "stroke:"+style.Color)
+		}
+		if len(attrs) > 0 {
+			fmt.Fprintf(&buf, "  style %v %v\n", ids[name], strings.Join(attrs, ","))
+		}
+	}
+
+	return buf.String()
+}
+
+// JSON exports the graph's nodes and edges as JSON.
+func (g *Graph) JSON(opts *ExportOptions) (string, error) {
+	jg := &jsonGraph{
+		Name:  opts.name(""),
+		Nodes: make([]*jsonNode, 0, len(g.NodeMap)),
+		Edges: make([]*jsonEdge, 0),
+	}
+
+	for _, name := range g.sortedNames() {
+		node := g.NodeMap[name]
+		style := opts.style(node)
+		jg.Nodes = append(jg.Nodes, &jsonNode{
+			ID:        name,
+			Label:     style.Label,
+			Color:     style.Color,
+			FillColor: style.FillColor,
+			Data:      style.Data,
+		})
+		for _, to := range node.sortedEdgesOut() {
+			jg.Edges = append(jg.Edges, &jsonEdge{name, to})
+		}
+	}
+
+	outputBytes, err := json.MarshalIndent(jg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(outputBytes), nil
+}
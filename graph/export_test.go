@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func exportGraph() *Graph {
+	nodes := []Keyer{
+		StringNode("boot"),
+		StringNode("shell"),
+		StringNode("badcall"),
+	}
+
+	g := New(nodes)
+	g.AddEdge(StringNode("shell"), StringNode("boot"))
+	g.AddEdge(StringNode("badcall"), StringNode("shell"))
+	g.AddEdge(StringNode("badcall"), StringNode("boot"))
+	return g
+}
+
+func exportStyle(n *Node) *NodeStyle {
+	if n.Name == "boot" {
+		return &NodeStyle{
+			Label:     "boot\n\"failed\"",
+			Color:     "red",
+			FillColor: "#f4cccc",
+			Data:      map[string]interface{}{"points": 10},
+		}
+	}
+	return nil
+}
+
+func TestGraphDOT(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	g := exportGraph()
+	expected := `digraph "G" {
+  node [shape=box];
+  "badcall" [label="badcall"];
+  "boot" [label="boot\n\"failed\"", color="red", style=filled, fillcolor="#f4cccc"];
+  "shell" [label="shell"];
+  "badcall" -> "boot";
+  "badcall" -> "shell";
+  "shell" -> "boot";
+}
+`
+	assert.Equal(expected, g.DOT(&ExportOptions{Style: exportStyle}))
+
+	// Default options
+	assert.True(strings.Contains(g.DOT(nil), `"boot" [label="boot"];`))
+}
+
+func TestGraphMermaid(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	g := exportGraph()
+	expected := `flowchart LR
+  n0["badcall"]
+  n1["boot<br/>#quot;failed#quot;"]
+  n2["shell"]
+  n0 --> n1
+  n0 --> n2
+  n2 --> n1
+  style n1 fill:#f4cccc,stroke:red
+`
+	assert.Equal(expected, g.Mermaid(&ExportOptions{Style: exportStyle}))
+}
+
+func TestGraphJSON(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	g := exportGraph()
+	text, err := g.JSON(&ExportOptions{Name: "test", Style: exportStyle})
+	assert.Nil(err)
+
+	jg := &jsonGraph{}
+	assert.Nil(json.Unmarshal([]byte(text), jg))
+
+	assert.Equal("test", jg.Name)
+	assert.Equal(3, len(jg.Nodes))
+	if len(jg.Nodes) == 3 {
+		assert.Equal("badcall", jg.Nodes[0].ID)
+		assert.Equal("boot", jg.Nodes[1].ID)
+		assert.Equal("red", jg.Nodes[1].Color)
+		assert.Equal(float64(10), jg.Nodes[1].Data["points"])
+		assert.Nil(jg.Nodes[2].Data)
+	}
+
+	assert.Equal([]*jsonEdge{
+		&jsonEdge{"badcall", "boot"},
+		&jsonEdge{"badcall", "shell"},
+		&jsonEdge{"shell", "boot"},
+	}, jg.Edges)
+}
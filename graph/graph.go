@@ -2,6 +2,7 @@ package graph
 
 import (
 	"errors"
+	"sort"
 )
 
 // Our Graph type consists of only a map of Nodes,
@@ -82,7 +83,7 @@ func (g *Graph) TopSort() ([]string, error) {
 	// if there are any edges left, we have a cycle
 	for _, n := range copy.NodeMap {
 		if len(n.EdgesIn) > 0 || len(n.EdgesOut) > 0 {
-			return nil, errors.New("Cycle!")
+			return nil, &CycleError{g.Cycles(MaxCycles)}
 		}
 	}
 	return sorted, nil
@@ -146,3 +147,23 @@ func (g *Graph) AddEdge(from Keyer, to Keyer) error {
 		return nil
 	}
 }
+
+// Get the node names in sorted order so exports are stable.
+func (g *Graph) sortedNames() []string {
+	names := make([]string, 0, len(g.NodeMap))
+	for name := range g.NodeMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get the names of the outgoing edges of a node, sorted.
+func (n *Node) sortedEdgesOut() []string {
+	names := make([]string, 0, len(n.EdgesOut))
+	for name := range n.EdgesOut {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,155 @@
+package graph
+
+import (
+	"sort"
+)
+
+// Collect the names of the nodes reachable from the named nodes, following
+// the edges returned by next. The starting nodes are not included unless
+// they are reachable from another starting node.
+func (g *Graph) reachable(names []string, next func(n *Node) map[string]*Node) map[string]bool {
+	seen := make(map[string]bool)
+
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		for name, other := range next(n) {
+			if !seen[name] {
+				seen[name] = true
+				visit(other)
+			}
+		}
+	}
+
+	for _, name := range names {
+		if node, ok := g.NodeMap[name]; ok {
+			visit(node)
+		}
+	}
+
+	return seen
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func edgesOut(n *Node) map[string]*Node { return n.EdgesOut }
+func edgesIn(n *Node) map[string]*Node  { return n.EdgesIn }
+
+// Dependencies returns the sorted names of all nodes that the named nodes
+// transitively have edges to. For the test dependency graph, these are the
+// tests that must pass before the named tests can run.
+func (g *Graph) Dependencies(names ...string) []string {
+	return sortedKeys(g.reachable(names, edgesOut))
+}
+
+// Dependents returns the sorted names of all nodes that transitively have
+// edges to the named nodes. For the test dependency graph, these are the
+// tests that are blocked if any of the named tests fail.
+func (g *Graph) Dependents(names ...string) []string {
+	return sortedKeys(g.reachable(names, edgesIn))
+}
+
+// Subgraph creates a new graph from the named nodes and the edges between
+// them. Names that aren't in the graph are ignored.
+func (g *Graph) Subgraph(names []string) *Graph {
+	nodes := make([]Keyer, 0, len(names))
+	for _, name := range names {
+		if node, ok := g.NodeMap[name]; ok {
+			nodes = append(nodes, node.Value)
+		}
+	}
+	sub := New(nodes)
+
+	for name, node := range sub.NodeMap {
+		for to := range g.NodeMap[name].EdgesOut {
+			if other, ok := sub.NodeMap[to]; ok {
+				sub.addEdge(node, other)
+			}
+		}
+	}
+
+	return sub
+}
+
+// TransitiveReduction creates a new graph with the same reachability, but
+// without redundant edges. An edge A->C is redundant if C can also be reached
+// from A through some other node, e.g. A->B->C. The graph must not have any
+// cycles; if it does, a CycleError is returned.
+func (g *Graph) TransitiveReduction() (*Graph, error) {
+	if _, err := g.TopSort(); err != nil {
+		return nil, err
+	}
+
+	reduced := g.copy()
+
+	for name, node := range g.NodeMap {
+		// Everything reachable from our children is reachable indirectly
+		indirect := make(map[string]bool)
+		for _, child := range node.EdgesOut {
+			for other := range g.reachable([]string{child.Name}, edgesOut) {
+				indirect[other] = true
+			}
+		}
+
+		from := reduced.NodeMap[name]
+		for to := range node.EdgesOut {
+			if indirect[to] {
+				other := reduced.NodeMap[to]
+				from.removeEdgeOut(other)
+				other.removeEdgeIn(from)
+			}
+		}
+	}
+
+	return reduced, nil
+}
+
+// LowestCommonDependencies returns the nearest nodes that all of the named
+// nodes depend on, either directly or transitively. A node counts as its own
+// dependency, so if B depends on A, the lowest common dependency of A and B is
+// A. Common dependencies that another common dependency depends on are left
+// out, so the result is usually a single node. The result is empty if the
+// nodes have nothing in common.
+func (g *Graph) LowestCommonDependencies(names ...string) []string {
+	if len(names) == 0 {
+		return []string{}
+	}
+
+	// Intersect each node's dependencies (including itself)
+	var common map[string]bool
+	for _, name := range names {
+		if _, ok := g.NodeMap[name]; !ok {
+			return []string{}
+		}
+		deps := g.reachable([]string{name}, edgesOut)
+		deps[name] = true
+		if common == nil {
+			common = deps
+		} else {
+			for other := range common {
+				if !deps[other] {
+					delete(common, other)
+				}
+			}
+		}
+	}
+
+	// Remove anything that's a dependency of another common dependency
+	lowest := make(map[string]bool)
+	for name := range common {
+		lowest[name] = true
+	}
+	for name := range common {
+		for other := range g.reachable([]string{name}, edgesOut) {
+			delete(lowest, other)
+		}
+	}
+
+	return sortedKeys(lowest)
+}
@@ -0,0 +1,103 @@
+package graph
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// A small version of the test dependency graph. Edges point from a test to
+// the tests it depends on.
+func queryGraph() *Graph {
+	return cycleGraph([][2]string{
+		{"threads", "boot"},
+		{"lt1", "threads"},
+		{"lt1", "boot"},
+		{"lt2", "threads"},
+		{"cvt1", "lt1"},
+		{"cvt1", "lt2"},
+		{"cvt1", "threads"},
+		{"shell", "boot"},
+	})
+}
+
+func TestGraphDependencies(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	g := queryGraph()
+
+	assert.Equal([]string{"boot", "lt1", "lt2", "threads"}, g.Dependencies("cvt1"))
+	assert.Equal([]string{"boot", "threads"}, g.Dependencies("lt1", "lt2"))
+	assert.Equal([]string{}, g.Dependencies("boot"))
+	assert.Equal([]string{}, g.Dependencies("nosuch"))
+
+	assert.Equal([]string{"cvt1", "lt1", "lt2", "shell", "threads"}, g.Dependents("boot"))
+	assert.Equal([]string{"cvt1"}, g.Dependents("lt1"))
+	assert.Equal([]string{"cvt1", "lt1", "lt2"}, g.Dependents("lt1", "threads"))
+	assert.Equal([]string{}, g.Dependents("cvt1"))
+}
+
+func TestGraphSubgraph(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	g := queryGraph()
+	sub := g.Subgraph([]string{"boot", "lt1", "threads", "nosuch"})
+
+	assert.Equal(3, len(sub.NodeMap))
+	assert.Equal([]string{"boot", "threads"}, sub.NodeMap["lt1"].sortedEdgesOut())
+	assert.Equal(0, len(sub.NodeMap["boot"].EdgesOut))
+	assert.Equal(2, len(sub.NodeMap["boot"].EdgesIn))
+
+	// The original is unchanged
+	assert.Equal(6, len(g.NodeMap))
+}
+
+func TestGraphTransitiveReduction(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	g := queryGraph()
+	reduced, err := g.TransitiveReduction()
+	assert.Nil(err)
+	if reduced == nil {
+		t.FailNow()
+	}
+
+	assert.Equal([]string{"lt1", "lt2"}, reduced.NodeMap["cvt1"].sortedEdgesOut())
+	assert.Equal([]string{"threads"}, reduced.NodeMap["lt1"].sortedEdgesOut())
+	assert.Equal([]string{"boot"}, reduced.NodeMap["shell"].sortedEdgesOut())
+	assert.Equal(0, len(reduced.NodeMap["cvt1"].EdgesIn))
+
+	// Reachability is the same
+	for name := range g.NodeMap {
+		assert.Equal(g.Dependencies(name), reduced.Dependencies(name))
+	}
+
+	// The original still has its edges
+	assert.Equal(3, len(g.NodeMap["cvt1"].EdgesOut))
+
+	// Cycles
+	g.AddEdge(StringNode("boot"), StringNode("cvt1"))
+	_, err = g.TransitiveReduction()
+	assert.NotNil(err)
+}
+
+func TestGraphLowestCommonDependencies(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	g := queryGraph()
+
+	assert.Equal([]string{"threads"}, g.LowestCommonDependencies("lt1", "lt2"))
+	assert.Equal([]string{"boot"}, g.LowestCommonDependencies("lt1", "shell"))
+	assert.Equal([]string{"lt1"}, g.LowestCommonDependencies("lt1", "cvt1"))
+	assert.Equal([]string{"boot"}, g.LowestCommonDependencies("cvt1", "lt2", "shell"))
+	assert.Equal([]string{"lt2"}, g.LowestCommonDependencies("lt2"))
+	assert.Equal([]string{}, g.LowestCommonDependencies())
+	assert.Equal([]string{}, g.LowestCommonDependencies("lt1", "nosuch"))
+
+	// Nothing in common
+	g.AddNode(StringNode("other"))
+	assert.Equal([]string{}, g.LowestCommonDependencies("lt1", "other"))
+}
@@ -12,11 +12,20 @@ import (
 )
 
 // GroupConfig specifies how a group of tests should be created and run.
+// Tests are test expressions, e.g. "sync/*.t", "boot" or "sync && !slow".
 type GroupConfig struct {
 	Name    string           `json:"name"`
 	UseDeps bool             `json:"usedeps"`
 	Tests   []string         `json:"tests"`
 	Env     *TestEnvironment `json:"-" bson:"-"`
+
+	// Scheduling options for the test manager's queue. Tests from groups
+	// with different owners share the manager's capacity fairly.
+	Priority PriorityClass `json:"priority"`
+	Owner    string        `json:"owner"`
+
+	// The part of the group to run, if it's being split across machines.
+	Shard Shard `json:"shard"`
 }
 
 // A group of tests to be run, which is the result of expanding a GroupConfig.
@@ -42,12 +51,17 @@ type testMap struct {
 	TestDir string
 	Tests   map[string]*Test
 	Tags    TagMap
+
+	// File id -> tests. Test files that declare a parameter matrix expand to
+	// more than one test.
+	Files map[string][]*Test
 }
 
-// Result type for loading a test from a file
+// Result type for loading the tests from a file
 type testLoadResult struct {
-	Test *Test
-	Err  error
+	FileID string
+	Tests  []*Test
+	Err    error
 }
 
 func newTestMap(testDir string) (*testMap, []error) {
@@ -56,7 +70,7 @@ func newTestMap(testDir string) (*testMap, []error) {
 		return nil, []error{err}
 	}
 	abs = path.Clean(abs)
-	tm := &testMap{abs, make(map[string]*Test), make(TagMap)}
+	tm := &testMap{abs, make(map[string]*Test), make(TagMap), make(map[string][]*Test)}
 	errs := tm.load()
 	if len(errs) > 0 {
 		return nil, errs
@@ -77,6 +91,25 @@ func idFromFile(filename, testDir string) (string, error) {
 	}
 }
 
+// Check whether a test expression refers to test files, as opposed to a tag.
+// File expressions end in .t, optionally followed by a matrix selector, e.g.
+// sync/lt1.t[cpus=1].
+func isTestFileExpr(expr string) bool {
+	glob, _ := splitMatrixSelector(expr)
+	return strings.HasSuffix(glob, ".t")
+}
+
+// Split a test expression into its file glob and matrix selector (the text
+// between the brackets). The selector is empty if there isn't one.
+func splitMatrixSelector(expr string) (string, string) {
+	if strings.HasSuffix(expr, "]") {
+		if pos := strings.LastIndex(expr, ".t["); pos >= 0 {
+			return expr[:pos+2], expr[pos+3 : len(expr)-1]
+		}
+	}
+	return expr, ""
+}
+
 // Creates a mapping of tag -> []test
 func (tm *testMap) buildTagMap() {
 	tm.Tags = make(TagMap)
@@ -105,15 +138,22 @@ func (tm *testMap) load() []error {
 	}
 
 	resChan := make(chan testLoadResult)
+	loader := newTestLoader(tm.TestDir)
 
 	// Spawn a bunch of workers to load the tests
 	for _, file := range files {
 		go func(f string) {
-			test, err := TestFromFile(f)
-			if err == nil {
-				test.DependencyID, err = idFromFile(f, tm.TestDir)
+			res := testLoadResult{}
+			res.Tests, res.Err = loader.testsFromFile(f)
+			if res.Err == nil {
+				res.FileID, res.Err = idFromFile(f, tm.TestDir)
+			}
+			if res.Err == nil {
+				// Matrix instances are distinguished by their parameters
+				for _, test := range res.Tests {
+					test.DependencyID = res.FileID + test.ParamLabel()
+				}
 			}
-			res := testLoadResult{test, err}
 			resChan <- res
 		}(file)
 	}
@@ -124,7 +164,10 @@ func (tm *testMap) load() []error {
 		if res.Err != nil {
 			errs = append(errs, res.Err)
 		} else {
-			tm.Tests[res.Test.DependencyID] = res.Test
+			tm.Files[res.FileID] = res.Tests
+			for _, test := range res.Tests {
+				tm.Tests[test.DependencyID] = test
+			}
 		}
 	}
 
@@ -132,10 +175,12 @@ func (tm *testMap) load() []error {
 }
 
 // Get a slice of tests from a single search expression, which can be a glob
-// or single file.
+// or single file, optionally followed by a matrix selector.
 func (tm *testMap) testsFromGlob(search, startDir string) ([]*Test, error) {
 	var glob string
 
+	search, selector := splitMatrixSelector(search)
+
 	if strings.HasPrefix(search, "/") {
 		// Relative to the test directory
 		glob = path.Join(tm.TestDir, search)
@@ -170,28 +215,92 @@ func (tm *testMap) testsFromGlob(search, startDir string) ([]*Test, error) {
 		if id, err := idFromFile(file, tm.TestDir); err != nil {
 			return nil, err
 		} else {
-			if test, ok := tm.Tests[id]; ok {
-				tests = append(tests, test)
+			if instances, ok := tm.Files[id]; ok {
+				for _, test := range instances {
+					if len(selector) == 0 {
+						tests = append(tests, test)
+					} else if match, err := test.matchesParams(selector); err != nil {
+						return nil, err
+					} else if match {
+						tests = append(tests, test)
+					}
+				}
 			} else {
 				return nil,
 					errors.New(fmt.Sprintf("Cannot find test: %v.  Is testMap initialized?", id))
 			}
 		}
 	}
+
+	if len(tests) == 0 {
+		return nil, fmt.Errorf("Cannot find a matrix instance matching [%v] for glob: %v", selector, glob)
+	}
+
 	return tests, nil
 }
 
+// DependencyKind determines what happens to a test when one of its
+// dependencies doesn't pass.
+type DependencyKind string
+
+const (
+	DEP_HARD  DependencyKind = "hard"  // Skip the test (default)
+	DEP_ORDER DependencyKind = "order" // Run the test after the dependency, regardless of outcome
+	DEP_WEAK  DependencyKind = "weak"  // Run the test, but flag it as having a failed prerequisite
+)
+
+// How strong each kind is, for when a test is matched by more than one
+// depends entry.
+var depKindStrength = map[DependencyKind]int{
+	DEP_ORDER: 0,
+	DEP_WEAK:  1,
+	DEP_HARD:  2,
+}
+
+// Split a depends entry into its kind and test expression. The kind is an
+// optional prefix, e.g. weak:sync/lt1.t or order:threads.
+func splitDependencyKind(dep string) (DependencyKind, string, error) {
+	pos := strings.Index(dep, ":")
+	if pos < 0 {
+		return DEP_HARD, dep, nil
+	}
+
+	kind := DependencyKind(strings.TrimSpace(dep[:pos]))
+	if _, ok := depKindStrength[kind]; !ok {
+		return "", "", fmt.Errorf("Invalid dependency kind '%v' in '%v'. Must be one of (hard, order, weak)",
+			kind, dep)
+	}
+	return kind, strings.TrimSpace(dep[pos+1:]), nil
+}
+
+// DependencyKind returns the kind of dependency this test has on the test with
+// the given id, which must be one of its ExpandedDeps.
+func (t *Test) DependencyKind(id string) DependencyKind {
+	if kind, ok := t.depKinds[id]; ok {
+		return kind
+	}
+	return DEP_HARD
+}
+
 // Expand the dependencies for a single test
 func (t *Test) expandTestDeps(tests *testMap, done chan error) {
 
 	t.ExpandedDeps = make(map[string]*Test)
+	t.depSources = make(map[string]string)
+	t.depKinds = make(map[string]DependencyKind)
 
-	for _, dep := range t.Depends {
+	for _, entry := range t.Depends {
 		var deps []*Test = nil
 		var ok bool = false
 		var err error = nil
 
-		if strings.HasSuffix(dep, ".t") {
+		kind, dep, err := splitDependencyKind(entry)
+		if err != nil {
+			done <- fmt.Errorf("%v (test %v)", err, t.DependencyID)
+			return
+		}
+
+		if isTestFileExpr(dep) {
 			// it's a file/glob
 			startDir := path.Dir(path.Join(tests.TestDir, t.DependencyID))
 			if deps, err = tests.testsFromGlob(dep, startDir); err != nil {
@@ -215,6 +324,14 @@ func (t *Test) expandTestDeps(tests *testMap, done chan error) {
 		if deps != nil {
 			for _, d := range deps {
 				t.ExpandedDeps[d.DependencyID] = d
+				if _, ok := t.depSources[d.DependencyID]; !ok {
+					t.depSources[d.DependencyID] = entry
+				}
+				// The strongest kind wins
+				if prev, ok := t.depKinds[d.DependencyID]; !ok ||
+					depKindStrength[kind] > depKindStrength[prev] {
+					t.depKinds[d.DependencyID] = kind
+				}
 			}
 		}
 	}
@@ -243,6 +360,78 @@ func (tm *testMap) expandAllDeps() []error {
 	return errors
 }
 
+// DependencyEdge is a dependency between two tests, along with where it was
+// declared.
+type DependencyEdge struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	File    string `json:"file"`    // The .t file that declared the dependency
+	Depends string `json:"depends"` // The depends entry that matched To
+}
+
+// DependencyCycle is a cycle in the test dependency graph. Each test depends
+// on the next, and the last test depends on the first.
+type DependencyCycle struct {
+	Tests []string          `json:"tests"`
+	Edges []*DependencyEdge `json:"edges"`
+}
+
+func (c *DependencyCycle) Error() string {
+	lines := []string{"Dependency cycle: " + graph.CyclePath(c.Tests)}
+	for _, e := range c.Edges {
+		lines = append(lines, fmt.Sprintf("    %v -> %v: depends '%v' in %v",
+			e.From, e.To, e.Depends, e.File))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Get the id of the file a test was loaded from, which differs from the
+// DependencyID for matrix instances.
+func (t *Test) fileID() string {
+	return strings.TrimSuffix(t.DependencyID, t.ParamLabel())
+}
+
+// Convert the graph cycles into DependencyCycles, one error per cycle.
+func (tm *testMap) cycleErrors(cerr *graph.CycleError) []error {
+	errs := make([]error, 0, len(cerr.Cycles))
+	for _, cycle := range tm.dependencyCycles(cerr) {
+		errs = append(errs, cycle)
+	}
+	return errs
+}
+
+// Describe the edges of each cycle found in the dependency graph.
+func (tm *testMap) dependencyCycles(cerr *graph.CycleError) []*DependencyCycle {
+	cycles := make([]*DependencyCycle, 0, len(cerr.Cycles))
+
+	for _, ids := range cerr.Cycles {
+		cycle := &DependencyCycle{
+			Tests: ids,
+			Edges: make([]*DependencyEdge, 0, len(ids)),
+		}
+		for i, id := range ids {
+			to := ids[(i+1)%len(ids)]
+			edge := &DependencyEdge{From: id, To: to, File: id}
+			if test, ok := tm.Tests[id]; ok {
+				edge.File = test.fileID()
+				edge.Depends = test.depSources[to]
+			}
+			cycle.Edges = append(cycle.Edges, edge)
+		}
+		cycles = append(cycles, cycle)
+	}
+
+	return cycles
+}
+
+// Cancel all of the tests in the group. Running tests are stopped and the
+// rest abort as soon as they start, so the group's runner finishes quickly.
+func (tg *TestGroup) Cancel() {
+	for _, t := range tg.Tests {
+		t.Cancel()
+	}
+}
+
 // Keyer interface for the dependency graph
 func (t *Test) Key() string {
 	return t.DependencyID
@@ -318,17 +507,9 @@ func (tg *TestGroup) expandTests(tm *testMap) []error {
 	// Spawn some workers to expand the tests
 	for _, t := range tg.Config.Tests {
 		go func(test string) {
-			var tests []*Test = nil
-			var err error = nil
-			if strings.HasSuffix(test, ".t") {
-				tests, err = tm.testsFromGlob(test, tg.Config.Env.TestDir)
-			} else {
-				if res, ok := tm.Tags[test]; ok {
-					tests = res
-				} else {
-					err = errors.New(fmt.Sprintf("Cannot find tag: %v", test))
-				}
-			}
+			// Each entry is a test expression (see tagexpr.go), which may
+			// just be a single tag or glob.
+			tests, err := tm.testsFromExpr(test, tg.Config.Env.TestDir)
 			resChan <- &expandRes{err, tests}
 		}(t)
 	}
@@ -405,6 +586,9 @@ func GroupFromConfig(config *GroupConfig) (*TestGroup, []error) {
 
 	// If we're not using depepndencies, we're done.
 	if !config.UseDeps {
+		if err := tg.ApplyShard(config.Shard); err != nil {
+			return nil, []error{err}
+		}
 		return tg, nil
 	}
 
@@ -421,6 +605,9 @@ func GroupFromConfig(config *GroupConfig) (*TestGroup, []error) {
 
 	// topsort returns an error if there's a cycle
 	if _, err := g.TopSort(); err != nil {
+		if cerr, ok := err.(*graph.CycleError); ok {
+			return nil, tm.cycleErrors(cerr)
+		}
 		return nil, []error{err}
 	}
 
@@ -441,6 +628,10 @@ func GroupFromConfig(config *GroupConfig) (*TestGroup, []error) {
 		}
 	}
 
+	if err := tg.ApplyShard(config.Shard); err != nil {
+		return nil, []error{err}
+	}
+
 	return tg, nil
 }
 
@@ -282,6 +282,50 @@ func TestDependencyCycle(t *testing.T) {
 	assert.NotNil(err)
 }
 
+func TestDependencyCycleReport(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	env := defaultEnv.CopyEnvironment()
+	env.TestDir = CYCLE_DIR
+
+	config := &GroupConfig{
+		Name:    "Test",
+		UseDeps: true,
+		Tests:   []string{"boot.t"},
+		Env:     env,
+	}
+
+	tg, errs := GroupFromConfig(config)
+	assert.Nil(tg)
+	assert.Equal(12, len(errs))
+
+	for _, err := range errs {
+		cycle, ok := err.(*DependencyCycle)
+		assert.True(ok)
+		if !ok {
+			continue
+		}
+		assert.Equal(len(cycle.Tests), len(cycle.Edges))
+		for i, e := range cycle.Edges {
+			assert.Equal(cycle.Tests[i], e.From)
+			assert.Equal(cycle.Tests[(i+1)%len(cycle.Tests)], e.To)
+			assert.Equal(e.From, e.File)
+			assert.NotEqual("", e.Depends)
+		}
+	}
+
+	if len(errs) > 0 {
+		cycle := errs[len(errs)-1].(*DependencyCycle)
+		assert.Equal([]string{"boot.t", "sync/sy4.t", "threads/tt3.t"}, cycle.Tests)
+		expected := "Dependency cycle: boot.t -> sync/sy4.t -> threads/tt3.t -> boot.t\n" +
+			"    boot.t -> sync/sy4.t: depends '/sync/sy4.t' in boot.t\n" +
+			"    sync/sy4.t -> threads/tt3.t: depends 'threads' in sync/sy4.t\n" +
+			"    threads/tt3.t -> boot.t: depends '/boot.t' in threads/tt3.t"
+		assert.Equal(expected, cycle.Error())
+	}
+}
+
 func TestGroupFromConfg(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -354,3 +398,188 @@ func TestGroupConfigInvalid(t *testing.T) {
 	t.Log(errs)
 	assert.Nil(tg)
 }
+
+const MATRIX_DIR string = "fixtures/tests/matrix"
+
+func TestTestMapMatrix(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	tm, errs := newTestMap(MATRIX_DIR)
+	assert.NotNil(tm)
+	assert.Equal(0, len(errs))
+
+	expected := []string{
+		"boot.t",
+		"sync/cvt1.t",
+		"sync/lt1.t[sys161.cpus=1,sys161.ram=1M]",
+		"sync/lt1.t[sys161.cpus=1,sys161.ram=2M]",
+		"sync/lt1.t[sys161.cpus=8,sys161.ram=1M]",
+		"sync/lt1.t[sys161.cpus=8,sys161.ram=2M]",
+	}
+
+	assert.Equal(len(expected), len(tm.Tests))
+	for _, id := range expected {
+		test, ok := tm.Tests[id]
+		assert.True(ok)
+		if ok {
+			assert.Equal(id, test.DependencyID)
+		}
+	}
+
+	// Tags include every instance
+	assert.Equal(4, len(tm.Tags["locks"]))
+
+	abs, err := filepath.Abs(MATRIX_DIR)
+	assert.Nil(err)
+
+	// The file expands to every instance
+	tests, err := tm.testsFromGlob("sync/lt1.t", abs)
+	assert.Nil(err)
+	assert.Equal(4, len(tests))
+
+	// Selectors can be partial
+	tests, err = tm.testsFromGlob("sync/lt1.t[sys161.ram=2M]", abs)
+	assert.Nil(err)
+	assert.Equal([]string{
+		"sync/lt1.t[sys161.cpus=1,sys161.ram=2M]",
+		"sync/lt1.t[sys161.cpus=8,sys161.ram=2M]",
+	}, testsToSortedSlice(tests))
+
+	tests, err = tm.testsFromGlob("sync/lt1.t[sys161.cpus=1,sys161.ram=1M]", abs)
+	assert.Nil(err)
+	assert.Equal(1, len(tests))
+
+	_, err = tm.testsFromGlob("sync/lt1.t[sys161.cpus=2]", abs)
+	assert.NotNil(err)
+	_, err = tm.testsFromGlob("sync/lt1.t[cpus]", abs)
+	assert.NotNil(err)
+
+	// Dependencies work on the expanded IDs
+	errs = tm.expandAllDeps()
+	assert.Equal(0, len(errs))
+	assert.Equal([]string{
+		"sync/lt1.t[sys161.cpus=1,sys161.ram=1M]",
+		"sync/lt1.t[sys161.cpus=1,sys161.ram=2M]",
+	}, testsToSortedSlice(depsToSlice(tm.Tests["sync/cvt1.t"])))
+
+	// Groups and target-style references
+	env := defaultEnv.CopyEnvironment()
+	env.TestDir = MATRIX_DIR
+	config := &GroupConfig{
+		Name:    "Test",
+		UseDeps: true,
+		Tests:   []string{"sync/lt1.t[sys161.cpus=8,sys161.ram=1M]"},
+		Env:     env,
+	}
+	tg, errs := GroupFromConfig(config)
+	assert.Equal(0, len(errs))
+	if tg != nil {
+		assert.Equal(2, len(tg.Tests))
+		_, ok := tg.Tests["sync/lt1.t[sys161.cpus=8,sys161.ram=1M]"]
+		assert.True(ok)
+		_, ok = tg.Tests["boot.t"]
+		assert.True(ok)
+	}
+}
+
+func depsToSlice(test *Test) []*Test {
+	res := make([]*Test, 0, len(test.ExpandedDeps))
+	for _, dep := range test.ExpandedDeps {
+		res = append(res, dep)
+	}
+	return res
+}
+
+func TestTestMapInherit(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	tm, errs := newTestMap("fixtures/tests/inherit")
+	assert.NotNil(tm)
+	assert.Equal(0, len(errs))
+	if tm == nil {
+		t.Log(errs)
+		t.FailNow()
+	}
+
+	// boot.t extends base, which extends slow
+	boot := tm.Tests["boot.t"]
+	assert.Equal([]string{"base", "slow"}, boot.InheritedFrom())
+	assert.Equal("2M", boot.Sys161.RAM)
+	assert.Equal(uint(100), boot.Stat.Window)
+	assert.Equal(float32(120.0), boot.Misc.PromptTimeout)
+	assert.Equal(float32(300.0), boot.Monitor.CommandTimeout)
+
+	// lt1 overrides some of boot's configuration
+	lt1 := tm.Tests["sync/lt1.t"]
+	assert.Equal([]string{"boot.t", "base", "slow"}, lt1.InheritedFrom())
+	assert.Equal(uint(1), lt1.Sys161.CPUs)
+	assert.Equal("2M", lt1.Sys161.RAM)
+	assert.Equal(float32(30.0), lt1.Misc.PromptTimeout)
+	assert.Equal(float32(300.0), lt1.Monitor.CommandTimeout)
+	assert.Equal("lt1", lt1.Commands[1].Input.Line)
+
+	// lt2 has no commands, so it inherits lt1's along with its configuration
+	lt2 := tm.Tests["sync/lt2.t"]
+	assert.Equal([]string{"sync/lt1.t", "boot.t", "base", "slow"}, lt2.InheritedFrom())
+	assert.Equal(uint(1), lt2.Sys161.CPUs)
+	assert.Equal(3, len(lt2.Commands))
+	if len(lt2.Commands) == 3 {
+		assert.Equal("lt1", lt2.Commands[1].Input.Line)
+	}
+
+	// Metadata is not inherited
+	assert.Equal("lock_test_2", lt2.Name)
+	assert.Equal(0, len(lt2.Tags))
+
+	// Loops
+	tm, errs = newTestMap("fixtures/tests/inheritloop")
+	assert.Nil(tm)
+	assert.Equal(3, len(errs))
+	for _, err := range errs {
+		assert.Contains(err.Error(), "Inheritance loop")
+		t.Log(err)
+	}
+}
+
+func TestDependencyKinds(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	valid := map[string][]string{
+		"boot.t":          {"hard", "boot.t"},
+		"hard:boot.t":     {"hard", "boot.t"},
+		"order:threads":   {"order", "threads"},
+		"weak: /sync/*.t": {"weak", "/sync/*.t"},
+	}
+	for dep, expected := range valid {
+		kind, expr, err := splitDependencyKind(dep)
+		assert.Nil(err)
+		assert.Equal(expected, []string{string(kind), expr})
+	}
+
+	_, _, err := splitDependencyKind("soft:boot.t")
+	assert.NotNil(err)
+
+	tm, errs := newTestMap("fixtures/tests/depkinds")
+	assert.Equal(0, len(errs))
+	if tm == nil {
+		t.FailNow()
+	}
+	assert.Equal(0, len(tm.expandAllDeps()))
+
+	kinds := func(id string) map[string]DependencyKind {
+		res := make(map[string]DependencyKind)
+		for dep := range tm.Tests[id].ExpandedDeps {
+			res[dep] = tm.Tests[id].DependencyKind(dep)
+		}
+		return res
+	}
+
+	assert.Equal(map[string]DependencyKind{"boot.t": DEP_HARD}, kinds("lt1.t"))
+	assert.Equal(map[string]DependencyKind{"boot.t": DEP_ORDER, "lt1.t": DEP_WEAK}, kinds("cvt1.t"))
+	assert.Equal(map[string]DependencyKind{
+		"boot.t": DEP_HARD, "lt1.t": DEP_WEAK, "cvt1.t": DEP_ORDER,
+	}, kinds("cvt2.t"))
+}
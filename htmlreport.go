@@ -0,0 +1,361 @@
+package test161
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// HTMLReporter renders a TestGroup as a single static HTML page, using
+// TestGroup.OutputHTML.
+type HTMLReporter struct{}
+
+func (r *HTMLReporter) Report(w io.Writer, tg *TestGroup) error {
+	return tg.OutputHTML(w)
+}
+
+// The size of the instruction mix charts, in pixels
+const (
+	HTML_CHART_WIDTH  = 600
+	HTML_CHART_HEIGHT = 120
+)
+
+// One stat sample in an instruction mix chart. The bars are stacked, kernel
+// instructions on the bottom, then user, then idle.
+type htmlBar struct {
+	X, Width         float64
+	KernelY, KernelH float64
+	UserY, UserH     float64
+	IdleY, IdleH     float64
+	Title            string
+}
+
+type htmlChart struct {
+	Width, Height int
+	Bars          []*htmlBar
+	Kernel, User  uint64
+	Idle          uint64
+}
+
+type htmlCommand struct {
+	Index    int
+	Line     string
+	Status   string
+	Points   string
+	SimTime  TimeFixedPoint
+	WallTime TimeFixedPoint
+	Open     bool
+	Output   []*OutputLine
+	Expected []*htmlExpected
+	Diff     string
+	Chart    *htmlChart
+}
+
+// An expected output line and how it was matched, if the command failed
+type htmlExpected struct {
+	*ExpectedOutputLine
+	Match   string
+	Missing bool
+}
+
+type htmlTest struct {
+	ID           string
+	Name         string
+	Description  string
+	Result       TestResult
+	Reason       string
+	Cached       bool
+	IsDependency bool
+	Score        string
+	Leak         string
+	SimTime      TimeFixedPoint
+	WallTime     TimeFixedPoint
+	Status       []Status
+	Commands     []*htmlCommand
+}
+
+type htmlScore struct {
+	Target        string
+	Earned, Avail uint
+}
+
+type htmlReport struct {
+	Name      string
+	Generated string
+	Totals    map[string]int
+	Total     int
+	Scores    []*htmlScore
+	Tests     []*htmlTest
+}
+
+// Chart the kernel, user and idle instructions for each of a command's stat
+// samples. Returns nil if there aren't any.
+func newHTMLChart(stats []Stat) *htmlChart {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	chart := &htmlChart{
+		Width:  HTML_CHART_WIDTH,
+		Height: HTML_CHART_HEIGHT,
+	}
+
+	max := uint64(0)
+	for _, s := range stats {
+		total := uint64(s.Kinsns) + uint64(s.Uinsns) + uint64(s.Idle)
+		if total > max {
+			max = total
+		}
+		chart.Kernel += uint64(s.Kinsns)
+		chart.User += uint64(s.Uinsns)
+		chart.Idle += uint64(s.Idle)
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	width := float64(chart.Width) / float64(len(stats))
+	scale := float64(chart.Height) / float64(max)
+	for i, s := range stats {
+		bar := &htmlBar{
+			X:       float64(i) * width,
+			Width:   width,
+			KernelH: float64(s.Kinsns) * scale,
+			UserH:   float64(s.Uinsns) * scale,
+			IdleH:   float64(s.Idle) * scale,
+			Title: fmt.Sprintf("%.6f-%.6f: %v kernel, %v user, %v idle",
+				s.Start, s.End, s.Kinsns, s.Uinsns, s.Idle),
+		}
+		bar.KernelY = float64(chart.Height) - bar.KernelH
+		bar.UserY = bar.KernelY - bar.UserH
+		bar.IdleY = bar.UserY - bar.IdleH
+		chart.Bars = append(chart.Bars, bar)
+	}
+
+	return chart
+}
+
+func newHTMLTest(test *Test) *htmlTest {
+	ht := &htmlTest{
+		ID:           test.DependencyID,
+		Name:         test.Name,
+		Description:  test.Description,
+		Result:       test.Result,
+		Cached:       test.Cached,
+		IsDependency: test.IsDependency,
+		SimTime:      test.SimTime,
+		WallTime:     test.WallTime,
+		Status:       test.Status,
+		Leak:         "---",
+	}
+	if test.Result != TEST_RESULT_CORRECT {
+		ht.Reason = reportReason(test)
+	}
+	if test.PointsAvailable > 0 {
+		ht.Score = fmt.Sprintf("%v/%v", test.PointsEarned, test.PointsAvailable)
+	}
+	if test.MemLeakChecked {
+		if test.MemLeakBytes == 0 {
+			ht.Leak = "None"
+		} else {
+			ht.Leak = fmt.Sprintf("%v bytes", test.MemLeakBytes)
+		}
+	}
+
+	for i, cmd := range test.Commands {
+		hc := &htmlCommand{
+			Index:    i + 1,
+			Line:     cmd.Input.Line,
+			Status:   cmd.Status,
+			SimTime:  cmd.Input.SimTime,
+			WallTime: cmd.Input.WallTime,
+			Open:     cmd.Status == COMMAND_STATUS_INCORRECT,
+			Output:   cmd.Output,
+			Diff:     cmd.Diff,
+			Chart:    newHTMLChart(cmd.AllStats),
+		}
+		for j, expected := range cmd.ExpectedOutput {
+			he := &htmlExpected{ExpectedOutputLine: expected}
+			if j < len(cmd.Matches) {
+				if m := cmd.Matches[j]; m.Line >= 0 {
+					he.Match = fmt.Sprintf("output line %v", m.Line+1)
+				} else {
+					he.Match = m.Reason
+					he.Missing = true
+				}
+			}
+			hc.Expected = append(hc.Expected, he)
+		}
+		if cmd.PointsAvailable > 0 {
+			hc.Points = fmt.Sprintf("%v/%v", cmd.PointsEarned, cmd.PointsAvailable)
+		}
+		ht.Commands = append(ht.Commands, hc)
+	}
+
+	return ht
+}
+
+// OutputHTML renders the group's results as a self-contained HTML page: the
+// results table, and for each test its statuses and a collapsible transcript
+// of each command, with the expected output and a chart of the instruction
+// mix.
+func (tg *TestGroup) OutputHTML(w io.Writer) error {
+	report := &htmlReport{
+		Generated: time.Now().Format(time.RFC1123),
+		Totals:    make(map[string]int),
+		Total:     len(tg.Tests),
+	}
+	if tg.Config != nil {
+		report.Name = tg.Config.Name
+	}
+
+	tests := make([]*Test, 0, len(tg.Tests))
+	for _, test := range tg.Tests {
+		tests = append(tests, test)
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		return tests[i].DependencyID < tests[j].DependencyID
+	})
+
+	scores := make(map[string]*htmlScore)
+	for _, test := range tests {
+		report.Tests = append(report.Tests, newHTMLTest(test))
+		report.Totals[string(test.Result)] += 1
+
+		if len(test.TargetName) > 0 {
+			score, ok := scores[test.TargetName]
+			if !ok {
+				score = &htmlScore{Target: test.TargetName}
+				scores[test.TargetName] = score
+				report.Scores = append(report.Scores, score)
+			}
+			score.Earned += test.PointsEarned
+			score.Avail += test.PointsAvailable
+		}
+	}
+	sort.Slice(report.Scores, func(i, j int) bool {
+		return report.Scores[i].Target < report.Scores[j].Target
+	})
+
+	return htmlReportTemplate.Execute(w, report)
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time": func(t TimeFixedPoint) string {
+		return fmt.Sprintf("%.6f", t)
+	},
+	"coord": func(f float64) string {
+		return fmt.Sprintf("%.2f", f)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>test161: {{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { padding: 0.2em 0.8em; text-align: left; vertical-align: top; }
+th { border-bottom: 1px solid #888; }
+td.num { text-align: right; }
+pre, .mono { font-family: monospace; }
+pre { margin: 0; white-space: pre-wrap; }
+.correct { color: #1a7f1a; }
+.incorrect { color: #c0241c; }
+.skip, .abort, .none, .running { color: #2456b0; }
+.test { margin-top: 2em; border-top: 1px solid #ccc; }
+.transcript td { padding: 0 0.8em; }
+.time { color: #888; }
+details { margin: 0.4em 0; }
+summary { cursor: pointer; }
+.legend span { display: inline-block; width: 0.8em; height: 0.8em; margin: 0 0.3em 0 1em; }
+.kernel { fill: #c0241c; background: #c0241c; }
+.user { fill: #2456b0; background: #2456b0; }
+.idle { fill: #ccc; background: #ccc; }
+</style>
+</head>
+<body>
+<h1>test161: {{.Name}}</h1>
+<p>Generated {{.Generated}}</p>
+
+<table>
+<tr><th>Test</th><th>Result</th><th>Memory Leaks</th><th>Score</th></tr>
+{{- range .Tests}}
+<tr>
+<td><a href="#{{.ID}}">{{.ID}}</a>{{if .IsDependency}} (dependency){{end}}</td>
+<td class="{{.Result}}">{{.Result}}{{if .Reason}} ({{.Reason}}){{end}}{{if .Cached}} (cached){{end}}</td>
+<td>{{.Leak}}</td>
+<td class="num">{{.Score}}</td>
+</tr>
+{{- end}}
+</table>
+
+<p>
+{{- with index .Totals "correct"}}Correct: {{.}}/{{$.Total}} {{end}}
+{{- with index .Totals "incorrect"}}Incorrect: {{.}}/{{$.Total}} {{end}}
+{{- with index .Totals "skip"}}Skipped: {{.}}/{{$.Total}} {{end}}
+{{- with index .Totals "abort"}}Aborted: {{.}}/{{$.Total}}{{end}}
+</p>
+{{- range .Scores}}
+<p><b>{{.Target}} Score: {{.Earned}}/{{.Avail}}</b></p>
+{{- end}}
+
+{{- range .Tests}}
+<div class="test" id="{{.ID}}">
+<h2>{{.ID}} <span class="{{.Result}}">{{.Result}}</span></h2>
+<p>{{.Name}}{{if .Description}}: {{.Description}}{{end}}</p>
+<p>Sim time: {{time .SimTime}} s, wall time: {{time .WallTime}} s{{if .Score}}, score: {{.Score}}{{end}}, memory leaks: {{.Leak}}</p>
+{{- if .Status}}
+<h3>Status</h3>
+<table class="mono">
+<tr><th>Sim</th><th>Wall</th><th>Status</th><th>Message</th></tr>
+{{- range .Status}}
+<tr><td class="time">{{time .SimTime}}</td><td class="time">{{time .WallTime}}</td><td>{{.Status}}</td><td>{{.Message}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- range .Commands}}
+<details{{if .Open}} open{{end}}>
+<summary><span class="mono">{{.Index}}. {{.Line}}</span> <span class="{{.Status}}">{{.Status}}</span>{{if .Points}} ({{.Points}}){{end}}</summary>
+<table class="transcript mono">
+<tr><th>Sim</th><th>Wall</th><th>Output</th></tr>
+<tr><td class="time">{{time .SimTime}}</td><td class="time">{{time .WallTime}}</td><td><pre><b>{{.Line}}</b></pre></td></tr>
+{{- range .Output}}
+<tr><td class="time">{{time .SimTime}}</td><td class="time">{{time .WallTime}}</td><td><pre>{{.Line}}</pre></td></tr>
+{{- end}}
+</table>
+{{- if .Expected}}
+<h4>Expected output</h4>
+<table class="mono">
+<tr><th>Text</th><th>Trusted</th><th>Key</th><th>Match</th></tr>
+{{- range .Expected}}
+<tr><td><pre>{{.Text}}</pre></td><td>{{.Trusted}}</td><td>{{.KeyName}}</td><td{{if .Missing}} class="incorrect"{{end}}>{{.Match}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Diff}}
+<h4>Expected vs. actual output</h4>
+<pre>{{.Diff}}</pre>
+{{- end}}
+{{- with .Chart}}
+<h4>Instruction mix</h4>
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+{{- range .Bars}}
+<g><title>{{.Title}}</title>
+<rect class="kernel" x="{{coord .X}}" y="{{coord .KernelY}}" width="{{coord .Width}}" height="{{coord .KernelH}}"/>
+<rect class="user" x="{{coord .X}}" y="{{coord .UserY}}" width="{{coord .Width}}" height="{{coord .UserH}}"/>
+<rect class="idle" x="{{coord .X}}" y="{{coord .IdleY}}" width="{{coord .Width}}" height="{{coord .IdleH}}"/>
+</g>
+{{- end}}
+</svg>
+<div class="legend"><span class="kernel"></span>kernel {{.Kernel}}<span class="user"></span>user {{.User}}<span class="idle"></span>idle {{.Idle}}</div>
+{{- end}}
+</details>
+{{- end}}
+</div>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,66 @@
+package test161
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTMLChart(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	assert.Nil(newHTMLChart(nil))
+
+	chart := newHTMLChart([]Stat{
+		{Kinsns: 100, Uinsns: 300},
+		{Kinsns: 50, Idle: 50},
+	})
+	assert.Equal(uint64(150), chart.Kernel)
+	assert.Equal(uint64(300), chart.User)
+	assert.Equal(uint64(50), chart.Idle)
+	if assert.Equal(2, len(chart.Bars)) {
+		bar := chart.Bars[0]
+		assert.Equal(float64(HTML_CHART_WIDTH/2), bar.Width)
+		assert.Equal(float64(HTML_CHART_HEIGHT)/4, bar.KernelH)
+		assert.Equal(float64(0), bar.IdleY)
+		bar = chart.Bars[1]
+		assert.Equal(float64(HTML_CHART_WIDTH/2), bar.X)
+		assert.Equal(float64(HTML_CHART_HEIGHT)*3/4, bar.IdleY)
+	}
+}
+
+func TestHTMLReport(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	tg := reportGroup(t)
+	cmd := tg.Tests["sync/lt1.t"].Commands[1]
+	cmd.AllStats = []Stat{{Kinsns: 100, Uinsns: 300}}
+	cmd.ExpectedOutput = []*ExpectedOutputLine{{Text: "lt1: SUCCESS <done>", Trusted: true, KeyName: "lt1"}}
+	tg.Tests["sync/sem1.t"].MemLeakChecked = true
+	tg.Tests["sync/sem1.t"].MemLeakBytes = 64
+
+	var buf bytes.Buffer
+	assert.Nil(tg.OutputHTML(&buf))
+	html := buf.String()
+
+	assert.Contains(html, "<title>test161: asst1</title>")
+	assert.Contains(html, "Correct: 1/3 Incorrect: 1/3 Skipped: 1/3")
+	assert.Contains(html, "<b>asst1 Score: 10/20</b>")
+	assert.Contains(html, "<td>64 bytes</td>")
+	assert.Contains(html, `<td class="incorrect">incorrect (incorrect: sem1)</td>`)
+
+	// Failed commands are expanded
+	assert.Contains(html, `<details open>`)
+	assert.Contains(html, "<pre>lt1: FAIL</pre>")
+	assert.Contains(html, "1.250000")
+	assert.Contains(html, "no progress for 10 s")
+
+	// Expected output is escaped
+	assert.Contains(html, "<pre>lt1: SUCCESS &lt;done&gt;</pre>")
+
+	assert.Contains(html, "<svg")
+	assert.Contains(html, "kernel 100")
+}
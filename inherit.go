@@ -0,0 +1,179 @@
+package test161
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// This file handles test inheritance. A test can name a base test or a
+// configuration fragment with the extends key:
+//
+//		extends: ../boot.t     # relative to this test file
+//		extends: /boot.t       # relative to the test directory
+//		extends: cpus1         # fragments/cpus1.tf in the test161 directory
+//
+// Fragments use the same syntax as test files. The configuration chunks of the
+// base (sys161, stat, monitor, misc, commandconf, and commandoverrides) are
+// merged underneath the test's own configuration, so the test only needs to
+// specify what differs. If the test has no commands of its own, it also
+// inherits the base's commands. Bases can themselves extend other bases.
+
+// Fragment file extension
+const FRAGMENT_EXT = ".tf"
+
+// A testLoader resolves extends references while loading test files. Either
+// directory may be empty, in which case references that need it fail.
+type testLoader struct {
+	TestDir     string
+	FragmentDir string
+}
+
+// Create a loader for the given (absolute) test directory. Fragments live in
+// the fragments/ directory next to it.
+func newTestLoader(testDir string) *testLoader {
+	return &testLoader{
+		TestDir:     testDir,
+		FragmentDir: path.Join(path.Dir(testDir), "fragments"),
+	}
+}
+
+func (l *testLoader) testsFromFile(filename string) ([]*Test, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading file %v: %v", filename, err)
+	}
+	tests, err := testsFromConf(func() (*Test, error) {
+		return l.confFromFile(filename, string(data), nil)
+	})
+	if err != nil {
+		err = fmt.Errorf("Error loading test file %v: %v", filename, err)
+	}
+	return tests, err
+}
+
+// Parse the test data from filename and apply everything it inherits. chain
+// holds the files we are already in the middle of loading.
+func (l *testLoader) confFromFile(filename, data string, chain []string) (*Test, error) {
+	t, err := confFromString(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(strings.TrimSpace(t.Extends)) == 0 {
+		return t, nil
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	chain = append(chain, path.Clean(abs))
+
+	baseFile, err := l.resolveExtends(strings.TrimSpace(t.Extends), abs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, f := range chain {
+		if f == baseFile {
+			loop := make([]string, 0, len(chain)-i+1)
+			for _, member := range append(chain[i:], baseFile) {
+				loop = append(loop, l.displayName(member))
+			}
+			return nil, fmt.Errorf("Inheritance loop: %v", strings.Join(loop, " -> "))
+		}
+	}
+
+	baseData, err := ioutil.ReadFile(baseFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading base %v: %v", t.Extends, err)
+	}
+
+	base, err := l.confFromFile(baseFile, string(baseData), chain)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = t.inheritFrom(base); err != nil {
+		return nil, err
+	}
+	t.inheritedFrom = append([]string{l.displayName(baseFile)}, base.inheritedFrom...)
+
+	return t, nil
+}
+
+// Find the file for an extends reference made from the file 'from'.
+func (l *testLoader) resolveExtends(ref, from string) (string, error) {
+	var file string
+
+	if strings.HasSuffix(ref, ".t") {
+		if strings.HasPrefix(ref, "/") {
+			if len(l.TestDir) == 0 {
+				return "", fmt.Errorf("Cannot extend %v without a test directory", ref)
+			}
+			file = path.Join(l.TestDir, ref)
+		} else {
+			file = path.Join(path.Dir(from), ref)
+		}
+		file = path.Clean(file)
+		if len(l.TestDir) > 0 && !strings.HasPrefix(file, l.TestDir) {
+			return "", fmt.Errorf("Cannot extend tests outside of testing directory: %v", ref)
+		}
+	} else {
+		if len(l.FragmentDir) == 0 {
+			return "", fmt.Errorf("Cannot extend fragment '%v' without a test161 directory", ref)
+		}
+		if strings.Contains(ref, "/") {
+			return "", fmt.Errorf("Invalid fragment name: %v", ref)
+		}
+		file = path.Join(l.FragmentDir, ref+FRAGMENT_EXT)
+	}
+
+	return file, nil
+}
+
+// Get a short name for a file in an inheritance chain. Tests are named by
+// their ID and fragments by their name.
+func (l *testLoader) displayName(file string) string {
+	if len(l.FragmentDir) > 0 && path.Dir(file) == l.FragmentDir &&
+		strings.HasSuffix(file, FRAGMENT_EXT) {
+		return strings.TrimSuffix(path.Base(file), FRAGMENT_EXT)
+	}
+	if len(l.TestDir) > 0 {
+		if id, err := idFromFile(file, l.TestDir); err == nil {
+			return id
+		}
+	}
+	return file
+}
+
+// Merge the base's configuration underneath ours, and take its commands if we
+// don't have any.
+func (t *Test) inheritFrom(base *Test) error {
+	conf := Test{
+		Sys161:           base.Sys161,
+		Stat:             base.Stat,
+		Monitor:          base.Monitor,
+		CommandConf:      base.CommandConf,
+		Misc:             base.Misc,
+		CommandOverrides: base.CommandOverrides,
+	}
+	if err := t.MergeConf(conf); err != nil {
+		return err
+	}
+
+	if len(strings.TrimSpace(t.Content)) == 0 {
+		t.Content = base.Content
+	}
+
+	return nil
+}
+
+// InheritedFrom returns the names of the base tests and fragments this test
+// inherited from, nearest first.
+func (t *Test) InheritedFrom() []string {
+	return t.inheritedFrom
+}
@@ -0,0 +1,582 @@
+package test161
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/jay1999ke/test161/graph"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// This file implements the test161 linter, which loads an entire test161
+// directory and reports everything wrong with it instead of stopping at the
+// first error. Each problem is tied to a file (relative to the test161
+// directory) and, where we can find it, a line number.
+
+// Lint severities
+const (
+	LINT_ERROR   = "error"
+	LINT_WARNING = "warning"
+)
+
+// Lint checks. These are stable identifiers that tools can filter on.
+const (
+	LINT_LOAD            = "load"             // A file couldn't be loaded
+	LINT_UNKNOWN_KEY     = "unknown-key"      // Unknown front matter key
+	LINT_UNKNOWN_COMMAND = "unknown-command"  // Test command without a template
+	LINT_TEMPLATE        = "template"         // Template fails to expand
+	LINT_DEPENDENCY      = "dependency"       // Dependency doesn't match anything
+	LINT_CYCLE           = "dependency-cycle" // Cycle in the dependency graph
+	LINT_TARGET_TEST     = "target-test"      // Target references an unknown test
+	LINT_TARGET_POINTS   = "target-points"    // Target points don't add up
+	LINT_TARGET_COMMAND  = "target-command"   // Bad TargetCommand id or index
+	LINT_META_TARGET     = "meta-target"      // Metatarget/subtarget problem
+	LINT_DUPLICATE_CMD   = "duplicate-command"
+	LINT_DUPLICATE_TAG   = "duplicate-tag"
+	LINT_UNUSED_COMMAND  = "unused-command"
+)
+
+// LintProblem is a single problem found by the linter.
+type LintProblem struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"` // 0 if unknown
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+}
+
+// LintReport is the result of linting a test161 directory.
+type LintReport struct {
+	Dir      string         `json:"dir"`
+	Problems []*LintProblem `json:"problems"`
+	Errors   int            `json:"errors"`
+	Warnings int            `json:"warnings"`
+}
+
+func (p *LintProblem) String() string {
+	loc := p.File
+	if p.Line > 0 {
+		loc += fmt.Sprintf(":%v", p.Line)
+	}
+	return fmt.Sprintf("%v: %v: %v [%v]", loc, p.Severity, p.Message, p.Check)
+}
+
+// OutputJSON serializes the lint report.
+func (r *LintReport) OutputJSON() (string, error) {
+	outputBytes, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(outputBytes), nil
+}
+
+// Working state for a single lint run
+type linter struct {
+	dir    string
+	env    *TestEnvironment
+	report *LintReport
+	seen   map[string]bool // de-dup problems from matrix instances
+
+	files     map[string]string  // absolute path -> contents
+	cmdFiles  map[string]string  // command template -> file
+	tests     *testMap           // Successfully loaded tests
+	testFiles map[*Test]string   // test -> file
+	targets   map[*Target]string // every target loaded -> file
+	used      map[string]bool    // command templates used by some test
+}
+
+var (
+	yamlLineExp    = regexp.MustCompile(`line (\d+): (.*)`)
+	contentLineExp = regexp.MustCompile(`^(\d+x|\|)?\s*([!@#$%^&*]\s+)?(p\s+)?(\S+)`)
+)
+
+// Lint loads the test161 directory the way NewEnvironment does and reports
+// every problem it finds with the commands, tests, targets, and tags.
+func Lint(test161Dir string) *LintReport {
+	abs, err := filepath.Abs(test161Dir)
+	if err != nil {
+		abs = test161Dir
+	}
+
+	l := &linter{
+		dir:       path.Clean(abs),
+		report:    &LintReport{Dir: abs, Problems: make([]*LintProblem, 0)},
+		seen:      make(map[string]bool),
+		files:     make(map[string]string),
+		cmdFiles:  make(map[string]string),
+		testFiles: make(map[*Test]string),
+		targets:   make(map[*Target]string),
+		used:      make(map[string]bool),
+	}
+
+	l.env = &TestEnvironment{
+		TestDir:  path.Join(l.dir, "tests"),
+		manager:  testManager,
+		Commands: make(map[string]*CommandTemplate),
+		Targets:  make(map[string]*Target),
+		Tags:     make(map[string]*TagDescription),
+		keyMap:   make(map[string]string),
+	}
+
+	l.loadCommands()
+	l.loadTags()
+	l.loadTargets()
+	l.loadTests()
+
+	if l.tests != nil {
+		l.lintTests()
+		l.lintDependencies()
+		l.lintTargets()
+		l.lintUnused()
+	}
+
+	sort.SliceStable(l.report.Problems, func(i, j int) bool {
+		a, b := l.report.Problems[i], l.report.Problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+
+	return l.report
+}
+
+// Add a problem to the report. file is an absolute path (or a directory).
+func (l *linter) add(file string, line int, severity, check, format string, args ...interface{}) {
+	if rel, err := filepath.Rel(l.dir, file); err == nil {
+		file = rel
+	}
+	p := &LintProblem{
+		File:     file,
+		Line:     line,
+		Severity: severity,
+		Check:    check,
+		Message:  fmt.Sprintf(format, args...),
+	}
+
+	key := p.String()
+	if l.seen[key] {
+		return
+	}
+	l.seen[key] = true
+
+	l.report.Problems = append(l.report.Problems, p)
+	if severity == LINT_ERROR {
+		l.report.Errors += 1
+	} else {
+		l.report.Warnings += 1
+	}
+}
+
+// Add a problem from a load error, pulling the line number out of YAML errors.
+// offset is the file line that the YAML document starts on, minus one.
+func (l *linter) addLoadErr(file string, offset int, err error) {
+	matches := yamlLineExp.FindAllStringSubmatch(err.Error(), -1)
+	if len(matches) == 0 {
+		l.add(file, 0, LINT_ERROR, LINT_LOAD, "%v", err)
+		return
+	}
+	for _, m := range matches {
+		line, _ := strconv.Atoi(m[1])
+		l.add(file, line+offset, LINT_ERROR, LINT_LOAD, "%v", m[2])
+	}
+}
+
+func (l *linter) read(file string) string {
+	if text, ok := l.files[file]; ok {
+		return text
+	}
+	data, _ := ioutil.ReadFile(file)
+	l.files[file] = string(data)
+	return l.files[file]
+}
+
+// Find the line number of the first line in file matching exp, or 0.
+func (l *linter) findLine(file string, exp *regexp.Regexp) int {
+	for i, line := range strings.Split(l.read(file), "\n") {
+		if exp.MatchString(line) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Find the line of a YAML "key: value" pair, which may be a list item.
+func (l *linter) findKeyLine(file, key, value string) int {
+	return l.findNthKeyLine(file, key, value, 1)
+}
+
+// Find the line of the nth occurrence of a YAML "key: value" pair, or 0.
+func (l *linter) findNthKeyLine(file, key, value string, n int) int {
+	exp := regexp.MustCompile(`^[\s-]*` + regexp.QuoteMeta(key) + `\s*:\s*["']?` +
+		regexp.QuoteMeta(value) + `["']?\s*(#.*)?$`)
+	for i, line := range strings.Split(l.read(file), "\n") {
+		if exp.MatchString(line) {
+			if n -= 1; n == 0 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// Get the files in dir with the given extension, sorted.
+func (l *linter) dirFiles(dir, ext string) []string {
+	files := make([]string, 0)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return files
+	}
+	for _, f := range entries {
+		if f.Mode().IsRegular() && strings.HasSuffix(f.Name(), ext) {
+			files = append(files, path.Join(dir, f.Name()))
+		}
+	}
+	return files
+}
+
+func (l *linter) loadCommands() {
+	dir := path.Join(l.dir, "commands")
+	if _, err := ioutil.ReadDir(dir); err != nil {
+		l.add(dir, 0, LINT_ERROR, LINT_LOAD, "%v", err)
+		return
+	}
+
+	for _, f := range l.dirFiles(dir, ".tc") {
+		templates, err := CommandTemplatesFromFile(f)
+		if err != nil {
+			l.addLoadErr(f, 0, err)
+			continue
+		}
+		count := make(map[string]int)
+		for _, templ := range templates.Templates {
+			count[templ.Name] += 1
+			line := l.findNthKeyLine(f, "name", templ.Name, count[templ.Name])
+			if prev, ok := l.cmdFiles[templ.Name]; ok {
+				rel, _ := filepath.Rel(l.dir, prev)
+				l.add(f, line, LINT_ERROR, LINT_DUPLICATE_CMD,
+					"Duplicate command (%v), first defined in %v", templ.Name, rel)
+				continue
+			}
+			l.env.Commands[templ.Name] = templ
+			l.cmdFiles[templ.Name] = f
+		}
+	}
+}
+
+func (l *linter) loadTags() {
+	dir := path.Join(l.dir, "tags")
+	tagFiles := make(map[string]string)
+
+	// Tags are optional
+	for _, f := range l.dirFiles(dir, ".td") {
+		tags, err := TagDescriptionsFromFile(f)
+		if err != nil {
+			l.addLoadErr(f, 0, err)
+			continue
+		}
+		count := make(map[string]int)
+		for _, tag := range tags.Tags {
+			count[tag.Name] += 1
+			if prev, ok := tagFiles[tag.Name]; ok {
+				rel, _ := filepath.Rel(l.dir, prev)
+				l.add(f, l.findNthKeyLine(f, "name", tag.Name, count[tag.Name]), LINT_ERROR, LINT_DUPLICATE_TAG,
+					"Duplicate tag (%v), first described in %v", tag.Name, rel)
+				continue
+			}
+			l.env.Tags[tag.Name] = tag
+			tagFiles[tag.Name] = f
+		}
+	}
+}
+
+func (l *linter) loadTargets() {
+	dir := path.Join(l.dir, "targets")
+	if _, err := ioutil.ReadDir(dir); err != nil {
+		l.add(dir, 0, LINT_ERROR, LINT_LOAD, "%v", err)
+		return
+	}
+
+	for _, f := range l.dirFiles(dir, ".tt") {
+		t, err := TargetFromFile(f)
+		if err != nil {
+			l.addLoadErr(f, 0, err)
+			continue
+		}
+		l.targets[t] = f
+
+		// Same rules as envTargetHandler
+		if t.Active == "true" {
+			prev, ok := l.env.Targets[t.Name]
+			if !ok || t.Version > prev.Version {
+				l.env.Targets[t.Name] = t
+			}
+		}
+	}
+
+	if err := l.env.linkMetaTargets(); err != nil {
+		l.add(dir, 0, LINT_ERROR, LINT_META_TARGET, "%v", err)
+	}
+}
+
+// Split a test file into its front matter and content, returning the line
+// each starts on. fmStart is 0 if there is no front matter.
+func splitFrontMatter(text string) (fm string, fmStart int, content string, contentStart int) {
+	if !strings.HasPrefix(text, "---\n") {
+		return "", 0, text, 1
+	}
+	parts := strings.SplitN(text[4:], "\n---\n", 2)
+	if len(parts) != 2 {
+		return "", 0, text, 1
+	}
+	fm = parts[0]
+	fmStart = 2
+	contentStart = fmStart + strings.Count(fm, "\n") + 2
+	return fm, fmStart, parts[1], contentStart
+}
+
+func (l *linter) loadTests() {
+	l.tests = &testMap{l.env.TestDir, make(map[string]*Test), make(TagMap), make(map[string][]*Test)}
+
+	if _, err := ioutil.ReadDir(l.env.TestDir); err != nil {
+		l.add(l.env.TestDir, 0, LINT_ERROR, LINT_LOAD, "%v", err)
+		l.tests = nil
+		return
+	}
+
+	files, err := doublestar.Glob(fmt.Sprintf("%v/**/*.t", l.env.TestDir))
+	if err != nil {
+		l.add(l.env.TestDir, 0, LINT_ERROR, LINT_LOAD, "%v", err)
+		l.tests = nil
+		return
+	}
+	sort.Strings(files)
+
+	loader := newTestLoader(l.env.TestDir)
+
+	for _, f := range files {
+		fm, fmStart, _, _ := splitFrontMatter(l.read(f))
+
+		// Unknown keys. The loader is lenient, so check strictly here.
+		if len(fm) > 0 {
+			strict := &Test{}
+			if err := yaml.UnmarshalStrict([]byte(fm), strict); err != nil {
+				for _, m := range yamlLineExp.FindAllStringSubmatch(err.Error(), -1) {
+					line, _ := strconv.Atoi(m[1])
+					if strings.Contains(m[2], "not found in type") {
+						l.add(f, line+fmStart-1, LINT_ERROR, LINT_UNKNOWN_KEY, "%v", m[2])
+					}
+				}
+			}
+		}
+
+		tests, err := loader.testsFromFile(f)
+		if err != nil {
+			l.addLoadErr(f, fmStart-1, err)
+			continue
+		}
+
+		id, _ := idFromFile(f, l.env.TestDir)
+		l.tests.Files[id] = tests
+		for _, test := range tests {
+			test.DependencyID = id + test.ParamLabel()
+			l.tests.Tests[test.DependencyID] = test
+			l.testFiles[test] = f
+		}
+	}
+
+	l.tests.buildTagMap()
+}
+
+// Mark a command template and everything its output references as used.
+func (l *linter) markUsed(name string) {
+	if l.used[name] {
+		return
+	}
+	l.used[name] = true
+	if tmpl, ok := l.env.Commands[name]; ok {
+		for _, line := range tmpl.Output {
+			if line.External == "true" {
+				l.markUsed(line.Text)
+			}
+		}
+	}
+}
+
+// Find the content line that runs the command with the given id.
+func (l *linter) commandLine(file, id string) int {
+	_, _, content, contentStart := splitFrontMatter(l.read(file))
+	for i, line := range strings.Split(content, "\n") {
+		if m := contentLineExp.FindStringSubmatch(strings.TrimSpace(line)); len(m) == 5 && m[4] == id {
+			return contentStart + i
+		}
+	}
+	return 0
+}
+
+func (l *linter) lintTests() {
+	for _, test := range l.sortedTests() {
+		file := l.testFiles[test]
+
+		// Duplicate tags in a single test
+		tags := make(map[string]bool)
+		for _, tag := range test.Tags {
+			if tags[tag] {
+				l.add(file, l.findLine(file, regexp.MustCompile(`^tags\s*:`)), LINT_WARNING,
+					LINT_DUPLICATE_TAG, "Tag '%v' is listed more than once", tag)
+			}
+			tags[tag] = true
+		}
+
+		for _, cmd := range test.Commands {
+			id := cmd.Id()
+			line := l.commandLine(file, id)
+			if _, ok := l.env.Commands[id]; !ok {
+				l.add(file, line, LINT_ERROR, LINT_UNKNOWN_COMMAND,
+					"Command '%v' is not defined in any commands file", id)
+				continue
+			}
+			l.markUsed(id)
+
+			if err := cmd.Instantiate(l.env); err != nil {
+				l.add(file, line, LINT_ERROR, LINT_TEMPLATE, "Cannot expand '%v': %v",
+					id, strings.TrimSpace(err.Error()))
+			}
+		}
+	}
+}
+
+func (l *linter) lintDependencies() {
+	ok := true
+	for _, test := range l.sortedTests() {
+		done := make(chan error, 1)
+		test.expandTestDeps(l.tests, done)
+		if err := <-done; err != nil {
+			ok = false
+			file := l.testFiles[test]
+			l.add(file, l.findLine(file, regexp.MustCompile(`^depends\s*:`)), LINT_ERROR,
+				LINT_DEPENDENCY, "%v", err)
+		}
+	}
+
+	if !ok {
+		// The graph would be incomplete
+		return
+	}
+
+	g, errs := l.tests.dependencyGraph()
+	for _, err := range errs {
+		l.add(l.env.TestDir, 0, LINT_ERROR, LINT_DEPENDENCY, "%v", err)
+	}
+	if g == nil {
+		return
+	}
+
+	_, err := g.TopSort()
+	if cerr, ok := err.(*graph.CycleError); ok {
+		// Report each cycle at the depends entry of its first edge
+		for _, cycle := range l.tests.dependencyCycles(cerr) {
+			edges := make([]string, 0, len(cycle.Edges))
+			for _, e := range cycle.Edges {
+				edges = append(edges, fmt.Sprintf("%v: '%v'", e.File, e.Depends))
+			}
+			first := cycle.Edges[0]
+			file := path.Join(l.env.TestDir, first.File)
+			l.add(file, l.dependsLine(file, first.Depends), LINT_ERROR, LINT_CYCLE,
+				"Dependency cycle: %v (%v)", graph.CyclePath(cycle.Tests), strings.Join(edges, ", "))
+		}
+	} else if err != nil {
+		l.add(l.env.TestDir, 0, LINT_ERROR, LINT_CYCLE, "%v", err)
+	}
+}
+
+// Find the line of a depends entry, falling back to the depends key.
+func (l *linter) dependsLine(file, entry string) int {
+	exp := regexp.MustCompile(`^\s*-\s*["']?` + regexp.QuoteMeta(entry) + `["']?\s*(#.*)?$`)
+	if line := l.findLine(file, exp); line > 0 {
+		return line
+	}
+	return l.findLine(file, regexp.MustCompile(`^depends\s*:`))
+}
+
+func (l *linter) lintTargets() {
+	targets := make([]*Target, 0, len(l.targets))
+	for t := range l.targets {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return l.targets[targets[i]] < l.targets[targets[j]]
+	})
+
+	for _, target := range targets {
+		file := l.targets[target]
+
+		if target.IsMetaTarget {
+			// Points are checked when linking metatargets
+			continue
+		}
+
+		total := uint(0)
+		for _, tt := range target.Tests {
+			total += tt.Points
+			line := l.findKeyLine(file, "id", tt.Id)
+
+			test, ok := l.tests.Tests[tt.Id]
+			if !ok {
+				l.add(file, line, LINT_ERROR, LINT_TARGET_TEST, "Cannot find test '%v'", tt.Id)
+				continue
+			}
+
+			// applyTo checks command ids, indexes and partial points. It
+			// modifies the test, but these tests are only used for linting.
+			if err := tt.applyTo(test); err != nil {
+				check := LINT_TARGET_COMMAND
+				if strings.Contains(err.Error(), "point") {
+					check = LINT_TARGET_POINTS
+				}
+				l.add(file, line, LINT_ERROR, check, "Test '%v': %v", tt.Id, err)
+			}
+		}
+
+		if total != target.Points {
+			l.add(file, l.findLine(file, regexp.MustCompile(`^points\s*:`)), LINT_ERROR,
+				LINT_TARGET_POINTS, "Target points (%v) do not match sum(test points) (%v)",
+				target.Points, total)
+		}
+	}
+}
+
+func (l *linter) lintUnused() {
+	names := make([]string, 0, len(l.env.Commands))
+	for name := range l.env.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !l.used[name] {
+			file := l.cmdFiles[name]
+			l.add(file, l.findKeyLine(file, "name", name), LINT_WARNING, LINT_UNUSED_COMMAND,
+				"Command '%v' is not used by any test", name)
+		}
+	}
+}
+
+func (l *linter) sortedTests() []*Test {
+	tests := make([]*Test, 0, len(l.tests.Tests))
+	for _, test := range l.tests.Tests {
+		tests = append(tests, test)
+	}
+	sort.Slice(tests, func(i, j int) bool {
+		return tests[i].DependencyID < tests[j].DependencyID
+	})
+	return tests
+}
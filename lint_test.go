@@ -0,0 +1,59 @@
+package test161
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	report := Lint("./fixtures/lint")
+	assert.Equal(8, report.Errors)
+	assert.Equal(2, report.Warnings)
+
+	expected := []struct {
+		file  string
+		line  int
+		check string
+	}{
+		{"commands/cmds.tc", 7, LINT_UNUSED_COMMAND},
+		{"commands/cmds.tc", 8, LINT_DUPLICATE_CMD},
+		{"tags/tags.td", 4, LINT_DUPLICATE_TAG},
+		{"targets/lint.tt", 4, LINT_TARGET_POINTS},
+		{"targets/lint.tt", 9, LINT_TARGET_TEST},
+		{"targets/lint.tt", 11, LINT_TARGET_COMMAND},
+		{"tests/boot.t", 3, LINT_DUPLICATE_TAG},
+		{"tests/sync/dep.t", 3, LINT_DEPENDENCY},
+		{"tests/sync/lt1.t", 7, LINT_UNKNOWN_KEY},
+		{"tests/sync/lt1.t", 10, LINT_UNKNOWN_COMMAND},
+	}
+
+	assert.Equal(len(expected), len(report.Problems))
+	if len(expected) != len(report.Problems) {
+		for _, p := range report.Problems {
+			t.Log(p)
+		}
+		t.FailNow()
+	}
+
+	for i, exp := range expected {
+		p := report.Problems[i]
+		assert.Equal(exp.file, p.File)
+		assert.Equal(exp.line, p.Line)
+		assert.Equal(exp.check, p.Check)
+	}
+}
+
+func TestLintMissingDir(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	report := Lint("./fixtures/lint-missing")
+	// commands, targets, and tests
+	assert.Equal(3, report.Errors)
+	for _, p := range report.Problems {
+		assert.Equal(LINT_LOAD, p.Check)
+	}
+}
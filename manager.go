@@ -8,19 +8,48 @@ import (
 )
 
 // This file defines test161's test manager.  The manager is responsible for
-// keeping track of the number of running tests and limiting that number to
-// a configurable capacity.
+// keeping track of the running tests and limiting the host resources they use
+// to a configurable capacity (see Resources).
 //
 // There is a global test manager (testManager) that listens for new job
 // requests on its SubmitChan.  In the current implementation, this can
 // only be accessed from within the package by one of the TestRunners.
+//
+// Jobs that can't run right away wait in the manager's job queue (see
+// scheduler.go), and are started from the queue as running jobs finish.
 
 // A test161Job consists of the test to run, the directory to find the
-// binaries, and a channel to communicate the results on.
+// binaries, and a channel to communicate the results on. The remaining
+// fields determine where the job goes in the manager's queue.
 type test161Job struct {
 	Test     *Test
 	Env      *TestEnvironment
 	DoneChan chan *Test161JobResult
+
+	Class    PriorityClass // Higher classes run first
+	Owner    string        // Jobs with different owners share capacity fairly
+	Priority float64       // Higher priority jobs run first within an owner
+	Cost     Resources     // Host resources the job uses while it runs
+
+	queued time.Time
+
+	// Set while the job is running on a remote worker (see workers.go)
+	worker   *remoteWorker
+	remoteID string
+	initial  *Test // The test's state before it was sent
+}
+
+// Create a job for a test in a group, using the group's scheduling options.
+func newJob(tg *TestGroup, test *Test, done chan *Test161JobResult, priority float64) *test161Job {
+	return &test161Job{
+		Test:     test,
+		Env:      tg.Config.Env,
+		DoneChan: done,
+		Class:    tg.Config.Priority,
+		Owner:    tg.Config.Owner,
+		Priority: priority,
+		Cost:     test.Cost(),
+	}
 }
 
 // A Test161JobResult consists of the completed test and any error that
@@ -32,18 +61,26 @@ type Test161JobResult struct {
 
 type manager struct {
 	SubmitChan chan *test161Job
-	Capacity   uint
+	Capacity   Resources
 
-	// protected by L
-	statsCond *sync.Cond
+	// l protects the following
+	l         *sync.Mutex
 	queueCond *sync.Cond
 	isRunning bool
+	queue     *jobQueue
+	used      Resources // Total cost of the jobs running locally
+	workers   map[string]*remoteWorker
+	done      chan struct{} // Closed when the manager stops
+
+	// How long a remote worker can go without contacting us before its
+	// jobs are re-queued
+	workerTimeout time.Duration
 
 	stats ManagerStats
 }
 
 type ManagerStats struct {
-	// protected by manager.L
+	// protected by manager.l
 	Running     uint  `json:"running"`
 	HighRunning uint  `json:"high_running"`
 	Queued      uint  `json:"queued"`
@@ -53,6 +90,18 @@ type ManagerStats struct {
 	AvgWait     int64 `json:"avg_wait_ms"`
 	StartTime   time.Time
 	total       int64 // denominator for avg
+
+	// The number of queued jobs in each priority class
+	QueuedByClass map[string]uint `json:"queued_by_class,omitempty"`
+
+	// The resources used by the jobs running locally, and the capacity
+	InUse    Resources `json:"in_use"`
+	Capacity Resources `json:"capacity"`
+
+	// Remote workers, and the number of jobs re-queued because a worker
+	// was lost
+	Workers  []*WorkerStats `json:"workers,omitempty"`
+	Requeued uint           `json:"requeued"`
 }
 
 // Combined submission and tests statistics since the service started
@@ -62,15 +111,19 @@ type Test161Stats struct {
 	TestStats       ManagerStats `json:"test_stats"`
 }
 
-const DEFAULT_MGR_CAPACITY uint = 0
+var DEFAULT_MGR_CAPACITY = Resources{}
 
 func newManager() *manager {
 	m := &manager{
 		SubmitChan: nil,
 		Capacity:   DEFAULT_MGR_CAPACITY,
-		statsCond:  sync.NewCond(&sync.Mutex{}),
+		l:          &sync.Mutex{},
 		queueCond:  sync.NewCond(&sync.Mutex{}),
 		isRunning:  false,
+		queue:      newJobQueue(),
+		workers:    make(map[string]*remoteWorker),
+
+		workerTimeout: DEFAULT_WORKER_TIMEOUT,
 	}
 	return m
 }
@@ -83,97 +136,179 @@ var testManager *manager = newManager()
 
 // Clear state and start listening for job requests
 func (m *manager) start() {
-	m.statsCond.L.Lock()
-	defer m.statsCond.L.Unlock()
+	m.l.Lock()
+	defer m.l.Unlock()
 
 	if m.isRunning {
 		return
 	}
 
 	m.stats = ManagerStats{
-		StartTime: time.Now(),
+		StartTime:     time.Now(),
+		QueuedByClass: make(map[string]uint),
+	}
+	for c := PRIORITY_LOW; c <= PRIORITY_HIGH; c++ {
+		m.stats.QueuedByClass[c.String()] = 0
 	}
+	m.queue = newJobQueue()
+	m.workers = make(map[string]*remoteWorker)
+	m.done = make(chan struct{})
 	m.SubmitChan = make(chan *test161Job)
 	m.isRunning = true
 
 	// Listener goroutine
 	go func() {
-		// We simply spawn a worker that blocks until it can run.
 		for job := range m.SubmitChan {
-			go m.runOrQueueJob(job)
+			m.submit(job)
 		}
 	}()
+
+	go m.reapWorkers(m.done)
 }
 
-// Queue the job if we're at capacity, and run it once we're under.
-func (m *manager) runOrQueueJob(job *test161Job) {
+// Whether there's room locally for a job that costs cost. A job that costs
+// more than the capacity can still run by itself. The caller must hold l.
+func (m *manager) hasCapacity(cost Resources) bool {
+	return m.used.Tests == 0 || m.Capacity.fits(m.used, cost)
+}
 
-	m.statsCond.L.Lock()
-	queued := false
-	start := time.Now()
+// Find somewhere to run a job that costs cost, preferring to run it locally.
+// The worker is nil for local jobs, and ok is false if there's no room
+// anywhere. The caller must hold l.
+func (m *manager) placeJob(cost Resources) (w *remoteWorker, ok bool) {
+	if m.hasCapacity(cost) {
+		return nil, true
+	}
+	w = m.findWorker(cost)
+	return w, w != nil
+}
 
-	for m.Capacity > 0 && m.stats.Running >= m.Capacity {
-		if !queued {
-			queued = true
+// Run the job if there's capacity and nothing is waiting ahead of it,
+// otherwise queue it.
+func (m *manager) submit(job *test161Job) {
+	if job.Env != nil {
+		job.Env.notifyAndLogErr("Test Queued", job.Test, MSG_PERSIST_QUEUED, 0)
+	}
 
-			// Update queued stats
-			m.stats.Queued += 1
-			if m.stats.Queued > m.stats.HighQueued {
-				m.stats.HighQueued = m.stats.Queued
-			}
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	// Whatever else it costs, every job is one test
+	job.Cost.Tests = 1
+
+	if m.queue.len() == 0 {
+		if w, ok := m.placeJob(job.Cost); ok {
+			m.startJob(job, w)
+			return
 		}
+	}
+
+	m.enqueue(job)
+}
 
-		// Wait for a finished test to signal us
-		m.statsCond.Wait()
+// Add a job to the queue. The caller must hold l.
+func (m *manager) enqueue(job *test161Job) {
+	job.queued = time.Now()
+	m.queue.push(job)
+
+	// Update queued stats
+	m.stats.Queued += 1
+	if m.stats.Queued > m.stats.HighQueued {
+		m.stats.HighQueued = m.stats.Queued
 	}
+	m.stats.QueuedByClass[job.Class.String()] = uint(m.queue.classLen(job.Class))
+}
+
+// Start queued jobs until the next one doesn't fit. Jobs aren't started out
+// of order, so a large job at the front of the queue can't be starved by
+// smaller ones. The caller must hold l.
+func (m *manager) dispatch() {
+	for {
+		next := m.queue.peek()
+		if next == nil {
+			return
+		}
+		w, ok := m.placeJob(next.Cost)
+		if !ok {
+			return
+		}
+		job := m.queue.pop()
 
-	// We've got the green light... (and the stats lock)
-	if queued {
 		// Update the queue count and signal the submission manager (if there is one)
 		m.queueCond.L.Lock()
 		m.stats.Queued -= 1
 		m.queueCond.Signal()
 		m.queueCond.L.Unlock()
-		queued = false
+		m.stats.QueuedByClass[job.Class.String()] = uint(m.queue.classLen(job.Class))
 
 		// Max and average waits
-		curWait := int64(time.Now().Sub(start).Nanoseconds() / 1e6)
+		curWait := int64(time.Now().Sub(job.queued).Nanoseconds() / 1e6)
 		if m.stats.MaxWait < curWait {
 			m.stats.MaxWait = curWait
 		}
 		m.stats.AvgWait = (m.stats.total*m.stats.AvgWait + curWait) / (m.stats.total + 1)
 		m.stats.total += 1
+
+		m.startJob(job, w)
 	}
+}
 
+// Start running a job, either locally or on a remote worker. The caller must
+// hold l.
+func (m *manager) startJob(job *test161Job, w *remoteWorker) {
+	m.queue.started(job)
+	if !job.queued.IsZero() {
+		job.Test.queueWait += TimeFixedPoint(time.Since(job.queued).Seconds())
+	}
 	m.stats.Running += 1
 	if m.stats.Running > m.stats.HighRunning {
 		m.stats.HighRunning = m.stats.Running
 	}
 
-	m.statsCond.L.Unlock()
+	if w != nil {
+		m.assignJob(job, w)
+	} else {
+		m.used = m.used.add(job.Cost)
+		go m.runJob(job)
+	}
+}
 
+func (m *manager) runJob(job *test161Job) {
 	// Go!
 	err := job.Test.Run(job.Env)
 
 	// And... we're done.
+	if err == nil && !job.Test.Cached {
+		job.Env.WallTimes.Record(job.Test)
+	}
 
-	// Update stats
-	m.statsCond.L.Lock()
+	// Update stats and let the next job run
+	m.l.Lock()
 	m.stats.Running -= 1
 	m.stats.Finished += 1
-
-	m.statsCond.Signal()
-	m.statsCond.L.Unlock()
+	m.used = m.used.sub(job.Cost)
+	m.queue.finished(job)
+	m.dispatch()
+	m.l.Unlock()
 
 	// Pass the completed test back to the caller
 	// (Blocking call, we need to make sure the caller gets the result.)
 	job.DoneChan <- &Test161JobResult{job.Test, err}
 }
 
+// Change the capacity, starting queued jobs if there's now room for them.
+func (m *manager) setCapacity(capacity Resources) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	m.Capacity = capacity
+	m.dispatch()
+}
+
 // Shut it down
 func (m *manager) stop() {
-	m.statsCond.L.Lock()
-	defer m.statsCond.L.Unlock()
+	m.l.Lock()
+	defer m.l.Unlock()
 
 	if !m.isRunning {
 		return
@@ -181,6 +316,7 @@ func (m *manager) stop() {
 
 	m.isRunning = false
 	close(m.SubmitChan)
+	close(m.done)
 }
 
 // Exported shared test manger functions
@@ -195,21 +331,33 @@ func StopManager() {
 	testManager.stop()
 }
 
-func SetManagerCapacity(capacity uint) {
-	testManager.Capacity = capacity
+// Set the shared test manager's capacity. Zero fields are unlimited.
+func SetManagerCapacity(capacity Resources) {
+	testManager.setCapacity(capacity)
 }
 
-func ManagerCapacity() uint {
+func ManagerCapacity() Resources {
+	testManager.l.Lock()
+	defer testManager.l.Unlock()
 	return testManager.Capacity
 }
 
 func (m *manager) Stats() *ManagerStats {
 	// Lock so we at least get a consistent view of the stats
-	testManager.statsCond.L.Lock()
-	defer testManager.statsCond.L.Unlock()
+	m.l.Lock()
+	defer m.l.Unlock()
 
 	// copy
-	var res ManagerStats = testManager.stats
+	var res ManagerStats = m.stats
+	res.InUse = m.used
+	res.Capacity = m.Capacity
+	res.Workers = m.workerStats()
+	if m.stats.QueuedByClass != nil {
+		res.QueuedByClass = make(map[string]uint, len(m.stats.QueuedByClass))
+		for class, count := range m.stats.QueuedByClass {
+			res.QueuedByClass[class] = count
+		}
+	}
 	return &res
 }
 
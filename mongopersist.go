@@ -131,6 +131,9 @@ func (m *MongoPersistence) Notify(t interface{}, msg, what int) (err error) {
 
 				if what&MSG_FIELD_STATUS == MSG_FIELD_STATUS {
 					changes["commands.$.status"] = cmd.Status
+					changes["commands.$.fail_reason"] = cmd.FailReason
+					changes["commands.$.matches"] = cmd.Matches
+					changes["commands.$.diff"] = cmd.Diff
 				}
 
 				err = m.updateDocument(session, COLLECTION_TESTS, selector, bson.M{"$set": changes})
@@ -272,6 +275,10 @@ func (m *MongoPersistence) Retrieve(what int, who map[string]interface{}, filter
 		collection = COLLECTION_STUDENTS
 	case PERSIST_TYPE_USERS:
 		collection = COLLECTION_USERS
+	case PERSIST_TYPE_SUBMISSIONS:
+		collection = COLLECTION_SUBMISSIONS
+	case PERSIST_TYPE_TESTS:
+		collection = COLLECTION_TESTS
 	default:
 		return errors.New("Persistence: Invalid data type")
 	}
@@ -6,6 +6,7 @@ const (
 	MSG_PERSIST_OUTPUT          // Added an output line (command types only)
 	MSG_PERSIST_COMPLETE        // We won't update the object any more
 	MSG_TARGET_LOAD             // When a target is loaded
+	MSG_PERSIST_QUEUED          // The test is waiting to run (test types only)
 )
 
 // Inidividual field updates
@@ -20,6 +21,8 @@ const (
 const (
 	PERSIST_TYPE_STUDENTS = 1 << iota
 	PERSIST_TYPE_USERS
+	PERSIST_TYPE_SUBMISSIONS
+	PERSIST_TYPE_TESTS
 )
 
 // Each Submission has at most one PersistenceManager, and it is pinged when a
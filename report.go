@@ -0,0 +1,429 @@
+package test161
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Reporter writes the results of a TestGroup in a format that other tools
+// understand, such as CI systems. Reporters are registered by name so front
+// ends can let users pick them, e.g. 'test161 run -report junit=out.xml'.
+type Reporter interface {
+	Report(w io.Writer, tg *TestGroup) error
+}
+
+// The number of output lines of a failed command to include in reports
+const REPORT_OUTPUT_LINES = 20
+
+var reporters = struct {
+	sync.Mutex
+	byName map[string]Reporter
+}{
+	byName: map[string]Reporter{
+		"html":  &HTMLReporter{},
+		"junit": &JUnitReporter{},
+		"tap":   &TAPReporter{},
+	},
+}
+
+// RegisterReporter makes a Reporter available by name, replacing any reporter
+// already registered with that name.
+func RegisterReporter(name string, r Reporter) {
+	reporters.Lock()
+	defer reporters.Unlock()
+	reporters.byName[name] = r
+}
+
+// GetReporter returns the reporter registered with the given name.
+func GetReporter(name string) (Reporter, error) {
+	reporters.Lock()
+	defer reporters.Unlock()
+	if r, ok := reporters.byName[name]; ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("Unknown report format '%v'. Must be one of (%v)",
+		name, strings.Join(reporterNames(), ", "))
+}
+
+// ReporterNames returns the names of the registered reporters, sorted.
+func ReporterNames() []string {
+	reporters.Lock()
+	defer reporters.Unlock()
+	return reporterNames()
+}
+
+func reporterNames() []string {
+	names := make([]string, 0, len(reporters.byName))
+	for name := range reporters.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A group of tests in a report. Graded tests are grouped by target, and
+// everything else by its first tag.
+type reportSuite struct {
+	Name  string
+	Tests []*Test
+}
+
+func reportSuiteName(tg *TestGroup, test *Test) string {
+	if len(test.TargetName) > 0 {
+		return test.TargetName
+	} else if len(test.Tags) > 0 {
+		return test.Tags[0]
+	} else if tg.Config != nil && len(tg.Config.Name) > 0 {
+		return tg.Config.Name
+	}
+	return "tests"
+}
+
+// Split a group into suites, sorted by name, with sorted tests.
+func reportSuites(tg *TestGroup) []*reportSuite {
+	byName := make(map[string]*reportSuite)
+	for _, test := range tg.Tests {
+		name := reportSuiteName(tg, test)
+		suite, ok := byName[name]
+		if !ok {
+			suite = &reportSuite{Name: name}
+			byName[name] = suite
+		}
+		suite.Tests = append(suite.Tests, test)
+	}
+
+	suites := make([]*reportSuite, 0, len(byName))
+	for _, suite := range byName {
+		sort.Slice(suite.Tests, func(i, j int) bool {
+			return suite.Tests[i].DependencyID < suite.Tests[j].DependencyID
+		})
+		suites = append(suites, suite)
+	}
+	sort.Slice(suites, func(i, j int) bool {
+		return suites[i].Name < suites[j].Name
+	})
+	return suites
+}
+
+// A one line explanation of why a test didn't pass.
+func reportReason(test *Test) string {
+	switch test.Result {
+	case TEST_RESULT_SKIP:
+		for _, dep := range test.ExpandedDeps {
+			if test.DependencyKind(dep.DependencyID) == DEP_HARD &&
+				(dep.Result == TEST_RESULT_INCORRECT || dep.Result == TEST_RESULT_SKIP) {
+				return "dependency " + dep.DependencyID + " did not pass"
+			}
+		}
+		return "a dependency did not pass"
+	case TEST_RESULT_ABORT:
+		return "the test was aborted"
+	case TEST_RESULT_NONE, TEST_RESULT_RUNNING:
+		return "the test did not run"
+	}
+
+	failed := make([]string, 0)
+	for _, cmd := range test.Commands {
+		if cmd.Status == COMMAND_STATUS_INCORRECT {
+			failed = append(failed, cmd.Input.Line)
+		}
+	}
+	if len(failed) > 0 {
+		return "incorrect: " + strings.Join(failed, ", ")
+	}
+	return string(test.Result)
+}
+
+// The details of a test that didn't pass: the output of each failed command
+// and the test's statuses, including those from the progress monitor.
+func reportDetails(test *Test) string {
+	var b strings.Builder
+	for _, cmd := range test.Commands {
+		if cmd.Status != COMMAND_STATUS_INCORRECT {
+			continue
+		}
+		fmt.Fprintf(&b, "Command '%v' was incorrect", cmd.Input.Line)
+		if cmd.TimedOut {
+			b.WriteString(" (timed out)")
+		}
+		b.WriteString(":\n")
+		lines := cmd.Output
+		if len(lines) > REPORT_OUTPUT_LINES {
+			fmt.Fprintf(&b, "    ... (%v lines)\n", len(lines)-REPORT_OUTPUT_LINES)
+			lines = lines[len(lines)-REPORT_OUTPUT_LINES:]
+		}
+		for _, line := range lines {
+			fmt.Fprintf(&b, "    %.6f\t%v\n", line.SimTime, line.Line)
+		}
+		if len(cmd.Diff) > 0 {
+			b.WriteString("Expected vs. actual output:\n")
+			for _, line := range strings.Split(strings.TrimRight(cmd.Diff, "\n"), "\n") {
+				b.WriteString("    " + line + "\n")
+			}
+		}
+	}
+	if len(test.Status) > 0 {
+		b.WriteString("Status:\n")
+		for _, status := range test.Status {
+			fmt.Fprintf(&b, "    %.6f\t%v", status.SimTime, status.Status)
+			if len(status.Message) > 0 {
+				fmt.Fprintf(&b, ": %v", status.Message)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// JUnit XML
+
+// JUnitReporter writes JUnit XML. Suites are targets and tags, test cases are
+// tests, and each command is a property of its test case, along with points.
+type JUnitReporter struct{}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name       string          `xml:"name,attr"`
+	ClassName  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitMessage   `xml:"failure,omitempty"`
+	Error      *junitMessage   `xml:"error,omitempty"`
+	Skipped    *junitMessage   `xml:"skipped,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties []junitProperty  `xml:"properties>property,omitempty"`
+	TestCases  []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Errors   int               `xml:"errors,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+func junitTime(t TimeFixedPoint) string {
+	return fmt.Sprintf("%.3f", t)
+}
+
+func junitPoints(earned, avail uint) []junitProperty {
+	return []junitProperty{
+		{"points_earned", fmt.Sprint(earned)},
+		{"points_available", fmt.Sprint(avail)},
+	}
+}
+
+func (r *JUnitReporter) testCase(suite string, test *Test) *junitTestCase {
+	tc := &junitTestCase{
+		Name:      test.DependencyID,
+		ClassName: suite,
+		Time:      junitTime(test.WallTime),
+	}
+	if test.PointsAvailable > 0 {
+		tc.Properties = junitPoints(test.PointsEarned, test.PointsAvailable)
+	}
+	for i, cmd := range test.Commands {
+		value := cmd.Status
+		if cmd.PointsAvailable > 0 {
+			value += fmt.Sprintf(" (%v/%v)", cmd.PointsEarned, cmd.PointsAvailable)
+		}
+		tc.Properties = append(tc.Properties, junitProperty{
+			fmt.Sprintf("step %v: %v", i+1, cmd.Input.Line), value,
+		})
+	}
+
+	msg := &junitMessage{
+		Message: reportReason(test),
+		Type:    string(test.Result),
+		Text:    reportDetails(test),
+	}
+	switch test.Result {
+	case TEST_RESULT_CORRECT:
+	case TEST_RESULT_INCORRECT:
+		tc.Failure = msg
+	case TEST_RESULT_SKIP:
+		tc.Skipped = &junitMessage{Message: msg.Message}
+	default:
+		tc.Error = msg
+	}
+	if test.Result != TEST_RESULT_CORRECT && test.Result != TEST_RESULT_SKIP {
+		tc.SystemOut = test.OutputString()
+	}
+
+	return tc
+}
+
+func (r *JUnitReporter) Report(w io.Writer, tg *TestGroup) error {
+	report := &junitTestSuites{}
+	if tg.Config != nil {
+		report.Name = tg.Config.Name
+	}
+
+	total := TimeFixedPoint(0)
+	for _, suite := range reportSuites(tg) {
+		js := &junitTestSuite{Name: suite.Name}
+		suiteTime := TimeFixedPoint(0)
+		earned, avail := uint(0), uint(0)
+
+		for _, test := range suite.Tests {
+			tc := r.testCase(suite.Name, test)
+			js.TestCases = append(js.TestCases, tc)
+			js.Tests += 1
+			if tc.Failure != nil {
+				js.Failures += 1
+			} else if tc.Error != nil {
+				js.Errors += 1
+			} else if tc.Skipped != nil {
+				js.Skipped += 1
+			}
+			suiteTime += test.WallTime
+			earned += test.PointsEarned
+			avail += test.PointsAvailable
+		}
+
+		js.Time = junitTime(suiteTime)
+		if avail > 0 {
+			js.Properties = junitPoints(earned, avail)
+		}
+
+		report.Suites = append(report.Suites, js)
+		report.Tests += js.Tests
+		report.Failures += js.Failures
+		report.Errors += js.Errors
+		report.Skipped += js.Skipped
+		total += suiteTime
+	}
+	report.Time = junitTime(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// TAP
+
+// TAPReporter writes TAP version 14. Each test is a test point with its
+// commands as a subtest, and points and failure details go in the test
+// point's YAML block. Suites are written as comments.
+type TAPReporter struct{}
+
+// Indent a block of text for a TAP YAML block
+func tapIndent(text, indent string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	return indent + strings.Join(lines, "\n"+indent) + "\n"
+}
+
+// TAP descriptions can't contain '#', which starts a directive.
+func tapDescription(desc string) string {
+	return strings.Replace(desc, "#", "\\#", -1)
+}
+
+func (r *TAPReporter) testPoint(w io.Writer, num int, test *Test) {
+	// Commands as a subtest
+	if len(test.Commands) > 0 && test.Result != TEST_RESULT_SKIP {
+		fmt.Fprintf(w, "    # Subtest: %v\n", tapDescription(test.DependencyID))
+		for i, cmd := range test.Commands {
+			ok := "ok"
+			if cmd.Status != COMMAND_STATUS_CORRECT {
+				ok = "not ok"
+			}
+			fmt.Fprintf(w, "    %v %v - %v\n", ok, i+1, tapDescription(cmd.Input.Line))
+		}
+		fmt.Fprintf(w, "    1..%v\n", len(test.Commands))
+	}
+
+	desc := tapDescription(test.DependencyID)
+	switch test.Result {
+	case TEST_RESULT_CORRECT:
+		fmt.Fprintf(w, "ok %v - %v\n", num, desc)
+	case TEST_RESULT_SKIP:
+		fmt.Fprintf(w, "ok %v - %v # SKIP %v\n", num, desc, reportReason(test))
+		return
+	default:
+		fmt.Fprintf(w, "not ok %v - %v\n", num, desc)
+	}
+
+	if test.PointsAvailable == 0 && test.Result == TEST_RESULT_CORRECT {
+		return
+	}
+
+	fmt.Fprintf(w, "  ---\n")
+	if test.PointsAvailable > 0 {
+		fmt.Fprintf(w, "  points: %v/%v\n", test.PointsEarned, test.PointsAvailable)
+	}
+	if test.Result != TEST_RESULT_CORRECT {
+		fmt.Fprintf(w, "  message: %q\n", reportReason(test))
+		fmt.Fprintf(w, "  severity: %v\n", test.Result)
+		fmt.Fprintf(w, "  data: |\n")
+		io.WriteString(w, tapIndent(reportDetails(test), "    "))
+	}
+	fmt.Fprintf(w, "  ...\n")
+}
+
+func (r *TAPReporter) Report(w io.Writer, tg *TestGroup) error {
+	ew := &errWriter{w: w}
+	fmt.Fprintf(ew, "TAP version 14\n")
+	fmt.Fprintf(ew, "1..%v\n", len(tg.Tests))
+
+	num := 1
+	for _, suite := range reportSuites(tg) {
+		fmt.Fprintf(ew, "# %v\n", suite.Name)
+		for _, test := range suite.Tests {
+			r.testPoint(ew, num, test)
+			num += 1
+		}
+	}
+	return ew.err
+}
+
+// An io.Writer that remembers the first error, so a report can be written
+// without checking every write.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n, err := ew.w.Write(p)
+	ew.err = err
+	return n, err
+}
@@ -0,0 +1,126 @@
+package test161
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A finished group with one correct, one incorrect and one skipped test
+func reportGroup(t *testing.T) *TestGroup {
+	tg := EmptyGroup()
+	tg.Config = &GroupConfig{Name: "asst1"}
+
+	add := func(id, target string, result TestResult) *Test {
+		test, err := TestFromString("sem1\nq")
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.DependencyID = id
+		test.TargetName = target
+		test.Tags = []string{"sync"}
+		test.Result = result
+		test.WallTime = 1.5
+		for _, cmd := range test.Commands {
+			cmd.Status = COMMAND_STATUS_CORRECT
+		}
+		tg.Tests[id] = test
+		return test
+	}
+
+	test := add("sync/sem1.t", "asst1", TEST_RESULT_CORRECT)
+	test.PointsAvailable, test.PointsEarned = 10, 10
+
+	test = add("sync/lt1.t", "asst1", TEST_RESULT_INCORRECT)
+	test.PointsAvailable = 10
+	test.Commands[1].Status = COMMAND_STATUS_INCORRECT
+	test.Commands[1].Output = []*OutputLine{{SimTime: 1.25, Line: "lt1: FAIL"}}
+	test.Status = []Status{
+		{Status: "started"},
+		{Status: "monitor", Message: "no progress for 10 s"},
+	}
+
+	add("boot.t", "", TEST_RESULT_SKIP)
+
+	return tg
+}
+
+func TestReporters(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	assert.Equal([]string{"html", "junit", "tap"}, ReporterNames())
+	_, err := GetReporter("xml")
+	assert.NotNil(err)
+}
+
+func TestJUnitReport(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	r, err := GetReporter("junit")
+	assert.Nil(err)
+
+	var buf bytes.Buffer
+	assert.Nil(r.Report(&buf, reportGroup(t)))
+	t.Log(buf.String())
+
+	report := &junitTestSuites{}
+	assert.Nil(xml.Unmarshal(buf.Bytes(), report))
+	assert.Equal(3, report.Tests)
+	assert.Equal(1, report.Failures)
+	assert.Equal(1, report.Skipped)
+	assert.Equal("4.500", report.Time)
+
+	if assert.Equal(2, len(report.Suites)) {
+		suite := report.Suites[0]
+		assert.Equal("asst1", suite.Name)
+		assert.Equal([]junitProperty{{"points_earned", "10"}, {"points_available", "20"}},
+			suite.Properties)
+
+		if assert.Equal(2, len(suite.TestCases)) {
+			tc := suite.TestCases[0]
+			assert.Equal("sync/lt1.t", tc.Name)
+			assert.Contains(tc.Properties, junitProperty{"step 2: sem1", "incorrect"})
+			if assert.NotNil(tc.Failure) {
+				assert.Equal("incorrect: sem1", tc.Failure.Message)
+				assert.Contains(tc.Failure.Text, "lt1: FAIL")
+				assert.Contains(tc.Failure.Text, "monitor: no progress for 10 s")
+			}
+			assert.Nil(suite.TestCases[1].Failure)
+		}
+
+		// Ungraded tests are grouped by tag
+		suite = report.Suites[1]
+		assert.Equal("sync", suite.Name)
+		if assert.Equal(1, len(suite.TestCases)) {
+			assert.NotNil(suite.TestCases[0].Skipped)
+		}
+	}
+}
+
+func TestTAPReport(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	r, err := GetReporter("tap")
+	assert.Nil(err)
+
+	var buf bytes.Buffer
+	assert.Nil(r.Report(&buf, reportGroup(t)))
+	t.Log(buf.String())
+
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal("TAP version 14", lines[0])
+	assert.Equal("1..3", lines[1])
+
+	text := buf.String()
+	assert.Contains(text, "    not ok 2 - sem1\n")
+	assert.Contains(text, "not ok 1 - sync/lt1.t\n  ---\n  points: 0/10\n")
+	assert.Contains(text, "ok 2 - sync/sem1.t\n  ---\n  points: 10/10\n  ...\n")
+	assert.Contains(text, "ok 3 - boot.t # SKIP a dependency did not pass\n")
+	assert.Contains(text, "      1.250000\tlt1: FAIL\n")
+}
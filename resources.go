@@ -0,0 +1,207 @@
+package test161
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Resources describes host resources, either the cost of running a test or
+// the test manager's capacity. In a capacity, a zero field means there's no
+// limit on that resource.
+type Resources struct {
+	Tests  uint    `json:"tests" yaml:"tests"`   // Number of tests
+	CPUs   float64 `json:"cpus" yaml:"cpus"`     // Host CPU units
+	Memory uint64  `json:"memory" yaml:"memory"` // Simulated RAM, in bytes
+	Disk   uint64  `json:"disk" yaml:"disk"`     // Scratch disk, in bytes
+}
+
+func (r Resources) add(other Resources) Resources {
+	return Resources{
+		Tests:  r.Tests + other.Tests,
+		CPUs:   r.CPUs + other.CPUs,
+		Memory: r.Memory + other.Memory,
+		Disk:   r.Disk + other.Disk,
+	}
+}
+
+func (r Resources) sub(other Resources) Resources {
+	return Resources{
+		Tests:  r.Tests - other.Tests,
+		CPUs:   r.CPUs - other.CPUs,
+		Memory: r.Memory - other.Memory,
+		Disk:   r.Disk - other.Disk,
+	}
+}
+
+// Check whether something that costs cost can be added to used without
+// going over capacity.
+func (capacity Resources) fits(used, cost Resources) bool {
+	total := used.add(cost)
+	return (capacity.Tests == 0 || total.Tests <= capacity.Tests) &&
+		(capacity.CPUs == 0 || total.CPUs <= capacity.CPUs) &&
+		(capacity.Memory == 0 || total.Memory <= capacity.Memory) &&
+		(capacity.Disk == 0 || total.Disk <= capacity.Disk)
+}
+
+// Whether a capacity has no limits
+func (r Resources) IsUnlimited() bool {
+	return r == Resources{}
+}
+
+func (r Resources) String() string {
+	if r.IsUnlimited() {
+		return "unlimited"
+	}
+
+	parts := make([]string, 0)
+	if r.Tests > 0 {
+		parts = append(parts, fmt.Sprintf("tests=%v", r.Tests))
+	}
+	if r.CPUs > 0 {
+		parts = append(parts, fmt.Sprintf("cpus=%v", r.CPUs))
+	}
+	if r.Memory > 0 {
+		parts = append(parts, "memory="+FormatSize(r.Memory))
+	}
+	if r.Disk > 0 {
+		parts = append(parts, "disk="+FormatSize(r.Disk))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseResources parses a capacity from a string. A plain number is a number
+// of tests; otherwise the string is a space separated list of key=value
+// pairs, e.g. "tests=20 cpus=32 memory=64M disk=4G". Memory and disk accept
+// the same K, M and G suffixes as sys161.
+func ParseResources(text string) (Resources, error) {
+	r := Resources{}
+
+	text = strings.TrimSpace(text)
+	if text == "" || text == "unlimited" {
+		return r, nil
+	}
+
+	if tests, err := strconv.ParseUint(text, 10, 32); err == nil {
+		r.Tests = uint(tests)
+		return r, nil
+	}
+
+	for _, field := range strings.Fields(text) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return r, fmt.Errorf("Invalid capacity '%v', expected key=value", field)
+		}
+
+		var err error
+		switch kv[0] {
+		case "tests":
+			var tests uint64
+			tests, err = strconv.ParseUint(kv[1], 10, 32)
+			r.Tests = uint(tests)
+		case "cpus":
+			r.CPUs, err = strconv.ParseFloat(kv[1], 64)
+			if err == nil && r.CPUs < 0 {
+				err = errors.New("must not be negative")
+			}
+		case "memory":
+			r.Memory, err = ParseSize(kv[1])
+		case "disk":
+			r.Disk, err = ParseSize(kv[1])
+		default:
+			return r, fmt.Errorf("Unknown capacity '%v', expected tests, cpus, memory, or disk", kv[0])
+		}
+
+		if err != nil {
+			return r, fmt.Errorf("Invalid %v capacity '%v': %v", kv[0], kv[1], err)
+		}
+	}
+
+	return r, nil
+}
+
+var sizeSuffixes = []struct {
+	suffix string
+	bytes  uint64
+}{
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+// ParseSize parses a size in bytes with an optional K, M or G suffix, as used
+// for sys161 RAM and disk sizes.
+func ParseSize(text string) (uint64, error) {
+	text = strings.ToUpper(strings.TrimSpace(text))
+	mult := uint64(1)
+	for _, s := range sizeSuffixes {
+		if strings.HasSuffix(text, s.suffix) {
+			text = strings.TrimSuffix(text, s.suffix)
+			mult = s.bytes
+			break
+		}
+	}
+
+	size, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid size: %v", text)
+	}
+	return size * mult, nil
+}
+
+// FormatSize formats a size in bytes using the largest suffix that divides it.
+func FormatSize(size uint64) string {
+	for _, s := range sizeSuffixes {
+		if size > 0 && size%s.bytes == 0 {
+			return fmt.Sprintf("%v%v", size/s.bytes, s.suffix)
+		}
+	}
+	return fmt.Sprintf("%v", size)
+}
+
+// Cost returns the host resources the test uses while it runs. Each simulated
+// CPU uses a host CPU unit, scaled by the test's optional weight, and each
+// enabled disk uses scratch disk space. Tests are queued before their
+// configuration defaults are merged, so unset values use CONF_DEFAULTS here.
+// Sizes that can't be parsed are ignored; sys161 reports them when the test
+// runs.
+func (t *Test) Cost() Resources {
+	defaults := CONF_DEFAULTS.Sys161
+
+	weight := t.Misc.Weight
+	if weight <= 0 {
+		weight = 1.0
+	}
+	cpus := t.Sys161.CPUs
+	if cpus == 0 {
+		cpus = defaults.CPUs
+	}
+	ram := t.Sys161.RAM
+	if ram == "" {
+		ram = defaults.RAM
+	}
+
+	cost := Resources{
+		Tests: 1,
+		CPUs:  float64(cpus) * weight,
+	}
+	cost.Memory, _ = ParseSize(ram)
+
+	disks := []DiskConf{t.Sys161.Disk1, t.Sys161.Disk2}
+	defDisks := []DiskConf{defaults.Disk1, defaults.Disk2}
+	for i, disk := range disks {
+		if disk.Enabled == "" {
+			disk.Enabled = defDisks[i].Enabled
+		}
+		if disk.Bytes == "" {
+			disk.Bytes = defDisks[i].Bytes
+		}
+		if disk.Enabled == "true" {
+			bytes, _ := ParseSize(disk.Bytes)
+			cost.Disk += bytes
+		}
+	}
+
+	return cost
+}
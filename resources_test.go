@@ -0,0 +1,139 @@
+package test161
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	sizes := map[string]uint64{
+		"512":  512,
+		"1K":   1024,
+		"32M":  32 * 1024 * 1024,
+		"2g":   2 * 1024 * 1024 * 1024,
+		" 4M ": 4 * 1024 * 1024,
+	}
+	for text, expected := range sizes {
+		size, err := ParseSize(text)
+		assert.Nil(err)
+		assert.Equal(expected, size)
+	}
+
+	for _, text := range []string{"", "M", "1.5M", "-1K", "12Q"} {
+		_, err := ParseSize(text)
+		assert.NotNil(err, text)
+	}
+
+	assert.Equal("512", FormatSize(512))
+	assert.Equal("1536", FormatSize(1536))
+	assert.Equal("32M", FormatSize(32*1024*1024))
+	assert.Equal("2G", FormatSize(2*1024*1024*1024))
+}
+
+func TestParseResources(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	valid := map[string]Resources{
+		"":          Resources{},
+		"unlimited": Resources{},
+		"20":        Resources{Tests: 20},
+		"tests=20 cpus=32 memory=64M disk=4G": Resources{
+			Tests: 20, CPUs: 32, Memory: 64 << 20, Disk: 4 << 30,
+		},
+		"cpus=12.5": Resources{CPUs: 12.5},
+	}
+	for text, expected := range valid {
+		r, err := ParseResources(text)
+		assert.Nil(err)
+		assert.Equal(expected, r)
+	}
+
+	for _, text := range []string{"-1", "cpus", "cpus=-2", "disk=big", "gpus=1", "tests=1.5"} {
+		_, err := ParseResources(text)
+		assert.NotNil(err, text)
+	}
+
+	assert.Equal("unlimited", Resources{}.String())
+	assert.Equal("tests=20 cpus=32 disk=4G", Resources{Tests: 20, CPUs: 32, Disk: 4 << 30}.String())
+}
+
+func TestResourcesFit(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	used := Resources{Tests: 2, CPUs: 6, Memory: 2 << 20, Disk: 32 << 20}
+	cost := Resources{Tests: 1, CPUs: 2, Memory: 1 << 20, Disk: 32 << 20}
+
+	assert.True(Resources{}.fits(used, cost))
+	assert.True(Resources{CPUs: 8}.fits(used, cost))
+	assert.False(Resources{CPUs: 7}.fits(used, cost))
+	assert.False(Resources{Tests: 2}.fits(used, cost))
+	assert.True(Resources{Disk: 64 << 20, Memory: 3 << 20}.fits(used, cost))
+	assert.False(Resources{Disk: 63 << 20}.fits(used, cost))
+
+	assert.Equal(used, used.add(cost).sub(cost))
+}
+
+func TestTestCost(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	test, err := TestFromString(`---
+sys161:
+  cpus: 4
+  ram: 2M
+  disk1:
+    enabled: true
+    bytes: 16M
+misc:
+  weight: 1.5
+---
+q`)
+	assert.Nil(err)
+	if test == nil {
+		t.FailNow()
+	}
+
+	// disk2 isn't enabled
+	assert.Equal(Resources{Tests: 1, CPUs: 6, Memory: 2 << 20, Disk: 16 << 20}, test.Cost())
+
+	// Defaults
+	test, err = TestFromString("---\nname: boot\n---\nq")
+	assert.Nil(err)
+	if test != nil {
+		assert.Equal(Resources{Tests: 1, CPUs: 8, Memory: 1 << 20}, test.Cost())
+	}
+}
+
+func TestManagerResourceCapacity(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	m := newManager()
+	m.Capacity = Resources{CPUs: 8}
+	m.start()
+	defer m.stop()
+
+	// A job that's too big can still run by itself
+	assert.True(m.hasCapacity(Resources{Tests: 1, CPUs: 16}))
+
+	m.l.Lock()
+	m.stats.Running = 1
+	m.used = Resources{Tests: 1, CPUs: 6}
+	m.l.Unlock()
+
+	assert.True(m.hasCapacity(Resources{Tests: 1, CPUs: 2}))
+	assert.False(m.hasCapacity(Resources{Tests: 1, CPUs: 4}))
+
+	// The big job at the front of the queue blocks smaller ones behind it
+	done := make(chan *Test161JobResult)
+	m.submit(&test161Job{Test: &Test{}, DoneChan: done, Cost: Resources{Tests: 1, CPUs: 4}})
+	m.submit(&test161Job{Test: &Test{}, DoneChan: done, Cost: Resources{Tests: 1, CPUs: 1}})
+	assert.Equal(uint(2), m.Stats().Queued)
+	assert.Equal(Resources{CPUs: 8}, m.Stats().Capacity)
+	assert.Equal(Resources{Tests: 1, CPUs: 6}, m.Stats().InUse)
+}
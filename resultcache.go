@@ -0,0 +1,200 @@
+package test161
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ResultCache stores the results of tests that passed, indexed by a hash of
+// everything the result depends on: the kernel, the userland binaries the
+// test runs, the test's merged configuration and commands, the command
+// templates, and the sys161 random seed. If none of these change, running the
+// test again can reuse the cached result instead. Any change to the inputs
+// changes the key, so stale results are never used.
+//
+// sys161 normally gets a new random seed for every run, which would make
+// every key different. Tests run with a ResultCache get a seed derived from
+// their other inputs instead, so a cached result is the result of running the
+// test with the same seed.
+type ResultCache struct {
+	dir string
+}
+
+// A cached result
+type resultCacheEntry struct {
+	Time time.Time `json:"time"`
+	Test *Test     `json:"test"`
+}
+
+// Create a result cache that stores its entries in dir.
+func NewResultCache(dir string) *ResultCache {
+	return &ResultCache{dir}
+}
+
+func (rc *ResultCache) file(key string) string {
+	return path.Join(rc.dir, key+".json")
+}
+
+// Look up a cached result. Missing or unreadable entries are just misses.
+func (rc *ResultCache) load(key string) (*resultCacheEntry, bool) {
+	data, err := ioutil.ReadFile(rc.file(key))
+	if err != nil {
+		return nil, false
+	}
+
+	entry := &resultCacheEntry{}
+	if err = json.Unmarshal(data, entry); err != nil || entry.Test == nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Save the result of a test that passed.
+func (rc *ResultCache) store(key string, t *Test) error {
+	data, err := json.Marshal(&resultCacheEntry{time.Now(), t})
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(rc.dir, 0770); err != nil {
+		return err
+	}
+
+	// Write then rename so concurrent runs never see partial entries
+	tmp, err := ioutil.TempFile(rc.dir, key+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), rc.file(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Hash a file from the root directory. Missing files are hashed as such; the
+// test will fail to run them anyway.
+func hashRootFile(h hash.Hash, rootDir, file string) {
+	fmt.Fprintf(h, "file %v\n", file)
+
+	f, err := os.Open(path.Join(rootDir, file))
+	if err != nil {
+		fmt.Fprintf(h, "missing\n")
+		return
+	}
+	defer f.Close()
+
+	fh := sha256.New()
+	if _, err = io.Copy(fh, f); err != nil {
+		fmt.Fprintf(h, "unreadable\n")
+		return
+	}
+	fmt.Fprintf(h, "%x\n", fh.Sum(nil))
+}
+
+// The root directory files a test depends on: the kernel, the shell if the
+// test uses it, and any programs the test runs.
+func (t *Test) inputFiles() []string {
+	files := []string{"kernel"}
+	seen := map[string]bool{"kernel": true}
+
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, c := range t.Commands {
+		if c.Type != "user" {
+			continue
+		}
+		if !strings.HasPrefix(c.Input.Line, "p ") {
+			add("bin/sh")
+		}
+		if id := c.Id(); strings.HasPrefix(id, "/") {
+			add(strings.TrimPrefix(id, "/"))
+		}
+	}
+
+	return files
+}
+
+// Compute the test's result cache key, fixing its random seed along the way.
+// The test's configuration must already be merged.
+func (t *Test) resultCacheKey(env *TestEnvironment) (string, error) {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "test %v\n", t.DependencyID)
+	for _, file := range t.inputFiles() {
+		hashRootFile(h, env.RootDir, file)
+	}
+
+	// Everything else goes in as JSON. The seed is left out here since it's
+	// derived from the rest.
+	sys161 := t.Sys161
+	sys161.Random = 0
+
+	templates := make(map[string]*CommandTemplate)
+	points := make([]uint, 0, len(t.Commands))
+	for _, c := range t.Commands {
+		templates[c.Id()] = env.Commands[c.Id()]
+		points = append(points, c.PointsAvailable)
+	}
+
+	inputs := []interface{}{
+		t.Content, t.Params, t.CommandOverrides,
+		sys161, t.Stat, t.Monitor, t.CommandConf, t.Misc,
+		templates,
+		t.PointsAvailable, t.ScoringMethod, t.MemLeakPoints, points,
+	}
+	for _, input := range inputs {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return "", err
+		}
+		h.Write(data)
+		h.Write([]byte("\n"))
+	}
+
+	// Seed sys161 from the inputs, using the same range as random seeds
+	sum := h.Sum(nil)
+	t.Sys161.Random = binary.BigEndian.Uint32(sum) >> 16
+	fmt.Fprintf(h, "seed %v\n", t.Sys161.Random)
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Reuse a cached result for the test if there is one. The caller must have
+// merged the test's configuration.
+func (t *Test) useCachedResult(entry *resultCacheEntry) bool {
+	if err := t.applyRemote(entry.Test); err != nil {
+		return false
+	}
+	t.Cached = true
+	t.startTime = time.Now().UnixNano()
+	t.addStatus("cached", "result from "+entry.Time.Format("2006-01-02 15:04:05"))
+	return true
+}
+
+// Save a passing result to the environment's cache. Errors are logged since
+// they shouldn't affect the test results.
+func (env *TestEnvironment) cacheResult(key string, t *Test) {
+	if err := env.ResultCache.store(key, t); err != nil && env.Log != nil {
+		env.Log.Println("Error saving cached result:", err)
+	}
+}
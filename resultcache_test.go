@@ -0,0 +1,109 @@
+package test161
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A test with its configuration merged, as it is in Run when the cache key is
+// computed.
+func mergedTest(t *testing.T, env *TestEnvironment, text string) *Test {
+	test, err := TestFromString(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.SetEnv(env)
+	if err = test.MergeAllDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	return test
+}
+
+func resultCacheEnv(t *testing.T) *TestEnvironment {
+	env := defaultEnv.CopyEnvironment()
+	env.RootDir = t.TempDir()
+	env.ResultCache = NewResultCache(t.TempDir())
+	if err := ioutil.WriteFile(path.Join(env.RootDir, "kernel"), []byte("kernel"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestResultCacheKey(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	env := resultCacheEnv(t)
+
+	test := mergedTest(t, env, "q")
+	key, err := test.resultCacheKey(env)
+	assert.Nil(err)
+	seed := test.Sys161.Random
+
+	// Same inputs, same key and seed
+	test = mergedTest(t, env, "q")
+	other, err := test.resultCacheKey(env)
+	assert.Nil(err)
+	assert.Equal(key, other)
+	assert.Equal(seed, test.Sys161.Random)
+
+	// Different configuration
+	test = mergedTest(t, env, "q")
+	test.Sys161.CPUs += 1
+	other, _ = test.resultCacheKey(env)
+	assert.NotEqual(key, other)
+
+	// Different commands
+	test = mergedTest(t, env, "sem1\nq")
+	other, _ = test.resultCacheKey(env)
+	assert.NotEqual(key, other)
+
+	// Different kernel
+	assert.Nil(ioutil.WriteFile(path.Join(env.RootDir, "kernel"), []byte("new kernel"), 0664))
+	test = mergedTest(t, env, "q")
+	other, _ = test.resultCacheKey(env)
+	assert.NotEqual(key, other)
+}
+
+func TestResultCacheInputFiles(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	test, err := TestFromString("p /testbin/forktest\n$ /bin/true\nq")
+	assert.Nil(err)
+	assert.Equal([]string{"kernel", "testbin/forktest", "bin/sh", "bin/true"}, test.inputFiles())
+}
+
+func TestResultCacheHit(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	env := resultCacheEnv(t)
+
+	// Pretend a run passed
+	test := mergedTest(t, env, "q")
+	key, err := test.resultCacheKey(env)
+	assert.Nil(err)
+	test.Result = TEST_RESULT_CORRECT
+	test.Status = []Status{{Status: "started"}, {Status: "shutdown"}}
+	for _, c := range test.Commands {
+		c.Status = COMMAND_STATUS_CORRECT
+	}
+	assert.Nil(env.ResultCache.store(key, test))
+
+	// The cached result is used without running sys161
+	test, err = TestFromString("q")
+	assert.Nil(err)
+	assert.Nil(test.Run(env))
+	assert.True(test.Cached)
+	assert.Equal(TEST_RESULT_CORRECT, test.Result)
+	if assert.Equal(3, len(test.Status)) {
+		assert.Equal("cached", test.Status[2].Status)
+	}
+	for _, c := range test.Commands {
+		assert.Equal(COMMAND_STATUS_CORRECT, c.Status)
+	}
+}
@@ -0,0 +1,172 @@
+package test161
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Saved results, as written by TestGroup.OutputJSON and Test.OutputJSON, can
+// be loaded back into a TestGroup to look at them again. The tests aren't set
+// up to run again, but have everything needed to print them.
+
+// The group name for results that don't have one, such as a single test.
+const RESULTS_GROUP_NAME = "results"
+
+// ResultsFromJSON reconstructs a TestGroup from a serialized group, a single
+// test, or a list of tests.
+func ResultsFromJSON(data []byte) (*TestGroup, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("No results found")
+	}
+
+	tg := EmptyGroup()
+	tests := make([]*Test, 0)
+
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &tests); err != nil {
+			return nil, err
+		}
+	} else {
+		fields := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+		if _, ok := fields["Tests"]; ok {
+			if err := json.Unmarshal(data, tg); err != nil {
+				return nil, err
+			}
+			for _, test := range tg.Tests {
+				tests = append(tests, test)
+			}
+			tg.Tests = make(map[string]*Test)
+		} else {
+			test := &Test{}
+			if err := json.Unmarshal(data, test); err != nil {
+				return nil, err
+			}
+			tests = append(tests, test)
+		}
+	}
+
+	if err := tg.addResults(tests); err != nil {
+		return nil, err
+	}
+	return tg, nil
+}
+
+// Add loaded tests to the group, indexed by dependency ID.
+func (tg *TestGroup) addResults(tests []*Test) error {
+	for _, test := range tests {
+		if test == nil {
+			continue
+		}
+		if len(test.DependencyID) == 0 {
+			test.DependencyID = test.Name
+		}
+		if len(test.DependencyID) == 0 {
+			test.DependencyID = test.ID
+		}
+		if _, ok := tg.Tests[test.DependencyID]; ok {
+			return fmt.Errorf("Duplicate test in results: %v", test.DependencyID)
+		}
+		for _, cmd := range test.Commands {
+			cmd.Test = test
+		}
+		tg.Tests[test.DependencyID] = test
+	}
+
+	if len(tg.Tests) == 0 {
+		return errors.New("No results found")
+	}
+
+	if tg.Config == nil {
+		tg.Config = &GroupConfig{Name: RESULTS_GROUP_NAME}
+		if len(tests) == 1 {
+			tg.Config.Name = tests[0].DependencyID
+		}
+	}
+	return nil
+}
+
+// LoadResults loads results saved to a file with OutputJSON.
+func LoadResults(file string) (*TestGroup, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tg, err := ResultsFromJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read results from %v: %v", file, err)
+	}
+	return tg, nil
+}
+
+var (
+	ErrUnknownSubmission   = errors.New("Unknown submission")
+	ErrSubmissionForbidden = errors.New("Only staff and the submission's users can see its results")
+)
+
+// SubmissionTestsRequest asks the server for the tests of a submission, so
+// that they can be looked at with 'test161 show'. Staff can see any
+// submission; students can only see their own.
+type SubmissionTestsRequest struct {
+	Users        []*SubmissionUserInfo
+	SubmissionID string
+}
+
+// Results authenticates the users and looks up the submission's tests.
+func (req *SubmissionTestsRequest) Results(env *TestEnvironment) (*TestGroup, error) {
+	if env.Persistence == nil || !env.Persistence.CanRetrieve() {
+		return nil, errors.New("Unable to look up submissions")
+	}
+	if len(req.SubmissionID) == 0 {
+		return nil, errors.New("No submission specified")
+	}
+
+	students, err := validateUsers(req.Users, env)
+	if err != nil {
+		return nil, err
+	}
+
+	submissions := []*Submission{}
+	who := map[string]interface{}{"_id": req.SubmissionID}
+	if err = env.Persistence.Retrieve(PERSIST_TYPE_SUBMISSIONS, who, nil, &submissions); err != nil {
+		return nil, err
+	}
+	if len(submissions) != 1 {
+		return nil, ErrUnknownSubmission
+	}
+	submission := submissions[0]
+
+	// validateUsers makes sure the users are all staff or all students
+	if staff, err := students[0].IsStaff(env); err != nil {
+		return nil, err
+	} else if !staff {
+		for _, student := range students {
+			found := false
+			for _, email := range submission.Users {
+				found = found || email == student.Email
+			}
+			if !found {
+				return nil, ErrSubmissionForbidden
+			}
+		}
+	}
+
+	tests := []*Test{}
+	who = map[string]interface{}{"submission_id": submission.ID}
+	if err = env.Persistence.Retrieve(PERSIST_TYPE_TESTS, who, nil, &tests); err != nil {
+		return nil, err
+	}
+
+	tg := EmptyGroup()
+	tg.Config = &GroupConfig{Name: submission.TargetName}
+	if err = tg.addResults(tests); err != nil {
+		return nil, err
+	}
+	return tg, nil
+}
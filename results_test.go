@@ -0,0 +1,100 @@
+package test161
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultsFromJSON(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	// A group
+	text, err := reportGroup(t).OutputJSON()
+	assert.Nil(err)
+	tg, err := ResultsFromJSON([]byte(text))
+	if assert.Nil(err) {
+		assert.Equal("asst1", tg.Config.Name)
+		assert.Equal(3, len(tg.Tests))
+		test := tg.Tests["sync/lt1.t"]
+		if assert.NotNil(test) {
+			assert.Equal(TEST_RESULT_INCORRECT, test.Result)
+			assert.Equal("lt1: FAIL", test.Commands[1].Output[0].Line)
+			assert.Equal(test, test.Commands[1].Test)
+		}
+	}
+
+	// A single test
+	text, err = reportGroup(t).Tests["sync/sem1.t"].OutputJSON()
+	assert.Nil(err)
+	tg, err = ResultsFromJSON([]byte(text))
+	if assert.Nil(err) {
+		assert.Equal("sync/sem1.t", tg.Config.Name)
+		assert.Equal(uint(10), tg.EarnedPoints())
+	}
+
+	// A list of tests
+	tests := []*Test{}
+	for _, test := range reportGroup(t).Tests {
+		tests = append(tests, test)
+	}
+	data, err := json.Marshal(tests)
+	assert.Nil(err)
+	tg, err = ResultsFromJSON(data)
+	if assert.Nil(err) {
+		assert.Equal(RESULTS_GROUP_NAME, tg.Config.Name)
+		assert.Equal(3, len(tg.Tests))
+	}
+
+	// Duplicates and nothing at all
+	data, err = json.Marshal([]*Test{tests[0], tests[0]})
+	assert.Nil(err)
+	_, err = ResultsFromJSON(data)
+	assert.NotNil(err)
+	_, err = ResultsFromJSON([]byte(" "))
+	assert.NotNil(err)
+	_, err = ResultsFromJSON([]byte("[]"))
+	assert.NotNil(err)
+
+	_, err = LoadResults("fixtures/missing.json")
+	assert.NotNil(err)
+}
+
+func TestSubmissionTestsRequest(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	tg := reportGroup(t)
+	persistence := &TestingPersistence{
+		Submissions: []*Submission{{ID: "sub1", Users: []string{"student@test161.ops-class.org"}, TargetName: "asst1"}},
+	}
+	for _, test := range tg.Tests {
+		test.SubmissionID = "sub1"
+		persistence.Tests = append(persistence.Tests, test)
+	}
+	env := &TestEnvironment{Persistence: persistence}
+
+	users := []*SubmissionUserInfo{{Email: testStudent.Email, Token: testStudent.Token}}
+
+	// testStudent is staff, so it can see other students' submissions
+	req := &SubmissionTestsRequest{Users: users, SubmissionID: "sub1"}
+	res, err := req.Results(env)
+	if assert.Nil(err) {
+		assert.Equal("asst1", res.Config.Name)
+		assert.Equal(3, len(res.Tests))
+		assert.Equal(uint(10), res.EarnedPoints())
+	}
+
+	req.SubmissionID = "sub2"
+	_, err = req.Results(env)
+	assert.Equal(ErrUnknownSubmission, err)
+
+	req = &SubmissionTestsRequest{
+		Users:        []*SubmissionUserInfo{{Email: testStudent.Email, Token: "wrong"}},
+		SubmissionID: "sub1",
+	}
+	_, err = req.Results(env)
+	assert.NotNil(err)
+}
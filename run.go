@@ -21,6 +21,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jay1999ke/test161/expect"
@@ -43,6 +44,7 @@ type Test struct {
 	Description string   `yaml:"description" json:"description"`
 	Tags        []string `yaml:"tags" json:"tags"`
 	Depends     []string `yaml:"depends" json:"depends"`
+	Extends     string   `yaml:"extends" json:"extends,omitempty"`
 
 	// Configuration chunks
 	Sys161           Sys161Conf         `yaml:"sys161" json:"sys161"`
@@ -52,6 +54,11 @@ type Test struct {
 	Misc             MiscConf           `yaml:"misc" json:"misc"`
 	CommandOverrides []*CommandTemplate `yaml:"commandoverrides" json:"-"`
 
+	// Parameter matrix. Each combination of values becomes its own test
+	// instance, and Params holds the combination for that instance.
+	Matrix map[string][]interface{} `yaml:"matrix" json:"-" bson:"-"`
+	Params map[string]string        `yaml:"-" json:"params,omitempty" bson:"params,omitempty"`
+
 	// Actual test commands to run
 	Content string `fm:"content" yaml:"-" json:"-" bson:"-"`
 
@@ -72,6 +79,16 @@ type Test struct {
 	ExpandedDeps map[string]*Test `json:"-" bson:"-"`
 	IsDependency bool             `json:"isdependency"`
 
+	// Whether the result came from the ResultCache instead of running
+	Cached bool `json:"cached,omitempty" bson:"cached,omitempty"`
+
+	// Where the wall clock time went (see timing.go)
+	Timing *TestTiming `json:"timing,omitempty" bson:"timing,omitempty"`
+
+	// Weak dependencies that didn't pass. The test ran anyway, but with a
+	// failed prerequisite.
+	FailedPrereqs []string `json:"failed_prereqs,omitempty" bson:"failed_prereqs,omitempty"`
+
 	// Grading.  These are set when the test is being run as part of a Target.
 	PointsAvailable uint   `json:"points_avail" bson:"points_avail"`
 	PointsEarned    uint   `json:"points_earned" bson:"points_earned"`
@@ -81,6 +98,14 @@ type Test struct {
 	// The reason the test is being run. This could be 1 or more targets.
 	requiredBy map[string]bool
 
+	// The base tests and fragments this test inherited from, nearest first.
+	inheritedFrom []string
+
+	// Expanded dependency id -> the depends entry that matched it, and the
+	// kind of dependency
+	depSources map[string]string
+	depKinds   map[string]DependencyKind
+
 	// Memory leak detection
 	MemLeakBytes    int  `json:"mem_leak_bytes" bson:"mem_leak_bytes"`       // How much are they leaking?
 	MemLeakChecked  bool `json:"mem_leak_checked" bson:"mem_leak_checked"`   // Did we even check?
@@ -92,6 +117,7 @@ type Test struct {
 	startTime   int64            // Only set once
 	statStarted bool             // Only changed once
 	env         *TestEnvironment // Set at top of Run
+	queueWait   TimeFixedPoint   // Set by the manager before Run
 	allCorrect  bool
 	salts       map[string]bool // salt values we've already seen
 
@@ -108,6 +134,12 @@ type Test struct {
 	statErr    error
 	statRecord bool // Protected by statCond.L
 
+	// Cancellation. cancelled is set by Cancel, and kill is set once sys161
+	// starts. Both are accessed atomically since Cancel can be called at any
+	// time.
+	cancelled int32
+	kill      atomic.Value
+
 	// Output channels
 	statChan chan Stat // Nonblocking write
 }
@@ -161,9 +193,19 @@ type Command struct {
 	EndTime   TimeFixedPoint `json:"endtime"`
 	TimedOut  bool           `json:"timedout"`
 
+	// Wall clock times, relative to the start of the test, for timing.go
+	wallStartTime TimeFixedPoint
+	wallEndTime   TimeFixedPoint
+	typingTime    TimeFixedPoint // Time spent sending the command line
+
 	// Set during evaluation
 	Status string `json:"status"`
 
+	// Set during evaluation of incorrect commands (see diff.go)
+	FailReason string         `json:"fail_reason,omitempty" bson:"fail_reason,omitempty"`
+	Matches    []*OutputMatch `json:"matches,omitempty" bson:"matches,omitempty"`
+	Diff       string         `json:"diff,omitempty" bson:"diff,omitempty"`
+
 	// Backwards pointer to the Test. This needs to be public for printing
 	Test *Test `json:"-" bson:"-"`
 }
@@ -181,6 +223,9 @@ type OutputLine struct {
 	Line     string         `json:"line"`
 	Trusted  bool           `json:"trusted"`
 	KeyName  string         `json:"keyname"`
+
+	// Why a secure line failed verification
+	VerifyError string `json:"verify_error,omitempty" bson:"verify_error,omitempty"`
 }
 
 type Status struct {
@@ -254,6 +299,12 @@ func (t *Test) Run(env *TestEnvironment) (err error) {
 		env.notifyAndLogErr("Test Complete", t, MSG_PERSIST_COMPLETE, 0)
 	}()
 
+	if t.isCancelled() {
+		t.addStatus("aborted", "cancelled")
+		t.Result = TEST_RESULT_ABORT
+		return errTestCancelled
+	}
+
 	err = t.MergeAllDefaults()
 	if err != nil {
 		t.addStatus("aborted", "")
@@ -261,6 +312,22 @@ func (t *Test) Run(env *TestEnvironment) (err error) {
 		return
 	}
 
+	// Reuse an earlier passing result if none of the test's inputs changed,
+	// and cache this one if it passes.
+	if env.ResultCache != nil {
+		if key, kerr := t.resultCacheKey(env); kerr != nil {
+			env.Log.Println("Error computing result cache key:", kerr)
+		} else if entry, ok := env.ResultCache.load(key); ok && t.useCachedResult(entry) {
+			return nil
+		} else {
+			defer func() {
+				if err == nil && t.Result == TEST_RESULT_CORRECT {
+					env.cacheResult(key, t)
+				}
+			}()
+		}
+	}
+
 	// Create temp directory.
 	tempRoot, err := ioutil.TempDir(t.Misc.TempDir, "test161")
 	if err != nil {
@@ -365,6 +432,7 @@ func (t *Test) Run(env *TestEnvironment) (err error) {
 		t.Result = TEST_RESULT_ABORT
 		return err
 	}
+	defer t.updateTiming()
 	defer t.stop161()
 	t.addStatus("started", "")
 
@@ -385,10 +453,12 @@ func (t *Test) Run(env *TestEnvironment) (err error) {
 		if t.commandCounter != 0 {
 			t.currentCommand.Status = COMMAND_STATUS_RUNNING
 			t.currentCommand.StartTime = t.SimTime
+			t.currentCommand.wallStartTime = t.getWallTime()
 
 			// Broadcast current command
 			env.notifyAndLogErr("Command Status", t.currentCommand, MSG_PERSIST_UPDATE, MSG_FIELD_STATUS)
 			err = t.sendCommand(t.currentCommand.Input.Line + "\n")
+			t.currentCommand.typingTime = t.getWallTime() - t.currentCommand.wallStartTime
 
 			if err != nil {
 				// If we can't send the command, it's most likey a broken kernel
@@ -500,6 +570,12 @@ func (t *Test) Run(env *TestEnvironment) (err error) {
 		t.Commands = t.Commands[0 : t.commandCounter+1]
 	}
 
+	if t.isCancelled() {
+		// Whatever happened after sys161 was killed doesn't count
+		t.addStatus("aborted", "cancelled")
+		err = errTestCancelled
+	}
+
 	if err == nil {
 		t.finishAndEvaluate()
 	} else {
@@ -509,12 +585,29 @@ func (t *Test) Run(env *TestEnvironment) (err error) {
 	return err
 }
 
+var errTestCancelled = errors.New("Test cancelled")
+
+// Cancel stops the test. If the test is running, sys161 is killed, and if it
+// hasn't started yet, it won't. Either way, the test is aborted. Cancel is
+// safe to call from any goroutine, at any time.
+func (t *Test) Cancel() {
+	atomic.StoreInt32(&t.cancelled, 1)
+	if kill, ok := t.kill.Load().(func()); ok {
+		kill()
+	}
+}
+
+func (t *Test) isCancelled() bool {
+	return atomic.LoadInt32(&t.cancelled) != 0
+}
+
 func (t *Test) finishCurCommand(env *TestEnvironment, eof bool) *Command {
 
 	t.L.Lock()
 	defer t.L.Unlock()
 
 	t.currentCommand.EndTime = t.SimTime
+	t.currentCommand.wallEndTime = t.getWallTime()
 
 	// Rotate running command to the next command, saving any previous
 	// output as needed.
@@ -664,6 +757,12 @@ func (t *Test) start161() error {
 	t.sys161 = expect.Create(pty, killer, t, time.Duration(t.Misc.PromptTimeout)*time.Second)
 	t.startTime = time.Now().UnixNano()
 
+	// If we were cancelled while starting, Cancel might not have seen kill
+	t.kill.Store(func() { run.Process.Kill() })
+	if t.isCancelled() {
+		run.Process.Kill()
+	}
+
 	return nil
 }
 
@@ -768,6 +867,7 @@ var partialCreditExp *regexp.Regexp = regexp.MustCompile(`^.*PARTIAL CREDIT ([0-
 // Evaluate a single command, setting its status and points
 func (c *Command) evaluate(keyMap map[string]string, eof bool) {
 	c.PointsEarned = 0
+	defer c.explainFailure(keyMap, eof)
 
 	// The test already checks these two, but this is handy for unit testing the
 	// grading logic.
@@ -797,26 +897,14 @@ func (c *Command) evaluate(keyMap map[string]string, eof bool) {
 
 	// We're expecting something. First check if we got exactly what we're
 	// looking for (it's OK if there are extra output lines).
-	expectedIndex, actualIndex := 0, 0
-	for actualIndex < len(c.Output) && expectedIndex < len(c.ExpectedOutput) {
-		expected := c.ExpectedOutput[expectedIndex]
-		actual := c.Output[actualIndex]
-
-		if actual.Line == expected.Text {
-			// We only count this as a match if the message is verified or we don't
-			// care about keys.  The latter happens if the command specifically tells
-			// us that, or the keyMap is empty - which happens on the client side.
-			_, hasKey := keyMap[expected.KeyName]
-			if !expected.Trusted || !hasKey || (actual.Trusted && actual.KeyName == expected.KeyName) {
-				expectedIndex++
-			}
-		}
-		actualIndex++
-	}
+	// We only count a line as a match if the message is verified or we don't
+	// care about keys.  The latter happens if the command specifically tells
+	// us that, or the keyMap is empty - which happens on the client side.
+	matched := matchExpectedOutput(c.ExpectedOutput, c.Output, keyMap)
 
 	// If we've matched all expected lines, the command succeeded and full
 	// points are awarded (if there are any).
-	if expectedIndex == len(c.ExpectedOutput) {
+	if len(matched) == len(c.ExpectedOutput) {
 		c.Status = COMMAND_STATUS_CORRECT
 		c.PointsEarned = c.PointsAvailable
 	} else {
@@ -899,6 +987,7 @@ func (t *Test) outputLineComplete() {
 		if ok, _ := t.salts[salt]; ok {
 			t.env.Log.Printf("Test ID %v  Salt value failed uniqueness requirement\n", t.ID)
 			line.Trusted = false
+			line.VerifyError = VERIFY_REUSED_SALT
 			return
 		}
 
@@ -912,6 +1001,11 @@ func (t *Test) outputLineComplete() {
 			line.Trusted = true
 			line.KeyName = id
 			line.Line = res[4]
+		} else if _, ok := t.env.keyMap[id]; ok {
+			line.VerifyError = VERIFY_BAD_HMAC
+		} else if len(t.env.keyMap) > 0 {
+			// Without any keys (e.g. on the client), we can't verify anything
+			line.VerifyError = VERIFY_UNKNOWN_KEY
 		}
 	}
 
@@ -629,3 +629,20 @@ Operation took 1.215512161 seconds
 	assert.Equal(COMMAND_STATUS_INCORRECT, c.Status)
 	assert.Equal(uint(0), c.PointsEarned)
 }
+
+func TestRunCancelled(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	test, err := TestFromString("q")
+	assert.Nil(err)
+
+	// A cancelled test never starts sys161
+	test.Cancel()
+	assert.NotNil(test.Run(defaultEnv))
+	assert.Equal(TEST_RESULT_ABORT, test.Result)
+	if assert.Equal(1, len(test.Status)) {
+		assert.Equal("aborted", test.Status[0].Status)
+		assert.Equal("cancelled", test.Status[0].Message)
+	}
+}
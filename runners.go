@@ -59,7 +59,7 @@ func (r *SimpleRunner) Run() <-chan *Test161JobResult {
 
 	// Spawn every job at once (no dependency tracking)
 	for _, test := range r.group.Tests {
-		job := &test161Job{test, env, resChan}
+		job := newJob(r.group, test, resChan, 0)
 		env.manager.SubmitChan <- job
 	}
 
@@ -74,6 +74,7 @@ func (r *SimpleRunner) Run() <-chan *Test161JobResult {
 			default:
 			}
 		}
+		env.saveWallTimes()
 		close(callbackChan)
 	}()
 
@@ -91,6 +92,9 @@ func (r *DependencyRunner) Group() *TestGroup {
 
 // Holding pattern.  An individual test waits here until all of its
 // dependencies have been met or failed, in which case it runs or aborts.
+// Only hard dependencies that fail cause the test to abort; order-only
+// dependencies just need to finish, and weak dependencies that fail are
+// recorded in FailedPrereqs.
 func waitForDeps(test *Test, depChan, readyChan, abortChan chan *Test) {
 	// Copy deps
 	deps := make(map[string]bool)
@@ -101,9 +105,15 @@ func waitForDeps(test *Test, depChan, readyChan, abortChan chan *Test) {
 	for len(deps) > 0 {
 		res := <-depChan
 		if _, ok := deps[res.DependencyID]; ok {
+			delete(deps, res.DependencyID)
 			if res.Result == TEST_RESULT_CORRECT {
-				delete(deps, res.DependencyID)
-			} else {
+				continue
+			}
+			switch test.DependencyKind(res.DependencyID) {
+			case DEP_ORDER:
+			case DEP_WEAK:
+				test.FailedPrereqs = append(test.FailedPrereqs, res.DependencyID)
+			default:
 				test.Result = TEST_RESULT_SKIP
 				abortChan <- test
 				return
@@ -155,6 +165,10 @@ func (r *DependencyRunner) Run() <-chan *Test161JobResult {
 		}
 	}
 
+	// Tests on the longest remaining path get to run first
+	env := r.group.Config.Env
+	priorities := r.group.criticalPathPriorities(env.WallTimes)
+
 	// Spawn all the tests and put them in a waiting pattern
 	for id, test := range r.group.Tests {
 		// Buffer this so we eliminate races during setup
@@ -169,7 +183,6 @@ func (r *DependencyRunner) Run() <-chan *Test161JobResult {
 	go func() {
 		//We're done as soon as we recieve the final result from the manager.
 		results := 0
-		env := r.group.Config.Env
 
 		for results < len(r.group.Tests) {
 			select {
@@ -181,6 +194,7 @@ func (r *DependencyRunner) Run() <-chan *Test161JobResult {
 			case test := <-abortChan:
 				// Abort!
 				delete(waiting, test.DependencyID)
+				env.notifyAndLogErr("Test Skipped", test, MSG_PERSIST_COMPLETE, 0)
 				bcast(test)
 				callback(&Test161JobResult{test, nil})
 				results += 1
@@ -188,10 +202,11 @@ func (r *DependencyRunner) Run() <-chan *Test161JobResult {
 			case test := <-readyChan:
 				// We have a test that can run.
 				delete(waiting, test.DependencyID)
-				job := &test161Job{test, env, resChan}
+				job := newJob(r.group, test, resChan, priorities[test.DependencyID])
 				env.manager.SubmitChan <- job
 			}
 		}
+		env.saveWallTimes()
 		close(callbackChan)
 	}()
 
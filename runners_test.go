@@ -3,6 +3,7 @@ package test161
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"path"
 	"testing"
 )
 
@@ -67,7 +68,7 @@ func TestRunnerCapacity(t *testing.T) {
 	caps := []uint{0, 1, 3, 5}
 
 	for i := 0; i < 4; i++ {
-		env.manager.Capacity = caps[i]
+		env.manager.Capacity = Resources{Tests: caps[i]}
 		r := runnerFromConfig(t, config, expected)
 
 		env.manager.start()
@@ -90,8 +91,8 @@ func TestRunnerCapacity(t *testing.T) {
 		assert.Equal(len(expected), count)
 		assert.Equal(uint(len(expected)), env.manager.stats.Finished)
 
-		if env.manager.Capacity > 0 {
-			assert.True(env.manager.stats.HighRunning <= env.manager.Capacity)
+		if env.manager.Capacity.Tests > 0 {
+			assert.True(env.manager.stats.HighRunning <= env.manager.Capacity.Tests)
 		}
 
 		t.Log(fmt.Sprintf("High count: %v High queue: %v Finished: %v",
@@ -167,7 +168,7 @@ func TestRunnerDependency(t *testing.T) {
 	}
 
 	r := runnerFromConfig(t, config, expected)
-	env.manager.Capacity = 0
+	env.manager.Capacity = Resources{}
 	env.manager.start()
 	done := r.Run()
 
@@ -255,7 +256,7 @@ func TestRunnerAbort(t *testing.T) {
 	}
 
 	r := runnerFromConfig(t, config, expected)
-	env.manager.Capacity = 0
+	env.manager.Capacity = Resources{}
 	env.manager.start()
 	done := r.Run()
 
@@ -331,7 +332,7 @@ func TestRunnersParallel(t *testing.T) {
 
 	syncChan := make(chan int)
 
-	env.manager.Capacity = 10
+	env.manager.Capacity = Resources{Tests: 10}
 	env.manager.start()
 
 	for index, runner := range runners {
@@ -364,11 +365,159 @@ func TestRunnersParallel(t *testing.T) {
 
 	env.manager.stop()
 
-	if env.manager.Capacity > 0 {
-		assert.True(env.manager.stats.HighRunning <= env.manager.Capacity)
+	if env.manager.Capacity.Tests > 0 {
+		assert.True(env.manager.stats.HighRunning <= env.manager.Capacity.Tests)
 	}
 
 	t.Log(fmt.Sprintf("High count: %v High queue: %v Finished: %v",
 		env.manager.stats.HighRunning, env.manager.stats.HighQueued, env.manager.stats.Finished))
 
 }
+
+func TestRunnerWaitForDepKinds(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	deps := map[string]*Test{
+		"boot.t":     &Test{DependencyID: "boot.t"},
+		"sync/lt1.t": &Test{DependencyID: "sync/lt1.t"},
+		"sync/lt2.t": &Test{DependencyID: "sync/lt2.t"},
+	}
+
+	newTest := func() *Test {
+		return &Test{
+			DependencyID: "sync/cvt1.t",
+			ExpandedDeps: deps,
+			depKinds: map[string]DependencyKind{
+				"boot.t":     DEP_HARD,
+				"sync/lt1.t": DEP_WEAK,
+				"sync/lt2.t": DEP_ORDER,
+			},
+		}
+	}
+
+	wait := func(test *Test, results map[string]TestResult) *Test {
+		depChan := make(chan *Test, len(results))
+		readyChan := make(chan *Test, 1)
+		abortChan := make(chan *Test, 1)
+		for _, id := range []string{"boot.t", "sync/lt1.t", "sync/lt2.t"} {
+			depChan <- &Test{DependencyID: id, Result: results[id]}
+		}
+		waitForDeps(test, depChan, readyChan, abortChan)
+		select {
+		case <-readyChan:
+			return test
+		case <-abortChan:
+			return nil
+		}
+	}
+
+	// Weak and order-only failures still run
+	test := wait(newTest(), map[string]TestResult{
+		"boot.t":     TEST_RESULT_CORRECT,
+		"sync/lt1.t": TEST_RESULT_INCORRECT,
+		"sync/lt2.t": TEST_RESULT_SKIP,
+	})
+	assert.NotNil(test)
+	if test != nil {
+		assert.Equal([]string{"sync/lt1.t"}, test.FailedPrereqs)
+	}
+
+	// Everything passed
+	test = wait(newTest(), map[string]TestResult{
+		"boot.t":     TEST_RESULT_CORRECT,
+		"sync/lt1.t": TEST_RESULT_CORRECT,
+		"sync/lt2.t": TEST_RESULT_CORRECT,
+	})
+	assert.NotNil(test)
+	if test != nil {
+		assert.Equal(0, len(test.FailedPrereqs))
+	}
+
+	// Hard failures skip
+	skipped := newTest()
+	test = wait(skipped, map[string]TestResult{
+		"boot.t":     TEST_RESULT_INCORRECT,
+		"sync/lt1.t": TEST_RESULT_CORRECT,
+		"sync/lt2.t": TEST_RESULT_CORRECT,
+	})
+	assert.Nil(test)
+	assert.Equal(TEST_RESULT_SKIP, skipped.Result)
+}
+
+func TestWallTimes(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	file := path.Join(t.TempDir(), "walltimes.json")
+
+	wt, err := LoadWallTimes(file)
+	assert.Nil(err)
+	if wt == nil {
+		t.FailNow()
+	}
+
+	_, ok := wt.Get("boot.t")
+	assert.False(ok)
+
+	// Skipped tests don't count, and later times are averaged in
+	wt.Record(&Test{DependencyID: "boot.t", Result: TEST_RESULT_SKIP, WallTime: 5.0})
+	_, ok = wt.Get("boot.t")
+	assert.False(ok)
+
+	wt.Record(&Test{DependencyID: "boot.t", Result: TEST_RESULT_CORRECT, WallTime: 10.0})
+	wt.Record(&Test{DependencyID: "boot.t", Result: TEST_RESULT_INCORRECT, WallTime: 20.0})
+	expected := WALLTIME_WEIGHT*20.0 + (1-WALLTIME_WEIGHT)*10.0
+	bootTime, ok := wt.Get("boot.t")
+	assert.True(ok)
+	assert.InDelta(expected, bootTime, 0.0001)
+
+	assert.Nil(wt.Save())
+	loaded, err := LoadWallTimes(file)
+	assert.Nil(err)
+	if loaded != nil {
+		assert.Equal(wt.Times, loaded.Times)
+	}
+}
+
+func TestCriticalPathPriorities(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	env := defaultEnv.CopyEnvironment()
+	env.TestDir = "./fixtures/tests/depkinds"
+
+	config := &GroupConfig{
+		Name:    "Test",
+		UseDeps: true,
+		Tests:   []string{"cvt2.t"},
+		Env:     env,
+	}
+
+	tg, errs := GroupFromConfig(config)
+	assert.Equal(0, len(errs))
+	if tg == nil {
+		t.FailNow()
+	}
+
+	// boot.t <- lt1.t <- cvt1.t <- cvt2.t, with cvt2.t's time unknown
+	wt := NewWallTimes("")
+	wt.Times["boot.t"] = 1.0
+	wt.Times["lt1.t"] = 2.0
+	wt.Times["cvt1.t"] = 3.0
+
+	assert.Equal(map[string]float64{
+		"cvt2.t": 2.0,
+		"cvt1.t": 5.0,
+		"lt1.t":  7.0,
+		"boot.t": 8.0,
+	}, tg.criticalPathPriorities(wt))
+
+	// No history
+	assert.Equal(map[string]float64{
+		"cvt2.t": 1.0,
+		"cvt1.t": 2.0,
+		"lt1.t":  3.0,
+		"boot.t": 4.0,
+	}, tg.criticalPathPriorities(nil))
+}
@@ -0,0 +1,191 @@
+package test161
+
+import (
+	"fmt"
+)
+
+// This file defines the test manager's job queue. Jobs are queued by
+// priority class, and within a class, by owner (usually a submission's
+// users). When the manager has capacity for another job, the queue picks:
+//
+//  1. the highest priority class with queued jobs,
+//  2. within that class, the owner with the fewest running jobs, breaking
+//     ties in favor of the owner that has waited longest since it last had
+//     a job start, and
+//  3. within that owner's jobs, the job with the highest Priority (see
+//     DependencyRunner), breaking ties in submission order.
+//
+// This keeps one large submission from starving everyone else, while staff
+// submissions and validation runs can jump the queue.
+
+// PriorityClass determines which queued jobs run first. All jobs in a higher
+// class run before any job in a lower class. The zero value is
+// PRIORITY_NORMAL.
+type PriorityClass int
+
+const (
+	PRIORITY_LOW    PriorityClass = -1 // Background work, e.g. re-grading
+	PRIORITY_NORMAL PriorityClass = 0  // The default for everything
+	PRIORITY_HIGH   PriorityClass = 1  // Staff submissions and validation runs
+
+	numPriorityClasses = 3
+)
+
+func (c PriorityClass) String() string {
+	switch c {
+	case PRIORITY_LOW:
+		return "low"
+	case PRIORITY_NORMAL:
+		return "normal"
+	case PRIORITY_HIGH:
+		return "high"
+	default:
+		return fmt.Sprintf("PriorityClass(%d)", int(c))
+	}
+}
+
+// Clamp out-of-range classes to the nearest valid one.
+func (c PriorityClass) clamp() PriorityClass {
+	if c < PRIORITY_LOW {
+		return PRIORITY_LOW
+	} else if c > PRIORITY_HIGH {
+		return PRIORITY_HIGH
+	}
+	return c
+}
+
+// The index of a class in jobQueue.classes
+func (c PriorityClass) index() int {
+	return int(c.clamp() - PRIORITY_LOW)
+}
+
+// The manager's job queue. It isn't synchronized; the manager's lock
+// protects it.
+type jobQueue struct {
+	// Queued jobs, indexed by class and then owner
+	classes [numPriorityClasses]map[string][]*test161Job
+
+	// The number of running jobs for each owner
+	running map[string]uint
+
+	// When each owner last had a job start, as a sequence number
+	lastStart map[string]uint64
+	seq       uint64
+
+	size int
+}
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{
+		running:   make(map[string]uint),
+		lastStart: make(map[string]uint64),
+	}
+	for i := range q.classes {
+		q.classes[i] = make(map[string][]*test161Job)
+	}
+	return q
+}
+
+func (q *jobQueue) len() int {
+	return q.size
+}
+
+// The number of queued jobs in a priority class
+func (q *jobQueue) classLen(c PriorityClass) int {
+	count := 0
+	for _, jobs := range q.classes[c.index()] {
+		count += len(jobs)
+	}
+	return count
+}
+
+func (q *jobQueue) push(job *test161Job) {
+	job.Class = job.Class.clamp()
+	owners := q.classes[job.Class.index()]
+	owners[job.Owner] = append(owners[job.Owner], job)
+	q.size += 1
+}
+
+// Find the next job to run. ok is false if nothing is queued.
+func (q *jobQueue) choose() (owners map[string][]*test161Job, owner string, best int, ok bool) {
+	for c := numPriorityClasses - 1; c >= 0; c-- {
+		owners = q.classes[c]
+		if len(owners) == 0 {
+			continue
+		}
+
+		// Fair share between owners
+		found := false
+		for other := range owners {
+			if !found || q.fairer(other, owner) {
+				owner = other
+				found = true
+			}
+		}
+
+		// Best job for the owner
+		jobs := owners[owner]
+		for i, job := range jobs {
+			if job.Priority > jobs[best].Priority {
+				best = i
+			}
+		}
+
+		return owners, owner, best, true
+	}
+	return nil, "", 0, false
+}
+
+// Return the next job to run without removing it, or nil if nothing is
+// queued.
+func (q *jobQueue) peek() *test161Job {
+	if owners, owner, best, ok := q.choose(); ok {
+		return owners[owner][best]
+	}
+	return nil
+}
+
+// Remove and return the next job to run, or nil if nothing is queued.
+func (q *jobQueue) pop() *test161Job {
+	owners, owner, best, ok := q.choose()
+	if !ok {
+		return nil
+	}
+
+	jobs := owners[owner]
+	job := jobs[best]
+	if len(jobs) == 1 {
+		delete(owners, owner)
+	} else {
+		owners[owner] = append(jobs[:best], jobs[best+1:]...)
+	}
+	q.size -= 1
+	return job
+}
+
+// Whether owner a should get the next job instead of owner b.
+func (q *jobQueue) fairer(a, b string) bool {
+	if q.running[a] != q.running[b] {
+		return q.running[a] < q.running[b]
+	} else if q.lastStart[a] != q.lastStart[b] {
+		return q.lastStart[a] < q.lastStart[b]
+	}
+	// Stable order for owners that have never run anything
+	return a < b
+}
+
+// Record that a job started running.
+func (q *jobQueue) started(job *test161Job) {
+	q.seq += 1
+	q.running[job.Owner] += 1
+	q.lastStart[job.Owner] = q.seq
+}
+
+// Record that a job finished running.
+func (q *jobQueue) finished(job *test161Job) {
+	if q.running[job.Owner] > 1 {
+		q.running[job.Owner] -= 1
+	} else {
+		delete(q.running, job.Owner)
+	}
+}
@@ -0,0 +1,113 @@
+package test161
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func popAll(q *jobQueue) []string {
+	res := make([]string, 0)
+	for job := q.pop(); job != nil; job = q.pop() {
+		q.started(job)
+		res = append(res, job.Test.DependencyID)
+	}
+	return res
+}
+
+func queueJob(q *jobQueue, id, owner string, class PriorityClass, priority float64) {
+	q.push(&test161Job{
+		Test:     &Test{DependencyID: id},
+		Class:    class,
+		Owner:    owner,
+		Priority: priority,
+	})
+}
+
+func TestJobQueuePriority(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	q := newJobQueue()
+	assert.Nil(q.pop())
+
+	// Classes first, then priority, then submission order
+	queueJob(q, "low", "a", PRIORITY_LOW, 10.0)
+	queueJob(q, "normal1", "a", PRIORITY_NORMAL, 1.0)
+	queueJob(q, "normal2", "a", PRIORITY_NORMAL, 5.0)
+	queueJob(q, "normal3", "a", PRIORITY_NORMAL, 5.0)
+	queueJob(q, "high", "a", PRIORITY_HIGH, 0.0)
+	queueJob(q, "clamped", "a", PriorityClass(10), 0.0)
+
+	assert.Equal(6, q.len())
+	assert.Equal(2, q.classLen(PRIORITY_HIGH))
+	assert.Equal(3, q.classLen(PRIORITY_NORMAL))
+	assert.Equal(1, q.classLen(PRIORITY_LOW))
+
+	assert.Equal([]string{
+		"high", "clamped", "normal2", "normal3", "normal1", "low",
+	}, popAll(q))
+	assert.Equal(0, q.len())
+}
+
+func TestJobQueueFairShare(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	q := newJobQueue()
+
+	// A big submission arrives first, then two small ones
+	for _, id := range []string{"a1", "a2", "a3", "a4"} {
+		queueJob(q, id, "a", PRIORITY_NORMAL, 0.0)
+	}
+	queueJob(q, "b1", "b", PRIORITY_NORMAL, 0.0)
+	queueJob(q, "c1", "c", PRIORITY_NORMAL, 0.0)
+	queueJob(q, "c2", "c", PRIORITY_NORMAL, 0.0)
+
+	// Nothing is running, so owners take turns
+	assert.Equal([]string{"a1", "b1", "c1", "a2", "c2", "a3", "a4"}, popAll(q))
+
+	// Owners with fewer running jobs go first
+	q = newJobQueue()
+	queueJob(q, "a1", "a", PRIORITY_NORMAL, 0.0)
+	queueJob(q, "a2", "a", PRIORITY_NORMAL, 0.0)
+	queueJob(q, "b1", "b", PRIORITY_NORMAL, 0.0)
+
+	running := q.pop()
+	q.started(running)
+	assert.Equal("a1", running.Test.DependencyID)
+	q.started(q.pop())
+
+	q.finished(running)
+	queueJob(q, "a3", "a", PRIORITY_NORMAL, 0.0)
+	queueJob(q, "b2", "b", PRIORITY_NORMAL, 0.0)
+
+	// a has nothing running, b has b1
+	assert.Equal([]string{"a2", "b2", "a3"}, popAll(q))
+}
+
+func TestManagerQueue(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	m := newManager()
+	m.Capacity = Resources{Tests: 1}
+	m.start()
+	defer m.stop()
+
+	// Pretend something is running so everything else is queued
+	m.l.Lock()
+	m.stats.Running = 1
+	m.used = Resources{Tests: 1}
+	m.l.Unlock()
+
+	done := make(chan *Test161JobResult)
+	for _, class := range []PriorityClass{PRIORITY_NORMAL, PRIORITY_HIGH, PRIORITY_HIGH} {
+		m.submit(&test161Job{Test: &Test{}, DoneChan: done, Class: class})
+	}
+
+	stats := m.Stats()
+	assert.Equal(uint(3), stats.Queued)
+	assert.Equal(uint(3), stats.HighQueued)
+	assert.Equal(map[string]uint{"low": 0, "normal": 1, "high": 2}, stats.QueuedByClass)
+	assert.Equal(3, m.queue.len())
+}
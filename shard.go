@@ -0,0 +1,214 @@
+package test161
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Shard selects part of a TestGroup so that a large run can be split across
+// several machines. Shards are numbered from 1 to Count, and the zero value
+// selects the whole group.
+//
+// Each test that was asked for (i.e. isn't a dependency) is assigned to
+// exactly one shard, which owns it. The shard also gets the test's dependency
+// closure, so shared dependencies are duplicated across shards. If one of
+// those dependencies is owned by another shard, the copy is demoted to a plain
+// dependency so its points are only counted once when the shards' results are
+// merged with MergeShards.
+type Shard struct {
+	Index int `json:"index"`
+	Count int `json:"count"`
+}
+
+// ParseShard parses a shard specification of the form i/n.
+func ParseShard(spec string) (Shard, error) {
+	shard := Shard{}
+	parts := strings.Split(spec, "/")
+	if len(parts) != 2 {
+		return shard, fmt.Errorf("Invalid shard '%v', expected i/n", spec)
+	}
+
+	var err error
+	if shard.Index, err = strconv.Atoi(parts[0]); err != nil {
+		return shard, fmt.Errorf("Invalid shard '%v', expected i/n", spec)
+	}
+	if shard.Count, err = strconv.Atoi(parts[1]); err != nil {
+		return shard, fmt.Errorf("Invalid shard '%v', expected i/n", spec)
+	}
+
+	return shard, shard.validate()
+}
+
+func (s Shard) String() string {
+	return fmt.Sprintf("%v/%v", s.Index, s.Count)
+}
+
+// Whether the shard selects part of a group, rather than all of it.
+func (s Shard) Enabled() bool {
+	return s.Count > 0
+}
+
+func (s Shard) validate() error {
+	if s.Count < 1 || s.Index < 1 || s.Index > s.Count {
+		return fmt.Errorf("Invalid shard '%v', expected 1 <= i <= n", s)
+	}
+	return nil
+}
+
+// Add a test and its dependencies, which must be in the group, to a shard.
+func (tg *TestGroup) addClosure(test *Test, shard map[string]*Test) {
+	if _, ok := shard[test.DependencyID]; ok {
+		return
+	}
+	shard[test.DependencyID] = test
+	for id := range test.ExpandedDeps {
+		if dep, ok := tg.Tests[id]; ok {
+			tg.addClosure(dep, shard)
+		}
+	}
+}
+
+// Count the tests a closure would add to a shard.
+func (tg *TestGroup) closureCost(test *Test, shard map[string]*Test, seen map[string]bool) int {
+	if _, ok := shard[test.DependencyID]; ok || seen[test.DependencyID] {
+		return 0
+	}
+	seen[test.DependencyID] = true
+	cost := 1
+	for id := range test.ExpandedDeps {
+		if dep, ok := tg.Tests[id]; ok {
+			cost += tg.closureCost(dep, shard, seen)
+		}
+	}
+	return cost
+}
+
+// Partition the group's tests into count shards. The owned tests are visited
+// in id order and each is given to the shard that would grow the least, which
+// is deterministic as long as every machine expands the same group.
+func (tg *TestGroup) partition(count int) ([]map[string]*Test, map[string]int) {
+	owned := make([]*Test, 0)
+	for _, test := range tg.Tests {
+		if !test.IsDependency {
+			owned = append(owned, test)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[i].DependencyID < owned[j].DependencyID
+	})
+
+	shards := make([]map[string]*Test, count)
+	for i := range shards {
+		shards[i] = make(map[string]*Test)
+	}
+	owners := make(map[string]int)
+
+	for _, test := range owned {
+		best, bestSize := 0, 0
+		for i, shard := range shards {
+			size := len(shard) + tg.closureCost(test, shard, make(map[string]bool))
+			if i == 0 || size < bestSize {
+				best, bestSize = i, size
+			}
+		}
+		tg.addClosure(test, shards[best])
+		owners[test.DependencyID] = best
+	}
+
+	return shards, owners
+}
+
+// ApplyShard removes the tests that don't belong to the given shard from the
+// group, and records the shard in the group's configuration. This is done by
+// GroupFromConfig if the configuration has a shard, and needs to be done
+// separately for groups created from targets.
+func (tg *TestGroup) ApplyShard(shard Shard) error {
+	if !shard.Enabled() {
+		return nil
+	}
+	if err := shard.validate(); err != nil {
+		return err
+	}
+
+	shards, owners := tg.partition(shard.Count)
+	tests := shards[shard.Index-1]
+
+	for id, test := range tests {
+		if owner, ok := owners[id]; ok && owner != shard.Index-1 {
+			test.IsDependency = true
+			test.TargetName = ""
+		}
+	}
+
+	tg.Tests = tests
+	if tg.Config != nil {
+		tg.Config.Shard = shard
+	}
+	return nil
+}
+
+// Prefer the result of the shard that owns a test. For a dependency that ran
+// in several shards, prefer a result that isn't correct so problems aren't
+// hidden.
+func preferShardResult(cur, other *Test) bool {
+	if cur.IsDependency != other.IsDependency {
+		return !other.IsDependency
+	}
+	return cur.Result == TEST_RESULT_CORRECT && other.Result != TEST_RESULT_CORRECT
+}
+
+// MergeShards combines the results of every shard of a sharded run into one
+// TestGroup, with each owned test appearing once.
+func MergeShards(groups []*TestGroup) (*TestGroup, error) {
+	if len(groups) == 0 {
+		return nil, errors.New("No shards to merge")
+	}
+
+	var first *GroupConfig
+	seen := make(map[int]bool)
+
+	for _, tg := range groups {
+		if tg.Config == nil || !tg.Config.Shard.Enabled() {
+			return nil, errors.New("Results are not from a sharded run")
+		}
+		shard := tg.Config.Shard
+		if first == nil {
+			first = tg.Config
+		} else if shard.Count != first.Shard.Count || tg.Config.Name != first.Name {
+			return nil, fmt.Errorf("Shard %v (%v) is not from the same run as shard %v (%v)",
+				shard, tg.Config.Name, first.Shard, first.Name)
+		}
+		if seen[shard.Index] {
+			return nil, fmt.Errorf("Duplicate results for shard %v", shard)
+		}
+		seen[shard.Index] = true
+	}
+
+	for i := 1; i <= first.Shard.Count; i++ {
+		if !seen[i] {
+			return nil, fmt.Errorf("Missing results for shard %v", Shard{i, first.Shard.Count})
+		}
+	}
+
+	merged := EmptyGroup()
+	config := *first
+	config.Shard = Shard{}
+	merged.Config = &config
+
+	for _, tg := range groups {
+		for id, test := range tg.Tests {
+			cur, ok := merged.Tests[id]
+			if ok && !cur.IsDependency && !test.IsDependency {
+				return nil, fmt.Errorf("Test %v was run by more than one shard", id)
+			}
+			if !ok || preferShardResult(cur, test) {
+				merged.Tests[id] = test
+			}
+		}
+	}
+
+	return merged, nil
+}
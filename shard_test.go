@@ -0,0 +1,151 @@
+package test161
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseShard(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	shard, err := ParseShard("2/3")
+	assert.Nil(err)
+	assert.Equal(Shard{2, 3}, shard)
+	assert.Equal("2/3", shard.String())
+	assert.True(shard.Enabled())
+	assert.False(Shard{}.Enabled())
+
+	for _, spec := range []string{"", "2", "0/3", "4/3", "1/0", "a/b", "1/2/3"} {
+		_, err = ParseShard(spec)
+		assert.NotNil(err, spec)
+	}
+}
+
+var shardTests = []string{
+	"sync/cvt1.t", "sync/lt1.t", "sync/sem1.t",
+	"threads/tt1.t", "threads/tt2.t",
+}
+
+func shardGroup(t *testing.T, shard Shard) *TestGroup {
+	config := &GroupConfig{
+		Name:    "Test",
+		UseDeps: true,
+		Tests:   shardTests,
+		Env:     defaultEnv,
+		Shard:   shard,
+	}
+	tg, errs := GroupFromConfig(config)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	return tg
+}
+
+func groupIDs(tg *TestGroup) []string {
+	ids := make([]string, 0, len(tg.Tests))
+	for id := range tg.Tests {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestGroupShards(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	all := shardGroup(t, Shard{})
+	owners := make(map[string]int)
+
+	for i := 1; i <= 3; i++ {
+		tg := shardGroup(t, Shard{i, 3})
+		assert.Equal(Shard{i, 3}, tg.Config.Shard)
+
+		// Deterministic
+		assert.Equal(groupIDs(tg), groupIDs(shardGroup(t, Shard{i, 3})))
+
+		for id, test := range tg.Tests {
+			if !test.IsDependency {
+				owners[id] += 1
+			}
+			// Dependency closures are kept together
+			for dep := range test.ExpandedDeps {
+				_, ok := tg.Tests[dep]
+				assert.True(ok, "%v is missing dependency %v", id, dep)
+			}
+		}
+	}
+
+	// Each test that was asked for is owned by exactly one shard
+	for id, test := range all.Tests {
+		if test.IsDependency {
+			assert.Equal(0, owners[id], id)
+		} else {
+			assert.Equal(1, owners[id], id)
+		}
+	}
+	assert.Equal(len(shardTests), len(owners))
+
+	// A single shard is the whole group
+	assert.Equal(groupIDs(all), groupIDs(shardGroup(t, Shard{1, 1})))
+
+	// More shards than tests leaves some empty
+	for i := 1; i <= 10; i++ {
+		tg := shardGroup(t, Shard{i, 10})
+		if i > len(shardTests) {
+			assert.Equal(0, len(tg.Tests))
+		}
+	}
+
+	config := &GroupConfig{
+		Name:    "Test",
+		UseDeps: true,
+		Tests:   shardTests,
+		Env:     defaultEnv,
+		Shard:   Shard{4, 3},
+	}
+	_, errs := GroupFromConfig(config)
+	assert.Equal(1, len(errs))
+}
+
+func TestMergeShards(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	all := shardGroup(t, Shard{})
+
+	shards := make([]*TestGroup, 0)
+	for i := 1; i <= 2; i++ {
+		tg := shardGroup(t, Shard{i, 2})
+		for _, test := range tg.Tests {
+			test.Result = TEST_RESULT_CORRECT
+			test.PointsAvailable = 1
+			test.PointsEarned = 1
+		}
+		shards = append(shards, tg)
+	}
+
+	// A dependency that failed in one shard
+	shards[1].Tests["boot.t"].Result = TEST_RESULT_INCORRECT
+
+	merged, err := MergeShards(shards)
+	assert.Nil(err)
+	assert.Equal(groupIDs(all), groupIDs(merged))
+	assert.False(merged.Config.Shard.Enabled())
+	assert.Equal(TEST_RESULT_INCORRECT, merged.Tests["boot.t"].Result)
+
+	for id, test := range all.Tests {
+		assert.Equal(test.IsDependency, merged.Tests[id].IsDependency, id)
+	}
+
+	// Missing and duplicate shards
+	_, err = MergeShards(shards[:1])
+	assert.NotNil(err)
+	_, err = MergeShards([]*TestGroup{shards[0], shards[0], shards[1]})
+	assert.NotNil(err)
+	_, err = MergeShards([]*TestGroup{all})
+	assert.NotNil(err)
+}
@@ -379,6 +379,13 @@ func NewSubmission(request *SubmissionRequest, origenv *TestEnvironment) (*Submi
 		s.IsStaff, _ = students[0].IsStaff(env)
 	}
 
+	// Each group of students gets a fair share of the test manager, and
+	// staff submissions jump the queue.
+	tg.Config.Owner = strings.Join(s.Users, ",")
+	if s.IsStaff {
+		tg.Config.Priority = PRIORITY_HIGH
+	}
+
 	// Try and lock students now so we don't allow multiple submissions.
 	// This enforces NewSubmission() can only return successfully if none
 	// of the students has a pending submission. We need to do this
@@ -0,0 +1,327 @@
+package test161
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// This file implements test expressions, which select tests using tags and
+// test file globs combined with boolean operators. For example:
+//
+//	sync && !slow
+//	(vm || fs) && cpus1
+//	sync/* - sync/cvt4.t
+//
+// The operators, from highest to lowest precedence, are:
+//
+//	!x       tests not matched by x
+//	x && y   tests matched by both x and y
+//	x || y   tests matched by either x or y
+//	x - y    tests matched by x but not y
+//
+// || and - have the same precedence and are left associative, so a || b - c
+// is (a || b) - c. The - operator must be separated from its operands by
+// whitespace since test names and tags can contain dashes. A plain tag or
+// glob is also a valid expression, so every entry of GroupConfig.Tests is
+// parsed as one.
+
+const (
+	exprAnd  = "&&"
+	exprOr   = "||"
+	exprDiff = "-"
+	exprNot  = "!"
+)
+
+// A parsed test expression.
+type testExpr interface {
+	// Evaluate the expression to the set of matching tests, indexed by id.
+	// startDir is the directory that relative globs are resolved against.
+	eval(tm *testMap, startDir string) (map[string]*Test, error)
+	String() string
+}
+
+// A single tag or test file glob
+type exprAtom struct {
+	text string
+}
+
+type exprUnary struct {
+	x testExpr
+}
+
+type exprBinary struct {
+	op          string
+	left, right testExpr
+}
+
+func (e *exprAtom) String() string {
+	return e.text
+}
+
+func (e *exprUnary) String() string {
+	return fmt.Sprintf("!%v", e.x)
+}
+
+func (e *exprBinary) String() string {
+	return fmt.Sprintf("(%v %v %v)", e.left, e.op, e.right)
+}
+
+func (e *exprAtom) eval(tm *testMap, startDir string) (map[string]*Test, error) {
+	var tests []*Test
+	var err error
+
+	if isTestFileExpr(e.text) {
+		if tests, err = tm.testsFromGlob(e.text, startDir); err != nil {
+			return nil, err
+		}
+	} else {
+		var ok bool
+		if tests, ok = tm.Tags[e.text]; !ok {
+			return nil, errors.New(fmt.Sprintf("Cannot find tag: %v", e.text))
+		}
+	}
+
+	res := make(map[string]*Test)
+	for _, test := range tests {
+		res[test.DependencyID] = test
+	}
+	return res, nil
+}
+
+func (e *exprUnary) eval(tm *testMap, startDir string) (map[string]*Test, error) {
+	x, err := e.x.eval(tm, startDir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*Test)
+	for id, test := range tm.Tests {
+		if _, ok := x[id]; !ok {
+			res[id] = test
+		}
+	}
+	return res, nil
+}
+
+func (e *exprBinary) eval(tm *testMap, startDir string) (map[string]*Test, error) {
+	left, err := e.left.eval(tm, startDir)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(tm, startDir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*Test)
+
+	switch e.op {
+	case exprAnd:
+		for id, test := range left {
+			if _, ok := right[id]; ok {
+				res[id] = test
+			}
+		}
+	case exprOr:
+		for id, test := range left {
+			res[id] = test
+		}
+		for id, test := range right {
+			res[id] = test
+		}
+	case exprDiff:
+		for id, test := range left {
+			if _, ok := right[id]; !ok {
+				res[id] = test
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Split a test expression into tokens. Operators and parentheses are their
+// own tokens; everything else is a tag or glob. Brackets are kept together
+// so globs like sync/[!c]*.t and matrix selectors aren't split up.
+func tokenizeTestExpr(text string) ([]string, error) {
+	tokens := make([]string, 0)
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		rest := string(runes[i:])
+
+		switch {
+		case unicode.IsSpace(r):
+			i += 1
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i += 1
+		case strings.HasPrefix(rest, exprAnd) || strings.HasPrefix(rest, exprOr):
+			tokens = append(tokens, rest[:2])
+			i += 2
+		case r == '!':
+			tokens = append(tokens, exprNot)
+			i += 1
+		case r == '-' && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])):
+			tokens = append(tokens, exprDiff)
+			i += 1
+		default:
+			start := i
+			depth := 0
+			for ; i < len(runes); i++ {
+				r = runes[i]
+				if r == '[' {
+					depth += 1
+				} else if r == ']' && depth > 0 {
+					depth -= 1
+				} else if depth == 0 {
+					rest = string(runes[i:])
+					if unicode.IsSpace(r) || r == '(' || r == ')' ||
+						strings.HasPrefix(rest, exprAnd) || strings.HasPrefix(rest, exprOr) {
+						break
+					}
+				}
+			}
+			if depth > 0 {
+				return nil, fmt.Errorf("Unbalanced '[' in test expression: %v", text)
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		}
+	}
+
+	return tokens, nil
+}
+
+// Recursive descent parser state
+type exprParser struct {
+	text   string
+	tokens []string
+	pos    int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	tok := p.peek()
+	p.pos += 1
+	return tok
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid test expression '%v': %v", p.text, fmt.Sprintf(format, args...))
+}
+
+func isExprOperator(tok string) bool {
+	switch tok {
+	case exprAnd, exprOr, exprDiff, exprNot, "(", ")":
+		return true
+	}
+	return false
+}
+
+// expr := and { ("||" | "-") and }
+func (p *exprParser) parseExpr() (testExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == exprOr || p.peek() == exprDiff {
+		op := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprBinary{op, left, right}
+	}
+	return left, nil
+}
+
+// and := unary { "&&" unary }
+func (p *exprParser) parseAnd() (testExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == exprAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprBinary{exprAnd, left, right}
+	}
+	return left, nil
+}
+
+// unary := "!" unary | "(" expr ")" | atom
+func (p *exprParser) parseUnary() (testExpr, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, p.errorf("unexpected end of expression")
+	case tok == exprNot:
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{x}, nil
+	case tok == "(":
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, p.errorf("missing ')'")
+		}
+		return x, nil
+	case isExprOperator(tok):
+		return nil, p.errorf("unexpected '%v'", tok)
+	default:
+		return &exprAtom{tok}, nil
+	}
+}
+
+// Parse a test expression.
+func parseTestExpr(text string) (testExpr, error) {
+	tokens, err := tokenizeTestExpr(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{text: text, tokens: tokens}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected '%v'", p.peek())
+	}
+	return expr, nil
+}
+
+// Get the tests matching a test expression.
+func (tm *testMap) testsFromExpr(text, startDir string) ([]*Test, error) {
+	expr, err := parseTestExpr(text)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := expr.eval(tm, startDir)
+	if err != nil {
+		return nil, err
+	}
+
+	tests := make([]*Test, 0, len(res))
+	for _, test := range res {
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
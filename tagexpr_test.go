@@ -0,0 +1,117 @@
+package test161
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestTestExprParse(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	valid := map[string]string{
+		"sync":                        "sync",
+		"sync && !slow":               "(sync && !slow)",
+		"(vm || fs) && cpus1":         "((vm || fs) && cpus1)",
+		"sync/* - sync/cvt4.t":        "(sync/* - sync/cvt4.t)",
+		"a || b - c":                  "((a || b) - c)",
+		"a || b && c":                 "(a || (b && c))",
+		"!!a":                         "!!a",
+		"no-deps&&sync":               "(no-deps && sync)",
+		"sync/[!c]*.t":                "sync/[!c]*.t",
+		"sync/lt1.t[sys161.cpus=1]":   "sync/lt1.t[sys161.cpus=1]",
+		"sync/lt1.t[a=1, b=2] || cv":  "(sync/lt1.t[a=1, b=2] || cv)",
+		"  ( sync )  ":                "sync",
+		"sync - (locks || sem) - cv":  "((sync - (locks || sem)) - cv)",
+		"!(boot || threads) && !sync": "(!(boot || threads) && !sync)",
+	}
+
+	for text, expected := range valid {
+		expr, err := parseTestExpr(text)
+		assert.Nil(err, text)
+		if err == nil {
+			assert.Equal(expected, expr.String(), text)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"sync &&",
+		"&& sync",
+		"(sync || cv",
+		"sync || cv)",
+		"sync cv",
+		"!",
+		"- sync",
+		"sync/[ab.t",
+	}
+
+	for _, text := range invalid {
+		_, err := parseTestExpr(text)
+		assert.NotNil(err, text)
+		t.Log(err)
+	}
+}
+
+func TestTestExprEval(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	tm, errs := newTestMap(TEST_DIR)
+	assert.Equal(0, len(errs))
+	if tm == nil {
+		t.FailNow()
+	}
+
+	startDir, err := filepath.Abs(TEST_DIR)
+	assert.Nil(err)
+
+	exprs := map[string][]string{
+		"cv":                                []string{"sync/cvt1.t", "sync/cvt2.t", "sync/cvt3.t", "sync/cvt4.t"},
+		"sync && !cv && !locks && !sem":     []string{"sync/all.t", "sync/fail.t", "sync/multi.t"},
+		"(sem || locks) && sync":            []string{"sync/lt1.t", "sync/lt2.t", "sync/lt3.t", "sync/sem1.t", "sync/semu1.t"},
+		"sync/cvt*.t - sync/cvt4.t":         []string{"sync/cvt1.t", "sync/cvt2.t", "sync/cvt3.t"},
+		"threads - threads/tt2.t || boot.t": []string{"boot.t", "threads/tt1.t", "threads/tt3.t"},
+		"!(sync || threads) - panics/*.t":   []string{"boot.t"},
+		"cv && locks":                       []string{},
+	}
+
+	for text, expected := range exprs {
+		tests, err := tm.testsFromExpr(text, startDir)
+		assert.Nil(err, text)
+		assert.Equal(expected, testsToSortedSlice(tests), text)
+	}
+
+	// Unknown tags and globs are still errors, even when negated
+	for _, text := range []string{"sync && !nosuchtag", "nosuch/*.t || sync"} {
+		_, err := tm.testsFromExpr(text, startDir)
+		assert.NotNil(err, text)
+	}
+}
+
+func TestGroupFromConfigExpr(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	config := &GroupConfig{
+		Name:    "Test",
+		UseDeps: false,
+		Tests:   []string{"cv - sync/cvt1.t", "boot"},
+		Env:     defaultEnv,
+	}
+
+	tg, errs := GroupFromConfig(config)
+	assert.Equal(0, len(errs))
+	if tg == nil {
+		t.FailNow()
+	}
+
+	actual := make([]string, 0)
+	for id := range tg.Tests {
+		actual = append(actual, id)
+	}
+	sort.Strings(actual)
+	assert.Equal([]string{"boot.t", "sync/cvt2.t", "sync/cvt3.t", "sync/cvt4.t"}, actual)
+}
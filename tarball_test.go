@@ -0,0 +1,73 @@
+package test161
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarballRoundTrip(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	src := t.TempDir()
+	assert.Nil(os.MkdirAll(path.Join(src, "bin"), 0770))
+	assert.Nil(ioutil.WriteFile(path.Join(src, "kernel-ASST0"), []byte("kernel"), 0775))
+	assert.Nil(ioutil.WriteFile(path.Join(src, "bin", "true"), []byte("true"), 0664))
+	assert.Nil(os.Symlink("kernel-ASST0", path.Join(src, "kernel")))
+	assert.Nil(os.MkdirAll(path.Join(src, ".sockets"), 0770))
+	assert.Nil(ioutil.WriteFile(path.Join(src, ".sockets", "meter"), []byte{}, 0664))
+
+	var buf bytes.Buffer
+	assert.Nil(WriteTarball(&buf, src))
+
+	dest := path.Join(t.TempDir(), "root")
+	assert.Nil(ExtractTarball(&buf, dest))
+
+	data, err := ioutil.ReadFile(path.Join(dest, "kernel-ASST0"))
+	assert.Nil(err)
+	assert.Equal("kernel", string(data))
+	if info, err := os.Stat(path.Join(dest, "kernel-ASST0")); assert.Nil(err) {
+		assert.NotEqual(os.FileMode(0), info.Mode().Perm()&0100)
+	}
+
+	data, err = ioutil.ReadFile(path.Join(dest, "bin", "true"))
+	assert.Nil(err)
+	assert.Equal("true", string(data))
+
+	link, err := os.Readlink(path.Join(dest, "kernel"))
+	assert.Nil(err)
+	assert.Equal("kernel-ASST0", link)
+
+	_, err = os.Stat(path.Join(dest, ".sockets"))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestTarballBadPath(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	assert.Nil(tw.WriteHeader(&tar.Header{
+		Name:     "../escape",
+		Typeflag: tar.TypeReg,
+		Mode:     0664,
+		Size:     1,
+	}))
+	tw.Write([]byte("x"))
+	tw.Close()
+	gz.Close()
+
+	dir := t.TempDir()
+	assert.NotNil(ExtractTarball(&buf, path.Join(dir, "root")))
+	_, err := os.Stat(path.Join(dir, "escape"))
+	assert.True(os.IsNotExist(err))
+}
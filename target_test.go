@@ -76,7 +76,7 @@ func runTargetTest(t *testing.T, testPoints map[string]*expectedTestResults, tar
 	env := defaultEnv.CopyEnvironment()
 	env.manager = newManager()
 	env.RootDir = "./fixtures/root"
-	env.manager.Capacity = 10
+	env.manager.Capacity = Resources{Tests: 10}
 
 	target, ok := defaultEnv.Targets[targetId]
 	assert.True(ok)
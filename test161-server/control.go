@@ -6,7 +6,7 @@ import (
 	"net"
 	"net/http"
 	"net/rpc"
-	"strconv"
+	"strings"
 
 	"github.com/jay1999ke/test161"
 )
@@ -22,14 +22,19 @@ const (
 
 type ControlRequest struct {
 	Message     int
-	NewCapacity uint
+	NewCapacity test161.Resources
+}
+
+type ControlReply struct {
+	Status   int
+	Capacity test161.Resources
 }
 
 type ServerCtrl int
 
-func (sc *ServerCtrl) Control(msg *ControlRequest, reply *int) error {
+func (sc *ServerCtrl) Control(msg *ControlRequest, reply *ControlReply) error {
 
-	*reply = 0
+	*reply = ControlReply{}
 
 	if submissionServer == nil || submissionServer.submissionMgr == nil {
 		return errors.New("SubmissionManager is not initialized")
@@ -48,15 +53,13 @@ func (sc *ServerCtrl) Control(msg *ControlRequest, reply *int) error {
 		submissionMgr.SetStaffOnly()
 		return nil
 	case CTRL_STATUS:
-		*reply = submissionMgr.Status()
+		reply.Status = submissionMgr.Status()
 		return nil
 	case CTRL_GETCAPACITY:
-		cap := test161.ManagerCapacity()
-		*reply = int(cap)
+		reply.Capacity = test161.ManagerCapacity()
 		return nil
 	case CTRL_SETCAPACITY:
 		test161.SetManagerCapacity(msg.NewCapacity)
-		*reply = 0
 		return nil
 	default:
 		return errors.New("Unrecongnized control message")
@@ -80,7 +83,7 @@ func (cs *ControlServer) Start() {
 func (server *ControlServer) Stop() {
 }
 
-func doCtrlRequest(msg interface{}, reply *int) error {
+func doCtrlRequest(msg interface{}, reply *ControlReply) error {
 
 	req := ControlRequest{}
 
@@ -104,42 +107,44 @@ func doCtrlRequest(msg interface{}, reply *int) error {
 }
 
 func CtrlPause() error {
-	var reply int
+	var reply ControlReply
 	return doCtrlRequest(CTRL_PAUSE, &reply)
 }
 
 func CtrlResume() error {
-	var reply int
+	var reply ControlReply
 	return doCtrlRequest(CTRL_RESUME, &reply)
 }
 
 func CtrlSetStaffOnly() error {
-	var reply int
+	var reply ControlReply
 	return doCtrlRequest(CTRL_STAFF_ONLY, &reply)
 }
 
 func CtrlStatus() (int, error) {
-	var reply int
+	var reply ControlReply
 	err := doCtrlRequest(CTRL_STATUS, &reply)
-	return reply, err
+	return reply.Status, err
 }
 
-func CtrlGetCapacity() (int, error) {
-	var reply int
+func CtrlGetCapacity() (test161.Resources, error) {
+	var reply ControlReply
 	err := doCtrlRequest(CTRL_GETCAPACITY, &reply)
-	return reply, err
+	return reply.Capacity, err
 }
 
-func CtrlSetCapacity(argCap string) error {
-	newCap, err := strconv.Atoi(argCap)
+// Set the capacity from the command line, either a number of tests or
+// key=value pairs (see test161.ParseResources).
+func CtrlSetCapacity(args []string) error {
+	newCap, err := test161.ParseResources(strings.Join(args, " "))
 	if err != nil {
 		return err
 	}
 
-	var reply int
+	var reply ControlReply
 	err = doCtrlRequest(ControlRequest{
 		Message:     CTRL_SETCAPACITY,
-		NewCapacity: uint(newCap),
+		NewCapacity: newCap,
 	}, &reply)
 
 	return err
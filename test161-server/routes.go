@@ -28,6 +28,12 @@ var routes = []Route{
 		"/api-v1/submit",
 		createSubmission,
 	},
+	Route{
+		"SubmissionTests",
+		"POST",
+		"/api-v1/submissions/tests",
+		submissionTests,
+	},
 	Route{
 		"ListTargets",
 		"GET",
@@ -58,6 +64,36 @@ var routes = []Route{
 		"/api-v1/upload",
 		uploadFiles,
 	},
+	Route{
+		"RegisterWorker",
+		"POST",
+		"/api-v1/workers",
+		registerWorker,
+	},
+	Route{
+		"UnregisterWorker",
+		"DELETE",
+		"/api-v1/workers/{id}",
+		unregisterWorker,
+	},
+	Route{
+		"PollWorker",
+		"POST",
+		"/api-v1/workers/{id}/poll",
+		pollWorker,
+	},
+	Route{
+		"UpdateWorkerJob",
+		"POST",
+		"/api-v1/workers/{id}/jobs/{job}",
+		updateWorkerJob,
+	},
+	Route{
+		"WorkerJobRoot",
+		"GET",
+		"/api-v1/workers/{id}/jobs/{job}/root",
+		workerJobRoot,
+	},
 }
 
 func NewRouter() *mux.Router {
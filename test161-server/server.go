@@ -68,13 +68,13 @@ func main() {
 		case "staff-only":
 			err = CtrlSetStaffOnly()
 		case "set-capacity":
-			if len(os.Args) != 3 {
+			if len(os.Args) < 3 {
 				err = errors.New("Wrong number of arguments to set-capacity")
 			} else {
-				err = CtrlSetCapacity(os.Args[2])
+				err = CtrlSetCapacity(os.Args[2:])
 			}
 		case "get-capacity":
-			var capacity int
+			var capacity test161.Resources
 			capacity, err = CtrlGetCapacity()
 			if err == nil {
 				fmt.Println("Current test capacity:", capacity)
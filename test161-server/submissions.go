@@ -26,7 +26,11 @@ type SubmissionServerConfig struct {
 	OverlayDir       string                 `yaml:"overlaydir"`
 	KeyDir           string                 `yaml:"keydir"`
 	UsageDir         string                 `yaml:"usagedir"`
+	WallTimesFile    string                 `yaml:"walltimes_file"`
 	MaxTests         uint                   `yaml:"max_tests"`
+	MaxCPUs          float64                `yaml:"max_cpus"`
+	MaxMemory        string                 `yaml:"max_memory"`
+	MaxDisk          string                 `yaml:"max_disk"`
 	Database         string                 `yaml:"db_name"`
 	DBServers        []string               `yaml:"db_servers"`
 	DBUser           string                 `yaml:"db_user"`
@@ -38,6 +42,7 @@ type SubmissionServerConfig struct {
 	MinClient        test161.ProgramVersion `yaml:"min_client"`
 	StaffOnlyTargets []string               `yaml:"staff_only_targets"`
 	DisabledTargets  []string               `yaml:"disabled_targets"`
+	WorkerToken      string                 `yaml:"worker_token"`
 }
 
 const CONF_FILE = ".test161-server.conf"
@@ -61,6 +66,7 @@ var logger = log.New(os.Stderr, "test161-server: ", log.LstdFlags)
 
 type SubmissionServer struct {
 	conf          *SubmissionServerConfig
+	capacity      test161.Resources
 	env           *test161.TestEnvironment
 	submissionMgr *test161.SubmissionManager
 }
@@ -78,6 +84,10 @@ func NewSubmissionServer() (test161Server, error) {
 		conf: conf,
 	}
 
+	if s.capacity, err = conf.managerCapacity(); err != nil {
+		return nil, err
+	}
+
 	if err := s.setUpEnvironment(); err != nil {
 		return nil, err
 	}
@@ -291,6 +301,48 @@ func validateSubmission(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// submissionTests accepts POST requests for the tests of a submission, which
+// 'test161 show' uses to display its results. The users in the request need
+// to be staff, or the submission's users.
+func submissionTests(w http.ResponseWriter, r *http.Request) {
+	var request test161.SubmissionTestsRequest
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1*1024*1024))
+	r.Body.Close()
+	if err != nil {
+		logger.Println("Error reading submission tests request:", err)
+		sendErrorCode(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = json.Unmarshal(body, &request); err != nil {
+		logger.Println("Error unmarshalling submission tests request:", err)
+		sendErrorCode(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tg, err := request.Results(submissionServer.env)
+	switch err {
+	case nil:
+	case test161.ErrUnknownSubmission:
+		sendErrorCode(w, http.StatusNotFound, err)
+		return
+	case test161.ErrSubmissionForbidden:
+		sendErrorCode(w, http.StatusForbidden, err)
+		return
+	default:
+		// Unprocessable entity, like the other requests with users
+		sendErrorCode(w, 422, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", JsonHeader)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(tg); err != nil {
+		logger.Println("Error encoding submission tests:", err)
+	}
+}
+
 // getStats returns the current manager statistics
 func getStats(w http.ResponseWriter, r *http.Request) {
 
@@ -389,6 +441,28 @@ func loadServerConfig() (*SubmissionServerConfig, error) {
 	return conf, nil
 }
 
+// The test manager's capacity from the max_* settings
+func (conf *SubmissionServerConfig) managerCapacity() (test161.Resources, error) {
+	capacity := test161.Resources{
+		Tests: conf.MaxTests,
+		CPUs:  conf.MaxCPUs,
+	}
+
+	var err error
+	if conf.MaxMemory != "" {
+		if capacity.Memory, err = test161.ParseSize(conf.MaxMemory); err != nil {
+			return capacity, fmt.Errorf("Invalid max_memory: %v", err)
+		}
+	}
+	if conf.MaxDisk != "" {
+		if capacity.Disk, err = test161.ParseSize(conf.MaxDisk); err != nil {
+			return capacity, fmt.Errorf("Invalid max_disk: %v", err)
+		}
+	}
+
+	return capacity, nil
+}
+
 func (s *SubmissionServer) setUpEnvironment() error {
 	// MongoDB connection
 	mongoTestDialInfo := &mgo.DialInfo{
@@ -425,6 +499,12 @@ func (s *SubmissionServer) setUpEnvironment() error {
 	env.KeyDir = s.conf.KeyDir
 	env.Log = logger
 
+	if s.conf.WallTimesFile != "" {
+		if env.WallTimes, err = test161.LoadWallTimes(s.conf.WallTimesFile); err != nil {
+			return err
+		}
+	}
+
 	usageFailDir = s.conf.UsageDir
 
 	logger.Println("Min client ver:", s.conf.MinClient)
@@ -438,7 +518,7 @@ func (s *SubmissionServer) setUpEnvironment() error {
 
 func (s *SubmissionServer) Start() {
 	// Kick off test161 submission server
-	test161.SetManagerCapacity(s.conf.MaxTests)
+	test161.SetManagerCapacity(s.capacity)
 	test161.StartManager()
 
 	// Init upload handlers
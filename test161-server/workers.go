@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jay1999ke/test161"
+)
+
+// Handlers for remote test workers (test161-worker). Workers authenticate
+// with the shared worker_token from the server config, and the endpoints are
+// disabled if there isn't one.
+
+// Test updates include the output so far
+const MAX_WORKER_UPDATE = 64 * 1024 * 1024
+
+// Check the worker token, sending an error if it's missing or wrong.
+func checkWorkerToken(w http.ResponseWriter, r *http.Request) bool {
+	token := submissionServer.conf.WorkerToken
+	if token == "" {
+		sendErrorCode(w, http.StatusNotFound, errors.New("Remote workers are not enabled on this server"))
+		return false
+	}
+
+	given := r.Header.Get(test161.WORKER_TOKEN_HEADER)
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		sendErrorCode(w, http.StatusUnauthorized, errors.New("Invalid worker token"))
+		return false
+	}
+	return true
+}
+
+// Send the error from a test manager worker function. Workers re-register
+// when they get StatusNotFound, and drop the job on StatusGone.
+func sendWorkerError(w http.ResponseWriter, err error) {
+	switch err {
+	case test161.ErrUnknownWorker:
+		sendErrorCode(w, http.StatusNotFound, err)
+	case test161.ErrUnknownWorkerJob:
+		sendErrorCode(w, http.StatusGone, err)
+	default:
+		sendErrorCode(w, http.StatusBadRequest, err)
+	}
+}
+
+// Read a JSON request body from a worker into v.
+func readWorkerRequest(w http.ResponseWriter, r *http.Request, limit int64, v interface{}) bool {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit))
+	r.Body.Close()
+	if err != nil {
+		logger.Println("Error reading worker request:", err)
+		sendErrorCode(w, http.StatusBadRequest, err)
+		return false
+	}
+
+	if err = json.Unmarshal(body, v); err != nil {
+		logger.Println("Error unmarshalling worker request:", err)
+		sendErrorCode(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func sendWorkerReply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", JsonHeader)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Println("Error encoding worker reply:", err)
+	}
+}
+
+func registerWorker(w http.ResponseWriter, r *http.Request) {
+	if !checkWorkerToken(w, r) {
+		return
+	}
+
+	var reg test161.WorkerRegistration
+	if !readWorkerRequest(w, r, 64*1024, &reg) {
+		return
+	}
+
+	reg.ID = test161.RegisterWorker(reg.Name, reg.Capacity)
+	logger.Printf("Registered worker %v (%v) with capacity %v\n", reg.Name, reg.ID, reg.Capacity)
+
+	sendWorkerReply(w, &reg)
+}
+
+func unregisterWorker(w http.ResponseWriter, r *http.Request) {
+	if !checkWorkerToken(w, r) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if err := test161.UnregisterWorker(id); err != nil {
+		sendWorkerError(w, err)
+		return
+	}
+	logger.Println("Unregistered worker", id)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func pollWorker(w http.ResponseWriter, r *http.Request) {
+	if !checkWorkerToken(w, r) {
+		return
+	}
+
+	jobs, err := test161.PollWorker(mux.Vars(r)["id"], test161.WORKER_POLL_TIMEOUT)
+	if err != nil {
+		sendWorkerError(w, err)
+		return
+	}
+
+	sendWorkerReply(w, jobs)
+}
+
+func updateWorkerJob(w http.ResponseWriter, r *http.Request) {
+	if !checkWorkerToken(w, r) {
+		return
+	}
+
+	var update test161.WorkerUpdate
+	if !readWorkerRequest(w, r, MAX_WORKER_UPDATE, &update) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	if err := test161.UpdateWorkerJob(vars["id"], vars["job"], &update); err != nil {
+		sendWorkerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Send the job's OS/161 root directory as a gzipped tarball
+func workerJobRoot(w http.ResponseWriter, r *http.Request) {
+	if !checkWorkerToken(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	dir, err := test161.WorkerJobRoot(vars["id"], vars["job"])
+	if err != nil {
+		sendWorkerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.WriteHeader(http.StatusOK)
+	if err = test161.WriteTarball(w, dir); err != nil {
+		// Too late to change the status, but the worker will fail to
+		// extract the truncated tarball.
+		logger.Println("Error sending root directory:", err)
+	}
+}
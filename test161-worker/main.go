@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jay1999ke/test161"
+)
+
+// test161 Worker
+//
+// A worker registers with a test161-server and runs tests for it. Workers
+// need sys161 and the other OS/161 tools installed, just like the server.
+
+var logger = log.New(os.Stderr, "test161-worker: ", log.LstdFlags)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage:
+    test161-worker [-server <url>] [-token <token>] [-name <name>]
+                   [-capacity <capacity>] [-dir <dir>]
+
+The worker token can also be set with TEST161_WORKER_TOKEN. The capacity is
+either a number of tests, or a list like "tests=8 cpus=16 memory=1G".
+`)
+}
+
+func main() {
+	hostname, _ := os.Hostname()
+
+	flags := flag.NewFlagSet("test161-worker", flag.ExitOnError)
+	flags.Usage = usage
+	server := flags.String("server", "http://localhost:4000", "")
+	token := flags.String("token", os.Getenv("TEST161_WORKER_TOKEN"), "")
+	name := flags.String("name", hostname, "")
+	capacity := flags.String("capacity", fmt.Sprintf("%v", runtime.NumCPU()), "")
+	dir := flags.String("dir", path.Join(os.Getenv("HOME"), ".test161", "worker"), "")
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() > 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, "A worker token is required (-token or TEST161_WORKER_TOKEN)")
+		os.Exit(1)
+	}
+
+	res, err := test161.ParseResources(*capacity)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	w, err := newWorker(strings.TrimRight(*server, "/"), *token, *name, res, *dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error setting up worker:", err)
+		os.Exit(1)
+	}
+
+	// Unregister on the way out so the server re-queues our jobs right away
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signalChan
+		logger.Println("Shutting down")
+		w.unregister()
+		os.Exit(0)
+	}()
+
+	for {
+		if err := w.register(); err != nil {
+			logger.Println("Error registering with server:", err)
+			time.Sleep(RETRY_INTERVAL)
+			continue
+		}
+		logger.Printf("Registered with %v as %v (capacity %v)\n", w.server, w.id, w.capacity)
+		w.pollLoop()
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/jay1999ke/test161"
+)
+
+// How long to wait before retrying a failed request to the server
+const RETRY_INTERVAL = 5 * time.Second
+
+// Requests include downloading root directories, so be generous
+const REQUEST_TIMEOUT = 5 * time.Minute
+
+type worker struct {
+	server   string
+	token    string
+	name     string
+	capacity test161.Resources
+	dir      string
+	client   *http.Client
+
+	// l protects the following
+	l     sync.Mutex
+	id    string
+	roots map[string]*rootEntry
+}
+
+// A cached root directory, shared by all jobs with the same RootID
+type rootEntry struct {
+	l     sync.Mutex
+	dir   string
+	ready bool
+}
+
+// An error response from the server
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%v %v: %v", e.code, http.StatusText(e.code), e.msg)
+}
+
+func isStatus(err error, codes ...int) bool {
+	if se, ok := err.(*statusError); ok {
+		for _, code := range codes {
+			if se.code == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newWorker(server, token, name string, capacity test161.Resources, dir string) (*worker, error) {
+	// Root directories from a previous run could be stale
+	roots := path.Join(dir, "roots")
+	if err := os.RemoveAll(roots); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(roots, 0770); err != nil {
+		return nil, err
+	}
+
+	return &worker{
+		server:   server,
+		token:    token,
+		name:     name,
+		capacity: capacity,
+		dir:      dir,
+		client:   &http.Client{Timeout: REQUEST_TIMEOUT},
+		roots:    make(map[string]*rootEntry),
+	}, nil
+}
+
+// Send a request to the server. Responses other than StatusOK are returned
+// as a statusError.
+func (w *worker) do(method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, w.server+url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(test161.WORKER_TOKEN_HEADER, w.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, &statusError{resp.StatusCode, string(msg)}
+	}
+	return resp, nil
+}
+
+func (w *worker) getID() string {
+	w.l.Lock()
+	defer w.l.Unlock()
+	return w.id
+}
+
+func (w *worker) register() error {
+	data, err := json.Marshal(&test161.WorkerRegistration{
+		Name:     w.name,
+		Capacity: w.capacity,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.do("POST", "/api-v1/workers", data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reg test161.WorkerRegistration
+	if err = json.NewDecoder(resp.Body).Decode(&reg); err != nil {
+		return err
+	}
+
+	w.l.Lock()
+	w.id = reg.ID
+	w.l.Unlock()
+	return nil
+}
+
+func (w *worker) unregister() {
+	if resp, err := w.do("DELETE", "/api-v1/workers/"+w.getID(), nil); err != nil {
+		logger.Println("Error unregistering:", err)
+	} else {
+		resp.Body.Close()
+	}
+}
+
+// Poll for jobs until the server forgets about us, which happens if we lose
+// contact for too long.
+func (w *worker) pollLoop() {
+	id := w.getID()
+	for {
+		resp, err := w.do("POST", fmt.Sprintf("/api-v1/workers/%v/poll", id), nil)
+		if isStatus(err, http.StatusNotFound) {
+			logger.Println("The server no longer knows this worker, re-registering")
+			return
+		} else if err != nil {
+			logger.Println("Error polling for jobs:", err)
+			time.Sleep(RETRY_INTERVAL)
+			continue
+		}
+
+		var jobs []*test161.WorkerJob
+		err = json.NewDecoder(resp.Body).Decode(&jobs)
+		resp.Body.Close()
+		if err != nil {
+			logger.Println("Error decoding jobs:", err)
+			continue
+		}
+
+		for _, job := range jobs {
+			go w.runJob(id, job)
+		}
+	}
+}
+
+func (w *worker) runJob(id string, job *test161.WorkerJob) {
+	up := newUploader(w, fmt.Sprintf("/api-v1/workers/%v/jobs/%v", id, job.ID))
+
+	if root, err := w.root(id, job); err != nil {
+		logger.Printf("Error getting root directory for job %v: %v\n", job.ID, err)
+		up.send(test161.WorkerJobFailed(job, err), true)
+	} else {
+		logger.Printf("Running %v (job %v)\n", job.Test.DependencyID, job.ID)
+		test161.RunWorkerJob(job, root, logger, up.send)
+	}
+
+	up.wait()
+	logger.Printf("Finished job %v\n", job.ID)
+}
+
+// Get the root directory for a job, downloading it if we don't have it yet.
+func (w *worker) root(id string, job *test161.WorkerJob) (string, error) {
+	w.l.Lock()
+	entry, ok := w.roots[job.RootID]
+	if !ok {
+		entry = &rootEntry{dir: path.Join(w.dir, "roots", job.RootID)}
+		w.roots[job.RootID] = entry
+	}
+	w.l.Unlock()
+
+	// Jobs that need the same root wait for the first one to download it
+	entry.l.Lock()
+	defer entry.l.Unlock()
+
+	if entry.ready {
+		return entry.dir, nil
+	}
+
+	resp, err := w.do("GET", fmt.Sprintf("/api-v1/workers/%v/jobs/%v/root", id, job.ID), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	tmp := entry.dir + ".tmp"
+	os.RemoveAll(tmp)
+	if err = test161.ExtractTarball(resp.Body, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	if err = os.Rename(tmp, entry.dir); err != nil {
+		return "", err
+	}
+
+	entry.ready = true
+	return entry.dir, nil
+}
+
+// An uploader sends a job's updates to the server in the background. Only
+// the most recent update matters, so updates that arrive while one is being
+// sent replace each other. The final update is retried until the server
+// accepts it or tells us it doesn't want it.
+type uploader struct {
+	w    *worker
+	url  string
+	done chan struct{}
+
+	// l protects the following
+	l        sync.Mutex
+	latest   []byte
+	complete bool
+	busy     bool
+}
+
+func newUploader(w *worker, url string) *uploader {
+	return &uploader{
+		w:    w,
+		url:  url,
+		done: make(chan struct{}),
+	}
+}
+
+func (u *uploader) send(data []byte, complete bool) {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	u.latest = data
+	u.complete = u.complete || complete
+	if !u.busy {
+		u.busy = true
+		go u.loop()
+	}
+}
+
+// Wait for the final update to be sent
+func (u *uploader) wait() {
+	<-u.done
+}
+
+func (u *uploader) loop() {
+	for {
+		u.l.Lock()
+		data, complete := u.latest, u.complete
+		if data == nil {
+			u.busy = false
+			u.l.Unlock()
+			return
+		}
+		u.latest = nil
+		u.l.Unlock()
+
+		if complete {
+			u.sendFinal(data)
+			close(u.done)
+			return
+		}
+
+		if err := u.post(data); err != nil {
+			logger.Println("Error sending test update:", err)
+		}
+	}
+}
+
+func (u *uploader) sendFinal(data []byte) {
+	for {
+		err := u.post(data)
+		if err == nil {
+			return
+		} else if isStatus(err, http.StatusNotFound, http.StatusGone) {
+			// The job was re-queued, so our results don't matter
+			logger.Println("The server dropped the job:", err)
+			return
+		}
+		logger.Println("Error sending test results, retrying:", err)
+		time.Sleep(RETRY_INTERVAL)
+	}
+}
+
+func (u *uploader) post(data []byte) error {
+	resp, err := u.w.do("POST", u.url, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
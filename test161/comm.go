@@ -9,9 +9,10 @@ import (
 type PostEndpoint string
 
 const (
-	ApiEndpointSubmit   PostEndpoint = "/api-v1/submit"
-	ApiEndpointValidate              = "/api-v1/validate"
-	ApiEndpointUpload                = "/api-v1/upload"
+	ApiEndpointSubmit          PostEndpoint = "/api-v1/submit"
+	ApiEndpointValidate                     = "/api-v1/validate"
+	ApiEndpointUpload                       = "/api-v1/upload"
+	ApiEndpointSubmissionTests              = "/api-v1/submissions/tests"
 )
 
 type SupportedPostType string
@@ -28,6 +28,10 @@ var KEYS_DIR = path.Join(os.Getenv("HOME"), ".test161/keys")
 var USAGE_DIR = path.Join(os.Getenv("HOME"), ".test161/usage")
 var USAGE_LOCK_FILE = path.Join(os.Getenv("HOME"), ".test161/usage/usage.lock")
 var CUR_USAGE_LOCK_FILE = path.Join(os.Getenv("HOME"), ".test161/usage/current.lock")
+var LAST_RUN_FILE = path.Join(os.Getenv("HOME"), ".test161/lastrun.json")
+var WALLTIMES_FILE = path.Join(os.Getenv("HOME"), ".test161/walltimes.json")
+var RESULT_CACHE_DIR = path.Join(os.Getenv("HOME"), ".test161/results")
+var HISTORY_DIR = path.Join(os.Getenv("HOME"), ".test161/history")
 
 type ClientConf struct {
 	// These are now the only thing we put in the yaml file.
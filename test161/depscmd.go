@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jay1999ke/test161"
+	"github.com/jay1999ke/test161/graph"
+)
+
+// 'test161 list deps' flags
+var listDepsVars struct {
+	format  string
+	points  bool
+	tags    bool
+	results bool
+	reverse bool
+	args    []string
+}
+
+const (
+	DEPS_FORMAT_DOT     = "dot"
+	DEPS_FORMAT_MERMAID = "mermaid"
+	DEPS_FORMAT_JSON    = "json"
+	DEPS_FORMAT_TEXT    = "text"
+)
+
+// Node colors for the last run's results
+const (
+	DEPS_COLOR_FAILED   = "#f4cccc"
+	DEPS_COLOR_BLOCKED  = "#fce5cd"
+	DEPS_COLOR_CORRECT  = "#d9ead3"
+	DEPS_STROKE_FAILED  = "red"
+	DEPS_STROKE_BLOCKED = "orange"
+)
+
+func getListDepsArgs() error {
+	flags := flag.NewFlagSet("test161 list deps", flag.ExitOnError)
+	flags.Usage = usage
+	flags.StringVar(&listDepsVars.format, "format", "", "")
+	flags.StringVar(&listDepsVars.format, "f", "", "")
+	flags.BoolVar(&listDepsVars.points, "points", false, "")
+	flags.BoolVar(&listDepsVars.tags, "tags", false, "")
+	flags.BoolVar(&listDepsVars.results, "results", false, "")
+	flags.BoolVar(&listDepsVars.reverse, "reverse", false, "")
+	flags.BoolVar(&listDepsVars.reverse, "r", false, "")
+
+	flags.Parse(os.Args[3:]) // this may exit
+
+	listDepsVars.args = flags.Args()
+
+	// The graph defaults to DOT, the reverse dependency report to text
+	if listDepsVars.format == "" {
+		if listDepsVars.reverse {
+			listDepsVars.format = DEPS_FORMAT_TEXT
+		} else {
+			listDepsVars.format = DEPS_FORMAT_DOT
+		}
+	}
+
+	switch listDepsVars.format {
+	case DEPS_FORMAT_DOT, DEPS_FORMAT_MERMAID, DEPS_FORMAT_JSON:
+	case DEPS_FORMAT_TEXT:
+		if !listDepsVars.reverse {
+			return errors.New("format 'text' is only available with -reverse")
+		}
+	default:
+		return errors.New("format must be one of 'dot', 'mermaid', 'json', or 'text'")
+	}
+
+	if listDepsVars.reverse && len(listDepsVars.args) == 0 {
+		return errors.New("test161 list deps -reverse requires at least one test")
+	}
+
+	return nil
+}
+
+// Get the group of tests whose dependency graph we're showing. This is either
+// a target, a set of test expressions, or every test.
+func getDepsGroup(args []string) (*test161.TestGroup, []error) {
+	if len(args) == 1 {
+		if target, ok := env.Targets[args[0]]; ok {
+			return target.Instance(env)
+		}
+	}
+
+	if len(args) == 0 {
+		args = []string{"**/*.t"}
+	}
+
+	config := &test161.GroupConfig{
+		Name:    "deps",
+		UseDeps: true,
+		Tests:   args,
+		Env:     env,
+	}
+	return test161.GroupFromConfig(config)
+}
+
+// test161 list deps [-format dot|mermaid|json] [-points] [-tags] [-results] [tests|target]
+// test161 list deps -reverse [-format text|json|dot|mermaid] <tests>
+func doListDeps() int {
+	if err := getListDepsArgs(); err != nil {
+		printRunError(err)
+		return 1
+	}
+
+	if listDepsVars.reverse {
+		return doListReverseDeps()
+	}
+
+	tg, errs := getDepsGroup(listDepsVars.args)
+	if len(errs) > 0 {
+		printRunErrors(errs)
+		return 1
+	}
+
+	g, err := tg.DependencyGraph()
+	if err != nil {
+		printRunError(err)
+		return 1
+	}
+
+	var results map[string]test161.TestResult
+	if listDepsVars.results {
+		run, err := loadLastRun()
+		if err != nil {
+			printRunError(err)
+			return 1
+		} else if run == nil {
+			printRunError(errors.New("There are no results yet. Use 'test161 run' first."))
+			return 1
+		}
+		results = run.Results
+	}
+
+	opts := &graph.ExportOptions{
+		Name:  tg.Config.Name,
+		Style: depsNodeStyle(g, tg, results),
+	}
+
+	switch listDepsVars.format {
+	case DEPS_FORMAT_DOT:
+		fmt.Print(g.DOT(opts))
+	case DEPS_FORMAT_MERMAID:
+		fmt.Print(g.Mermaid(opts))
+	case DEPS_FORMAT_JSON:
+		text, err := g.JSON(opts)
+		if err != nil {
+			printRunError(err)
+			return 1
+		}
+		fmt.Println(text)
+	}
+
+	return 0
+}
+
+// Find the tests blocked by a failure, i.e. everything that transitively
+// depends on a test that didn't pass.
+func blockedTests(g *graph.Graph, results map[string]test161.TestResult) map[string]bool {
+	failed := make([]string, 0)
+	for name := range g.NodeMap {
+		if isFailedResult(results[name]) {
+			failed = append(failed, name)
+		}
+	}
+
+	blocked := make(map[string]bool)
+	for _, name := range g.Dependents(failed...) {
+		blocked[name] = true
+	}
+	return blocked
+}
+
+func isFailedResult(res test161.TestResult) bool {
+	return res == test161.TEST_RESULT_INCORRECT || res == test161.TEST_RESULT_ABORT
+}
+
+// Create the function that styles each node according to the flags.
+func depsNodeStyle(g *graph.Graph, tg *test161.TestGroup,
+	results map[string]test161.TestResult) func(n *graph.Node) *graph.NodeStyle {
+
+	blocked := blockedTests(g, results)
+
+	return func(n *graph.Node) *graph.NodeStyle {
+		test := tg.Tests[n.Name]
+		style := &graph.NodeStyle{
+			Data: make(map[string]interface{}),
+		}
+
+		lines := []string{n.Name}
+
+		if listDepsVars.points {
+			style.Data["points"] = test.PointsAvailable
+			if test.PointsAvailable > 0 {
+				lines = append(lines, fmt.Sprintf("points: %v", test.PointsAvailable))
+			}
+		}
+
+		if listDepsVars.tags {
+			tags := append([]string{}, test.Tags...)
+			sort.Strings(tags)
+			style.Data["tags"] = tags
+			if len(tags) > 0 {
+				lines = append(lines, "tags: "+strings.Join(tags, ", "))
+			}
+		}
+
+		if results != nil {
+			res, ok := results[n.Name]
+			if !ok {
+				res = test161.TEST_RESULT_NONE
+			}
+			style.Data["result"] = res
+			style.Data["blocked"] = blocked[n.Name]
+			lines = append(lines, string(res))
+
+			if isFailedResult(res) {
+				style.FillColor = DEPS_COLOR_FAILED
+				style.Color = DEPS_STROKE_FAILED
+			} else if blocked[n.Name] {
+				style.FillColor = DEPS_COLOR_BLOCKED
+				style.Color = DEPS_STROKE_BLOCKED
+			} else if res == test161.TEST_RESULT_CORRECT {
+				style.FillColor = DEPS_COLOR_CORRECT
+			}
+		}
+
+		style.Label = strings.Join(lines, "\n")
+		return style
+	}
+}
+
+// The impact of a set of failed tests on a target
+type targetImpact struct {
+	Target        string   `json:"target"`
+	Tests         []string `json:"tests"`
+	PointsBlocked uint     `json:"points_blocked"`
+	PointsTotal   uint     `json:"points_total"`
+}
+
+// What happens if some tests fail
+type reverseDeps struct {
+	Tests   []string        `json:"tests"`
+	Blocked []string        `json:"blocked"`
+	Targets []*targetImpact `json:"targets"`
+}
+
+// Find the tests and target points blocked if the given tests fail.
+func getReverseDeps(args []string) (*reverseDeps, *graph.Graph, []error) {
+	config := &test161.GroupConfig{
+		Name:    "reverse",
+		UseDeps: false,
+		Tests:   args,
+		Env:     env,
+	}
+	roots, errs := test161.GroupFromConfig(config)
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	all, errs := getDepsGroup(nil)
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	g, err := all.DependencyGraph()
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	rd := &reverseDeps{
+		Tests:   make([]string, 0, len(roots.Tests)),
+		Blocked: make([]string, 0),
+		Targets: make([]*targetImpact, 0),
+	}
+
+	failed := make(map[string]bool)
+	for id := range roots.Tests {
+		rd.Tests = append(rd.Tests, id)
+		failed[id] = true
+	}
+	sort.Strings(rd.Tests)
+
+	for _, id := range g.Dependents(rd.Tests...) {
+		if !failed[id] {
+			rd.Blocked = append(rd.Blocked, id)
+		}
+	}
+
+	affected := make(map[string]bool)
+	for _, id := range append(rd.Tests, rd.Blocked...) {
+		affected[id] = true
+	}
+
+	// Point impact on each target
+	names := make([]string, 0, len(env.Targets))
+	for name := range env.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		tg, errs := env.Targets[name].Instance(env)
+		if len(errs) > 0 {
+			fmt.Fprintf(os.Stderr, "Skipping target %v: %v\n", name, errs[0])
+			continue
+		}
+		impact := &targetImpact{
+			Target:      name,
+			Tests:       make([]string, 0),
+			PointsTotal: tg.TotalPoints(),
+		}
+		for id, test := range tg.Tests {
+			if affected[id] {
+				impact.Tests = append(impact.Tests, id)
+				impact.PointsBlocked += test.PointsAvailable
+			}
+		}
+		if len(impact.Tests) > 0 {
+			sort.Strings(impact.Tests)
+			rd.Targets = append(rd.Targets, impact)
+		}
+	}
+
+	return rd, g, nil
+}
+
+func doListReverseDeps() int {
+	rd, g, errs := getReverseDeps(listDepsVars.args)
+	if len(errs) > 0 {
+		printRunErrors(errs)
+		return 1
+	}
+
+	// Failed tests in red and what they block in orange
+	failed := make(map[string]bool)
+	for _, id := range rd.Tests {
+		failed[id] = true
+	}
+	sub := g.Subgraph(append(append([]string{}, rd.Tests...), rd.Blocked...))
+	opts := &graph.ExportOptions{
+		Name: "reverse",
+		Style: func(n *graph.Node) *graph.NodeStyle {
+			if failed[n.Name] {
+				return &graph.NodeStyle{Color: DEPS_STROKE_FAILED, FillColor: DEPS_COLOR_FAILED}
+			}
+			return &graph.NodeStyle{Color: DEPS_STROKE_BLOCKED, FillColor: DEPS_COLOR_BLOCKED}
+		},
+	}
+
+	switch listDepsVars.format {
+	case DEPS_FORMAT_DOT:
+		fmt.Print(sub.DOT(opts))
+	case DEPS_FORMAT_MERMAID:
+		fmt.Print(sub.Mermaid(opts))
+	case DEPS_FORMAT_JSON:
+		data, err := json.MarshalIndent(rd, "", "  ")
+		if err != nil {
+			printRunError(err)
+			return 1
+		}
+		fmt.Println(string(data))
+	case DEPS_FORMAT_TEXT:
+		printReverseDeps(rd)
+	}
+
+	return 0
+}
+
+func printReverseDeps(rd *reverseDeps) {
+	fmt.Println()
+	fmt.Printf("Tests blocked if %v fails: %v\n", strings.Join(rd.Tests, ", "), len(rd.Blocked))
+
+	if len(rd.Blocked) > 0 {
+		pd := &PrintData{
+			Headings: []*Heading{
+				&Heading{
+					Text: "Test ID",
+				},
+			},
+			Rows:   make(Rows, 0),
+			Config: defaultPrintConf,
+		}
+		for _, id := range rd.Blocked {
+			pd.Rows = append(pd.Rows, Row{&Cell{Text: id}})
+		}
+		fmt.Println()
+		pd.Print()
+	}
+
+	if len(rd.Targets) > 0 {
+		pd := &PrintData{
+			Headings: []*Heading{
+				&Heading{
+					Text: "Target",
+				},
+				&Heading{
+					Text:           "Tests",
+					RightJustified: true,
+				},
+				&Heading{
+					Text:           "Points Blocked",
+					RightJustified: true,
+				},
+				&Heading{
+					Text:           "Total Points",
+					RightJustified: true,
+				},
+			},
+			Rows:   make(Rows, 0),
+			Config: defaultPrintConf,
+		}
+		for _, impact := range rd.Targets {
+			pd.Rows = append(pd.Rows, Row{
+				&Cell{Text: impact.Target},
+				&Cell{Text: fmt.Sprintf("%v", len(impact.Tests))},
+				&Cell{Text: fmt.Sprintf("%v", impact.PointsBlocked)},
+				&Cell{Text: fmt.Sprintf("%v", impact.PointsTotal)},
+			})
+		}
+		fmt.Println()
+		pd.Print()
+	}
+
+	fmt.Println()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jay1999ke/test161"
+)
+
+// An event stream requested with 'test161 run -events ndjson[=file]'
+type eventsSpec struct {
+	format string
+	file   string // "-" for stdout
+}
+
+const EVENTS_NDJSON = "ndjson"
+
+// Parse the -events argument. Without a file, events go to stdout.
+func parseEventsSpec(arg string) (*eventsSpec, error) {
+	parts := strings.SplitN(strings.TrimSpace(arg), "=", 2)
+	spec := &eventsSpec{format: parts[0], file: "-"}
+	if len(parts) == 2 {
+		spec.file = parts[1]
+		if len(spec.file) == 0 {
+			return nil, fmt.Errorf("Invalid events '%v', expected ndjson or ndjson=file", arg)
+		}
+	}
+	if spec.format != EVENTS_NDJSON {
+		return nil, fmt.Errorf("Unknown events format '%v', only ndjson is supported", spec.format)
+	}
+	return spec, nil
+}
+
+func (spec *eventsSpec) toStdout() bool {
+	return spec.file == "-"
+}
+
+// Open the event stream. The returned closer finishes the file, if any.
+func (spec *eventsSpec) open() (*test161.EventPersistence, io.Closer, error) {
+	if spec.toStdout() {
+		return test161.NewEventPersistence(os.Stdout), nil, nil
+	}
+	file, err := os.Create(spec.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return test161.NewEventPersistence(file), file, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEventsSpec(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	spec, err := parseEventsSpec("ndjson")
+	assert.Nil(err)
+	assert.True(spec.toStdout())
+
+	spec, err = parseEventsSpec("ndjson=events.json")
+	assert.Nil(err)
+	assert.Equal("events.json", spec.file)
+	assert.False(spec.toStdout())
+
+	_, err = parseEventsSpec("ndjson=")
+	assert.NotNil(err)
+	_, err = parseEventsSpec("xml")
+	assert.NotNil(err)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jay1999ke/test161"
+)
+
+// The local history of 'test161 run' results, which 'test161 history' lists
+// and 'test161 compare' compares. Each run is saved in its own file, named by
+// its run ID, which counts up from 1.
+
+const HISTORY_FILE_EXT = ".json"
+
+type historyTest struct {
+	Result          test161.TestResult `json:"result"`
+	PointsEarned    uint               `json:"points_earned"`
+	PointsAvailable uint               `json:"points_avail"`
+	TargetName      string             `json:"target,omitempty"`
+	Seed            uint32             `json:"seed"`
+}
+
+type historyRun struct {
+	ID         int                     `json:"id"`
+	Name       string                  `json:"name"`
+	Time       time.Time               `json:"time"`
+	Commit     string                  `json:"commit,omitempty"`
+	Dirty      bool                    `json:"dirty,omitempty"`
+	KernelHash string                  `json:"kernel_hash,omitempty"`
+	Tests      map[string]*historyTest `json:"tests"`
+}
+
+func newHistoryRun(tg *test161.TestGroup, name string, end time.Time) *historyRun {
+	run := &historyRun{
+		Name:  name,
+		Time:  end,
+		Tests: make(map[string]*historyTest),
+	}
+	for id, test := range tg.Tests {
+		run.Tests[id] = &historyTest{
+			Result:          test.Result,
+			PointsEarned:    test.PointsEarned,
+			PointsAvailable: test.PointsAvailable,
+			TargetName:      test.TargetName,
+			Seed:            test.Sys161.Random,
+		}
+	}
+	return run
+}
+
+// Record the source tree and kernel the run used. Either may be unknown, in
+// which case it's left empty.
+func (run *historyRun) setSourceInfo(srcDir, rootDir string) {
+	if len(srcDir) > 0 {
+		git := &gitRepo{dir: srcDir}
+		commitCmd := &gitCmdSpec{cmdline: "git rev-parse HEAD"}
+		if commit, err := git.doOneCommand(commitCmd); err == nil {
+			run.Commit = commit
+			run.Dirty, _ = git.isLocalDirty(false)
+		}
+	}
+
+	if len(rootDir) > 0 {
+		if f, err := os.Open(path.Join(rootDir, "kernel")); err == nil {
+			defer f.Close()
+			h := sha256.New()
+			if _, err = io.Copy(h, f); err == nil {
+				run.KernelHash = fmt.Sprintf("%x", h.Sum(nil))
+			}
+		}
+	}
+}
+
+// A short description of the source, e.g. 1a2b3c4d+ for a modified tree.
+func (run *historyRun) commitString() string {
+	if len(run.Commit) == 0 {
+		return "-"
+	}
+	commit := run.Commit
+	if len(commit) > 8 {
+		commit = commit[:8]
+	}
+	if run.Dirty {
+		commit += "+"
+	}
+	return commit
+}
+
+func (run *historyRun) correct() int {
+	correct := 0
+	for _, test := range run.Tests {
+		if test.Result == test161.TEST_RESULT_CORRECT {
+			correct += 1
+		}
+	}
+	return correct
+}
+
+// The points earned and available for each target in the run
+func (run *historyRun) scores() map[string]*scoreMapEntry {
+	scores := make(map[string]*scoreMapEntry)
+	for _, test := range run.Tests {
+		if len(test.TargetName) == 0 {
+			continue
+		}
+		entry, ok := scores[test.TargetName]
+		if !ok {
+			entry = &scoreMapEntry{TargetName: test.TargetName}
+			scores[test.TargetName] = entry
+		}
+		entry.Earned += test.PointsEarned
+		entry.Avail += test.PointsAvailable
+	}
+	return scores
+}
+
+func historyFile(dir string, id int) string {
+	return path.Join(dir, fmt.Sprintf("%06d%v", id, HISTORY_FILE_EXT))
+}
+
+// The IDs of the runs in the history, oldest first
+func historyIDs(dir string) ([]int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []int{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(files))
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, HISTORY_FILE_EXT) {
+			continue
+		}
+		if id, err := strconv.Atoi(strings.TrimSuffix(name, HISTORY_FILE_EXT)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// Save a run in the history, giving it the next run ID.
+func saveHistoryRun(dir string, run *historyRun) error {
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return err
+	}
+	ids, err := historyIDs(dir)
+	if err != nil {
+		return err
+	}
+
+	run.ID = 1
+	if len(ids) > 0 {
+		run.ID = ids[len(ids)-1] + 1
+	}
+
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Don't overwrite a run another test161 saved in the meantime
+	file, err := os.OpenFile(historyFile(dir, run.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0664)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(data)
+	return err
+}
+
+func loadHistoryRun(dir string, id int) (*historyRun, error) {
+	data, err := ioutil.ReadFile(historyFile(dir, id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("There is no run %v in your history", id)
+	} else if err != nil {
+		return nil, err
+	}
+
+	run := &historyRun{}
+	if err = json.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("Unable to read run %v: %v", id, err)
+	}
+	return run, nil
+}
+
+// Find a run by its ID, or relative to the most recent run: 'last' is the
+// most recent run and 'last~N' is N runs before it.
+func findHistoryRun(dir, spec string) (*historyRun, error) {
+	if id, err := strconv.Atoi(spec); err == nil {
+		return loadHistoryRun(dir, id)
+	}
+
+	back := 0
+	if spec != "last" {
+		if !strings.HasPrefix(spec, "last~") {
+			return nil, fmt.Errorf("Invalid run '%v', expected a run ID, last or last~N", spec)
+		}
+		var err error
+		if back, err = strconv.Atoi(strings.TrimPrefix(spec, "last~")); err != nil || back < 0 {
+			return nil, fmt.Errorf("Invalid run '%v', expected a run ID, last or last~N", spec)
+		}
+	}
+
+	ids, err := historyIDs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if back >= len(ids) {
+		return nil, fmt.Errorf("Your history doesn't have a run %v", spec)
+	}
+	return loadHistoryRun(dir, ids[len(ids)-1-back])
+}
+
+// How two runs differ
+type runComparison struct {
+	Regressed []string // Correct before, not now
+	Fixed     []string // Correct now, not before
+	Added     []string // Only in the second run
+	Removed   []string // Only in the first run
+	Scores    []*scoreDelta
+}
+
+type scoreDelta struct {
+	TargetName string
+	Before     *scoreMapEntry // nil if the target wasn't run
+	After      *scoreMapEntry
+}
+
+func (d *scoreDelta) change() int {
+	change := 0
+	if d.Before != nil {
+		change -= int(d.Before.Earned)
+	}
+	if d.After != nil {
+		change += int(d.After.Earned)
+	}
+	return change
+}
+
+func compareRuns(before, after *historyRun) *runComparison {
+	cmp := &runComparison{
+		Regressed: []string{},
+		Fixed:     []string{},
+		Added:     []string{},
+		Removed:   []string{},
+		Scores:    []*scoreDelta{},
+	}
+
+	for id, test := range after.Tests {
+		prev, ok := before.Tests[id]
+		if !ok {
+			cmp.Added = append(cmp.Added, id)
+			continue
+		}
+		passed := test.Result == test161.TEST_RESULT_CORRECT
+		passedBefore := prev.Result == test161.TEST_RESULT_CORRECT
+		if passedBefore && !passed {
+			cmp.Regressed = append(cmp.Regressed, id)
+		} else if passed && !passedBefore {
+			cmp.Fixed = append(cmp.Fixed, id)
+		}
+	}
+	for id := range before.Tests {
+		if _, ok := after.Tests[id]; !ok {
+			cmp.Removed = append(cmp.Removed, id)
+		}
+	}
+	sort.Strings(cmp.Regressed)
+	sort.Strings(cmp.Fixed)
+	sort.Strings(cmp.Added)
+	sort.Strings(cmp.Removed)
+
+	beforeScores, afterScores := before.scores(), after.scores()
+	targets := make([]string, 0)
+	for name := range beforeScores {
+		targets = append(targets, name)
+	}
+	for name := range afterScores {
+		if _, ok := beforeScores[name]; !ok {
+			targets = append(targets, name)
+		}
+	}
+	sort.Strings(targets)
+	for _, name := range targets {
+		cmp.Scores = append(cmp.Scores, &scoreDelta{
+			TargetName: name,
+			Before:     beforeScores[name],
+			After:      afterScores[name],
+		})
+	}
+
+	return cmp
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jay1999ke/test161"
+	"github.com/stretchr/testify/assert"
+)
+
+func historyTestRun(results map[string]test161.TestResult) *historyRun {
+	run := &historyRun{
+		Name:  "asst1",
+		Time:  time.Now(),
+		Tests: make(map[string]*historyTest),
+	}
+	for id, res := range results {
+		test := &historyTest{
+			Result:          res,
+			PointsAvailable: 10,
+			TargetName:      "asst1",
+		}
+		if res == test161.TEST_RESULT_CORRECT {
+			test.PointsEarned = 10
+		}
+		run.Tests[id] = test
+	}
+	return run
+}
+
+func TestHistoryStore(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "test161-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ids, err := historyIDs(dir)
+	assert.Nil(err)
+	assert.Equal(0, len(ids))
+
+	for i := 0; i < 3; i++ {
+		run := historyTestRun(map[string]test161.TestResult{"boot.t": test161.TEST_RESULT_CORRECT})
+		assert.Nil(saveHistoryRun(dir, run))
+		assert.Equal(i+1, run.ID)
+	}
+
+	ids, err = historyIDs(dir)
+	assert.Nil(err)
+	assert.Equal([]int{1, 2, 3}, ids)
+
+	for spec, id := range map[string]int{"2": 2, "last": 3, "last~0": 3, "last~2": 1} {
+		run, err := findHistoryRun(dir, spec)
+		if assert.Nil(err, spec) {
+			assert.Equal(id, run.ID, spec)
+			assert.Equal(test161.TEST_RESULT_CORRECT, run.Tests["boot.t"].Result)
+		}
+	}
+	for _, spec := range []string{"4", "last~3", "last~x", "first"} {
+		_, err := findHistoryRun(dir, spec)
+		assert.NotNil(err, spec)
+	}
+}
+
+func TestCompareRuns(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	before := historyTestRun(map[string]test161.TestResult{
+		"boot.t":      test161.TEST_RESULT_CORRECT,
+		"sync/sem1.t": test161.TEST_RESULT_CORRECT,
+		"sync/lt1.t":  test161.TEST_RESULT_INCORRECT,
+		"sync/cv1.t":  test161.TEST_RESULT_CORRECT,
+	})
+	after := historyTestRun(map[string]test161.TestResult{
+		"boot.t":      test161.TEST_RESULT_CORRECT,
+		"sync/sem1.t": test161.TEST_RESULT_INCORRECT,
+		"sync/lt1.t":  test161.TEST_RESULT_CORRECT,
+		"sync/lt2.t":  test161.TEST_RESULT_SKIP,
+	})
+
+	cmp := compareRuns(before, after)
+	assert.Equal([]string{"sync/sem1.t"}, cmp.Regressed)
+	assert.Equal([]string{"sync/lt1.t"}, cmp.Fixed)
+	assert.Equal([]string{"sync/lt2.t"}, cmp.Added)
+	assert.Equal([]string{"sync/cv1.t"}, cmp.Removed)
+
+	if assert.Equal(1, len(cmp.Scores)) {
+		delta := cmp.Scores[0]
+		assert.Equal("asst1", delta.TargetName)
+		assert.Equal(uint(30), delta.Before.Earned)
+		assert.Equal(uint(20), delta.After.Earned)
+		assert.Equal(uint(40), delta.After.Avail)
+		assert.Equal(-10, delta.change())
+	}
+
+	assert.Equal("asst1 20/40", scoresString(after))
+
+	after.Commit = "0123456789abcdef"
+	after.Dirty = true
+	assert.Equal("01234567+", after.commitString())
+	assert.Equal("-", before.commitString())
+}
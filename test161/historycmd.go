@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 'test161 history' flags
+var historyCommandVars struct {
+	count int
+}
+
+// 'test161 compare' flags
+var compareCommandVars struct {
+	verbose string
+	runs    []string
+}
+
+// Save a finished 'test161 run' in the local history.
+func saveHistory(run *historyRun) error {
+	run.setSourceInfo(clientConf.SrcDir, clientConf.RootDir)
+	return saveHistoryRun(HISTORY_DIR, run)
+}
+
+// Scores of a run, e.g. "asst1 40/50, asst2 10/100"
+func scoresString(run *historyRun) string {
+	scores := run.scores()
+	names := make([]string, 0, len(scores))
+	for name := range scores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%v %v/%v", name, scores[name].Earned, scores[name].Avail))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func getHistoryArgs() error {
+	flags := flag.NewFlagSet("test161 history", flag.ExitOnError)
+	flags.Usage = usage
+	flags.IntVar(&historyCommandVars.count, "n", 20, "")
+
+	flags.Parse(os.Args[2:]) // this may exit
+
+	if len(flags.Args()) > 0 {
+		return errors.New("test161 history does not support positional arguments")
+	}
+	if historyCommandVars.count < 0 {
+		return errors.New("-n must be at least 0")
+	}
+	return nil
+}
+
+// test161 history [-n <count>]
+//
+// List the most recent runs, newest first. -n 0 lists every run.
+func doHistory() int {
+	if err := getHistoryArgs(); err != nil {
+		printRunError(err)
+		return 1
+	}
+
+	ids, err := historyIDs(HISTORY_DIR)
+	if err != nil {
+		printRunError(err)
+		return 1
+	}
+	if len(ids) == 0 {
+		fmt.Println("No runs yet. Every 'test161 run' is saved in your history.")
+		return 0
+	}
+	if count := historyCommandVars.count; count > 0 && count < len(ids) {
+		ids = ids[len(ids)-count:]
+	}
+
+	pd := &PrintData{
+		Headings: []*Heading{
+			&Heading{
+				Text:           "Run",
+				RightJustified: true,
+			},
+			&Heading{
+				Text: "Time",
+			},
+			&Heading{
+				Text:     "Tests",
+				MinWidth: 20,
+			},
+			&Heading{
+				Text: "Commit",
+			},
+			&Heading{
+				Text:           "Correct",
+				RightJustified: true,
+			},
+			&Heading{
+				Text: "Score",
+			},
+		},
+		Rows:   make(Rows, 0),
+		Config: defaultPrintConf,
+	}
+
+	for i := len(ids) - 1; i >= 0; i-- {
+		run, err := loadHistoryRun(HISTORY_DIR, ids[i])
+		if err != nil {
+			printRunError(err)
+			continue
+		}
+		name := run.Name
+		if len(name) == 0 {
+			name = "-"
+		}
+		correct := &Cell{Text: fmt.Sprintf("%v/%v", run.correct(), len(run.Tests))}
+		if run.correct() == len(run.Tests) {
+			correct.CellColor = COLOR_SUCCESS
+		} else {
+			correct.CellColor = COLOR_FAIL
+		}
+		pd.Rows = append(pd.Rows, []*Cell{
+			&Cell{Text: fmt.Sprintf("%v", run.ID)},
+			&Cell{Text: run.Time.Local().Format("2006-01-02 15:04")},
+			&Cell{Text: name},
+			&Cell{Text: run.commitString()},
+			correct,
+			&Cell{Text: scoresString(run)},
+		})
+	}
+
+	printTable(pd)
+
+	return 0
+}
+
+func getCompareArgs() error {
+	flags := flag.NewFlagSet("test161 compare", flag.ExitOnError)
+	flags.Usage = usage
+	flags.StringVar(&compareCommandVars.verbose, "verbose", VERBOSE_QUIET, "")
+	flags.StringVar(&compareCommandVars.verbose, "v", VERBOSE_QUIET, "")
+
+	flags.Parse(os.Args[2:]) // this may exit
+
+	// By default, compare the last run with the one before it
+	runs := flags.Args()
+	switch len(runs) {
+	case 0:
+		runs = []string{"last~1", "last"}
+	case 1:
+		runs = append(runs, "last")
+	case 2:
+	default:
+		return errors.New("test161 compare takes at most two runs")
+	}
+	compareCommandVars.runs = runs
+
+	switch compareCommandVars.verbose {
+	case VERBOSE_LOUD:
+	case VERBOSE_QUIET:
+	default:
+		return errors.New("verbose flag must be one of 'quiet' or 'loud'")
+	}
+
+	return nil
+}
+
+func describeRun(run *historyRun) string {
+	desc := fmt.Sprintf("run %v", run.ID)
+	if len(run.Name) > 0 {
+		desc += " (" + run.Name + ")"
+	}
+	desc += ", " + run.Time.Local().Format("2006-01-02 15:04")
+	if len(run.Commit) > 0 {
+		desc += ", commit " + run.commitString()
+	}
+	return desc
+}
+
+// test161 compare [-verbose quiet|loud] [<runA> [<runB>]]
+//
+// Show the tests that regressed or started passing between two runs, and
+// how the scores changed. Returns 1 if anything regressed.
+func doCompare() int {
+	if err := getCompareArgs(); err != nil {
+		printRunError(err)
+		return 1
+	}
+
+	before, err := findHistoryRun(HISTORY_DIR, compareCommandVars.runs[0])
+	if err != nil {
+		printRunError(err)
+		return 1
+	}
+	after, err := findHistoryRun(HISTORY_DIR, compareCommandVars.runs[1])
+	if err != nil {
+		printRunError(err)
+		return 1
+	}
+
+	cmp := compareRuns(before, after)
+
+	fmt.Println()
+	fmt.Println("From:", describeRun(before))
+	fmt.Println("To:  ", describeRun(after))
+	if before.KernelHash == after.KernelHash && len(before.KernelHash) > 0 {
+		fmt.Println("Both runs used the same kernel")
+	}
+
+	if len(cmp.Scores) > 0 {
+		pd := &PrintData{
+			Headings: []*Heading{
+				&Heading{
+					Text:     "Target",
+					MinWidth: 20,
+				},
+				&Heading{
+					Text:           "Before",
+					RightJustified: true,
+				},
+				&Heading{
+					Text:           "After",
+					RightJustified: true,
+				},
+				&Heading{
+					Text:           "Change",
+					RightJustified: true,
+				},
+			},
+			Rows:   make(Rows, 0),
+			Config: defaultPrintConf,
+		}
+		// The scores are part of a report, so they're always text
+		pd.Config.Format = FORMAT_TEXT
+
+		score := func(entry *scoreMapEntry) string {
+			if entry == nil {
+				return "-"
+			}
+			return fmt.Sprintf("%v/%v", entry.Earned, entry.Avail)
+		}
+		for _, delta := range cmp.Scores {
+			change := &Cell{Text: fmt.Sprintf("%+d", delta.change())}
+			if delta.change() > 0 {
+				change.CellColor = COLOR_SUCCESS
+			} else if delta.change() < 0 {
+				change.CellColor = COLOR_FAIL
+			}
+			pd.Rows = append(pd.Rows, []*Cell{
+				&Cell{Text: delta.TargetName},
+				&Cell{Text: score(delta.Before)},
+				&Cell{Text: score(delta.After)},
+				change,
+			})
+		}
+		fmt.Println()
+		pd.Print()
+	}
+
+	fmt.Println()
+	fmt.Printf("%v regressed, %v fixed\n", len(cmp.Regressed), len(cmp.Fixed))
+
+	printIDs := func(label string, paint func(...interface{}) string, ids []string) {
+		for _, id := range ids {
+			line := fmt.Sprintf("    %v %v", paint(fmt.Sprintf("%-9v", label)), id)
+			b, bok := before.Tests[id]
+			a, aok := after.Tests[id]
+			if bok && aok {
+				line += fmt.Sprintf(" (%v -> %v", b.Result, a.Result)
+				if b.PointsEarned != a.PointsEarned {
+					line += fmt.Sprintf(", %+d points", int(a.PointsEarned)-int(b.PointsEarned))
+				}
+				line += ")"
+			}
+			fmt.Println(line)
+		}
+	}
+	printIDs("regressed", COLOR_FAIL.SprintFunc(), cmp.Regressed)
+	printIDs("fixed", COLOR_SUCCESS.SprintFunc(), cmp.Fixed)
+	if compareCommandVars.verbose == VERBOSE_LOUD {
+		printIDs("added", fmt.Sprint, cmp.Added)
+		printIDs("removed", fmt.Sprint, cmp.Removed)
+	} else if len(cmp.Added)+len(cmp.Removed) > 0 {
+		fmt.Printf("%v tests only in the first run, %v only in the second (-v loud lists them)\n",
+			len(cmp.Removed), len(cmp.Added))
+	}
+	fmt.Println()
+
+	if len(cmp.Regressed) > 0 {
+		return 1
+	}
+	return 0
+}
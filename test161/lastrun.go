@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/jay1999ke/test161"
+)
+
+// The results of the most recent 'test161 run', which other commands use to
+// annotate their output.
+type lastRun struct {
+	Name    string                        `json:"name"`
+	Time    time.Time                     `json:"time"`
+	Results map[string]test161.TestResult `json:"results"`
+}
+
+func saveLastRun(tg *test161.TestGroup, name string, end time.Time) error {
+	run := &lastRun{
+		Name:    name,
+		Time:    end,
+		Results: make(map[string]test161.TestResult),
+	}
+	for id, test := range tg.Tests {
+		run.Results[id] = test.Result
+	}
+
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(path.Dir(LAST_RUN_FILE), 0770); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(LAST_RUN_FILE, data, 0664)
+}
+
+// Load the last run's results. Returns nil if nothing has been run yet.
+func loadLastRun() (*lastRun, error) {
+	data, err := ioutil.ReadFile(LAST_RUN_FILE)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	run := &lastRun{}
+	if err = json.Unmarshal(data, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
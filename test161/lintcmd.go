@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jay1999ke/test161"
+	color "gopkg.in/fatih/color.v0"
+)
+
+var lintFormat string
+
+func getLintArgs() (string, error) {
+	flags := flag.NewFlagSet("test161 lint", flag.ExitOnError)
+	flags.Usage = usage
+	flags.StringVar(&lintFormat, "format", "text", "")
+	flags.StringVar(&lintFormat, "f", "text", "")
+
+	flags.Parse(os.Args[2:]) // this may exit
+
+	if lintFormat != "text" && lintFormat != "json" {
+		return "", fmt.Errorf("Invalid lint format '%v'. Must be one of (text, json)", lintFormat)
+	}
+
+	args := flags.Args()
+	if len(args) > 1 {
+		return "", errors.New("test161 lint takes at most one test161 directory")
+	} else if len(args) == 1 {
+		return args[0], nil
+	}
+
+	return "", nil
+}
+
+// test161 lint [-format text|json] [dir]
+//
+// Lint the test161 directory, which is the configured one unless specified.
+// Returns 1 if there are any errors; warnings alone don't fail.
+func doLint() int {
+	dir, err := getLintArgs()
+	if err != nil {
+		printRunError(err)
+		return 1
+	}
+
+	if dir == "" {
+		envInit(&test161Command{reqEnv: true})
+		dir = clientConf.Test161Dir
+	}
+
+	report := test161.Lint(dir)
+
+	if lintFormat == "json" {
+		text, err := report.OutputJSON()
+		if err != nil {
+			printRunError(err)
+			return 1
+		}
+		fmt.Println(text)
+	} else {
+		printLintReport(report)
+	}
+
+	if report.Errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printLintReport(report *test161.LintReport) {
+	errColor := color.New(color.FgRed)
+	warnColor := color.New(color.FgYellow)
+
+	for _, p := range report.Problems {
+		loc := p.File
+		if p.Line > 0 {
+			loc = fmt.Sprintf("%v:%v", p.File, p.Line)
+		}
+		severity := warnColor.SprintFunc()(p.Severity)
+		if p.Severity == test161.LINT_ERROR {
+			severity = errColor.SprintFunc()(p.Severity)
+		}
+		fmt.Printf("%v: %v: %v [%v]\n", loc, severity, p.Message, p.Check)
+	}
+
+	if len(report.Problems) > 0 {
+		fmt.Println()
+	}
+	fmt.Printf("%v: %v error(s), %v warning(s)\n", report.Dir, report.Errors, report.Warnings)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/jay1999ke/test161"
 	"github.com/parnurzeal/gorequest"
 	color "gopkg.in/fatih/color.v0"
+	yaml "gopkg.in/yaml.v2"
 )
 
 var listRemoteFlag bool
@@ -22,6 +23,11 @@ var (
 	listTagsList  []string
 )
 
+var (
+	listTestsVerbose bool
+	listTestsExprs   []string
+)
+
 func doListCommand() int {
 	if len(os.Args) < 3 {
 		fmt.Fprintf(os.Stderr, "Missing argument to list command\n")
@@ -35,12 +41,14 @@ func doListCommand() int {
 		return doListTags()
 	case "tests":
 		return doListTests()
+	case "deps":
+		return doListDeps()
 	case "all":
 		return doListAll()
 	case "tagnames":
 		return doListTagnames()
 	default:
-		fmt.Fprintf(os.Stderr, "Invalid option to 'test161 list'.  Must be one of (targets, tags, tests)\n")
+		fmt.Fprintf(os.Stderr, "Invalid option to 'test161 list'.  Must be one of (targets, tags, tests, deps)\n")
 		return 1
 	}
 }
@@ -141,9 +149,7 @@ func printTargets(list *test161.TargetList) {
 		pd.Rows = append(pd.Rows, row)
 	}
 
-	fmt.Println()
-	pd.Print()
-	fmt.Println()
+	printTable(pd)
 }
 
 func getListArgs() error {
@@ -176,8 +182,13 @@ func getTagArgs() error {
 }
 
 func getAllTests() ([]*test161.Test, []error) {
+	return getTests([]string{"**/*.t"})
+}
+
+// Get the tests matching any of the test expressions, sorted by ID.
+func getTests(exprs []string) ([]*test161.Test, []error) {
 	conf := &test161.GroupConfig{
-		Tests: []string{"**/*.t"},
+		Tests: exprs,
 		Env:   env,
 	}
 
@@ -258,10 +269,9 @@ func doListTags() int {
 	sort.Strings(sorted)
 
 	// Printing
-	fmt.Println()
-
-	if listTagsShort {
-		// For the short version, we'll print a table to align the descriptions
+	if listTagsShort || !printingText() {
+		// For the short version, we'll print a table to align the descriptions.
+		// The other formats get a table too, with each tag's tests.
 		pd := &PrintData{
 			Headings: []*Heading{
 				&Heading{
@@ -274,6 +284,9 @@ func doListTags() int {
 			Config: defaultPrintConf,
 			Rows:   make(Rows, 0),
 		}
+		if !listTagsShort {
+			pd.Headings = append(pd.Headings, &Heading{Text: "Tests"})
+		}
 
 		for _, tag := range sorted {
 			if len(desired) > 0 && !desired[tag] {
@@ -285,19 +298,30 @@ func doListTags() int {
 				desc = info.Description
 			}
 
-			pd.Rows = append(pd.Rows, []*Cell{
+			row := []*Cell{
 				&Cell{Text: tag},
 				&Cell{Text: desc},
-			})
+			}
+			if !listTagsShort {
+				ids := make([]string, 0, len(tags[tag]))
+				for _, test := range tags[tag] {
+					ids = append(ids, test.DependencyID)
+				}
+				row = append(row, &Cell{Text: strings.Join(ids, " ")})
+			}
+			pd.Rows = append(pd.Rows, row)
 		}
 
-		if len(pd.Rows) > 0 {
-			pd.Print()
+		if len(pd.Rows) > 0 || !printingText() {
+			printTable(pd)
+		} else {
+			fmt.Println()
+			fmt.Println()
 		}
-		fmt.Println()
 
 	} else {
 		bold := color.New(color.Bold)
+		fmt.Println()
 
 		for _, tag := range sorted {
 			if len(desired) > 0 && !desired[tag] {
@@ -321,7 +345,77 @@ func doListTags() int {
 	return 0
 }
 
+func getListTestsArgs() error {
+	flags := flag.NewFlagSet("test161 list-tests", flag.ExitOnError)
+	flags.Usage = usage
+	flags.BoolVar(&listTestsVerbose, "verbose", false, "")
+	flags.BoolVar(&listTestsVerbose, "v", false, "")
+
+	flags.Parse(os.Args[3:]) // this may exit
+
+	// Optional test expressions to filter by, e.g. 'sync && !cv'
+	listTestsExprs = flags.Args()
+
+	return nil
+}
+
+// The configuration chunks of a test, for printing the effective configuration
+type effectiveConf struct {
+	Sys161           test161.Sys161Conf         `yaml:"sys161"`
+	Stat             test161.StatConf           `yaml:"stat"`
+	Monitor          test161.MonitorConf        `yaml:"monitor"`
+	Misc             test161.MiscConf           `yaml:"misc"`
+	CommandConf      []test161.CommandConf      `yaml:"commandconf,omitempty"`
+	CommandOverrides []*test161.CommandTemplate `yaml:"commandoverrides,omitempty"`
+}
+
+// Print each test's configuration after inheritance and defaults are applied.
+func printTestsVerbose(tests []*test161.Test) error {
+	bold := color.New(color.Bold)
+
+	for _, test := range tests {
+		if err := test.MergeConf(test161.CONF_DEFAULTS); err != nil {
+			return err
+		}
+
+		fmt.Println()
+		bold.Println(test.DependencyID)
+		fmt.Println(strings.Repeat("-", 60))
+		fmt.Println("Name        :", test.Name)
+		fmt.Println("Description :", strings.TrimSpace(test.Description))
+		if inherited := test.InheritedFrom(); len(inherited) > 0 {
+			fmt.Println("Extends     :", strings.Join(inherited, " -> "))
+		}
+
+		conf := &effectiveConf{
+			Sys161:           test.Sys161,
+			Stat:             test.Stat,
+			Monitor:          test.Monitor,
+			Misc:             test.Misc,
+			CommandConf:      test.CommandConf,
+			CommandOverrides: test.CommandOverrides,
+		}
+		text, err := yaml.Marshal(conf)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("\nEffective Configuration:")
+		for _, line := range strings.Split(strings.TrimRight(string(text), "\n"), "\n") {
+			fmt.Println("    " + line)
+		}
+	}
+	fmt.Println()
+
+	return nil
+}
+
 func doListTests() int {
+	if err := getListTestsArgs(); err != nil {
+		printRunError(err)
+		return 1
+	}
+
 	pd := &PrintData{
 		Headings: []*Heading{
 			&Heading{
@@ -338,13 +432,27 @@ func doListTests() int {
 		Config: defaultPrintConf,
 	}
 
-	// Load every test file
-	tests, errs := getAllTests()
+	// Load every test file, or just the ones matching the expressions
+	var tests []*test161.Test
+	var errs []error
+	if len(listTestsExprs) > 0 {
+		tests, errs = getTests(listTestsExprs)
+	} else {
+		tests, errs = getAllTests()
+	}
 	if len(errs) > 0 {
 		printRunErrors(errs)
 		return 1
 	}
 
+	if listTestsVerbose {
+		if err := printTestsVerbose(tests); err != nil {
+			printRunError(err)
+			return 1
+		}
+		return 0
+	}
+
 	// Print ID, line, description for each tests
 	for _, test := range tests {
 		row := Row{
@@ -355,9 +463,7 @@ func doListTests() int {
 		pd.Rows = append(pd.Rows, row)
 	}
 
-	fmt.Println()
-	pd.Print()
-	fmt.Println()
+	printTable(pd)
 
 	return 0
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
@@ -65,17 +66,36 @@ func envInit(cmd *test161Command) {
 
 func usage() {
 	fmt.Fprintf(os.Stdout, `usage:
-    test161  <command> <flags> <args>
+    test161  [-format (text*|csv|markdown|json)] <command> <flags> <args>
 
     test161 run [-dry-run | -d] [-explain | -x] [sequential | -s]
+                [-explain-format (text*|json|yaml)]
                 [-no-dependencies | -n] [-verbose | -v (whisper|quiet|loud*)]
-                [-tag] <names>
+                [-tag] [-cache] [-watch] [-shard i/n] [-json <file>]
+                [-report (html|junit|tap)=<file>,...] [-html <file>]
+                [-events ndjson[=<file>]] [-ui] [-timing] <names>
+
+    test161 merge-results [-verbose | -v (whisper|quiet*)] [-json <file>]
+                          <files>
+
+    test161 show [-verbose | -v (whisper|quiet|loud*)] [-explain | -x]
+                 [-explain-format (text*|json|yaml)] [-json <file>] [-timing]
+                 (<file> | (-submission | -s) <id>)
+
+    test161 history [-n <count>]
+    test161 compare [-verbose | -v (quiet*|loud)] [<run> [<run>]]
 
     test161 submit [-debug] [-verify] [-no-cache] <target> <commit>
 
     test161 list tags [-s | -short] [tags]
     test161 list targets [-remote | -r]
-    test161 list tests
+    test161 list tests [-verbose | -v] [expressions]
+    test161 list deps [-format | -f (dot*|mermaid|json)] [-points] [-tags]
+                      [-results] [tests|target]
+    test161 list deps (-reverse | -r) [-format | -f (text*|json|dot|mermaid)]
+                      <tests>
+
+    test161 lint [-format | -f (text*|json)] [dir]
 
     test161 config [-debug] [(add-user|del-user|change-token)] <username> <token>
     test161 config test161dir <dir>
@@ -91,6 +111,16 @@ func doHelp() int {
 	fmt.Fprintf(os.Stdout, `
 Commands Description:
 
+Table Formats: The global -format flag, given before the command, prints
+tables as CSV, Markdown or JSON instead of text, so they can be read by scripts
+or pasted into forum posts. It applies to 'test161 list targets', 'list tests'
+and 'list tags', the summaries of 'test161 run', 'merge-results' and 'show',
+and to 'test161 run -dry-run', '-explain' and 'test161 history'. Only the
+tables are printed; test output, totals and other text are left out. JSON
+tables are lists of objects, keyed by the column headings, and a summary with
+target scores is an object with a list of tests and a list of scores.
+
+
 'test161 run' runs a single target, or a group of tests. By default, all
 dependencies for the test group will also be run. For single tests and tags,
 specifying -no-dependencies will only run the test and tags given on the command
@@ -102,12 +132,92 @@ targets, adding the -tag flag forces test161 to interpet a single positional
 argument as a tag. This flag can be safely omitted as long there as there are no
 conflicts between tag and target name.
 
+Test Expressions: Tags and globs can be combined with !, &&, || and - (set
+difference, surrounded by whitespace), and grouped with parentheses. For
+example, 'sync && !slow' or 'sync/* - sync/cvt4.t'. Quote each expression so
+the shell passes it as a single argument.
+
 Output: Unless specified by -sequential, all output is interleaved with a
 summary at the end.  You can disable test output lines with -v quiet, and hide
-everything except pass/fail with -v whisper. Specifying -dry-run will show you
-the tests that would be run, without running them. Similarly, -explain will show
-you more detailed information about the tests and what they expect, without
-running them. This option is very useful when writing your own tests.
+everything except pass/fail with -v whisper. With -v loud, the summary also
+shows the expected output that's missing from each incorrect command. Specifying
+-dry-run will show you the tests that would be run, without running them.
+Similarly, -explain will show you more detailed information about the tests and
+what they expect, without running them. This option is very useful when writing
+your own tests.
+
+Explain Formats: -explain-format json or -explain-format yaml explains the
+tests (implying -explain) as data instead of text: each test's effective
+configuration and sys161.conf, dependencies, points and scoring, and each
+command with its expected output after template expansion.
+
+Reports: -report writes the results in formats that other tools understand,
+such as CI systems. It takes a comma-separated list of format=file pairs, where
+the format is html, junit (JUnit XML) or tap (TAP version 14), and a file of -
+writes to standard output. For example, -report junit=out.xml,tap=-. -html
+<file> is short for -report html=<file>, which saves a self-contained web page
+with the results and each command's output that can be attached to a help
+request.
+
+Dashboard: -ui replaces the interleaved output with a full-screen dashboard
+that has a row for each test, showing whether it's waiting for its
+dependencies, queued, running (and which command), or finished, along with its
+simulated time and points. The top line shows how many tests are running and
+queued. Use the arrow keys (or j and k) to select a test, and enter to see its
+output. The dashboard stays open when the run finishes; press q to close it
+and print the usual summary. If standard input or output isn't a terminal, -ui
+is ignored.
+
+Events: -events ndjson replaces the test output with a stream of JSON objects,
+one per line, for editors and other tools that follow along with a run. There
+are events for each test being queued, started and finished, each command
+starting, printing a line and finishing, test statuses, and a summary of the
+run. The stream goes to standard output, instead of the summary table, unless a
+file is given with -events ndjson=<file>.
+
+Timing: -timing adds where the wall clock time went to the summary: the total
+wall clock and simulated time, their ratio (a high ratio means a slow host),
+the time spent typing commands versus running them, and the time tests waited
+in the queue, followed by the slowest tests and commands. The same figures are
+saved for each test in the JSON output.
+
+Sharding: Large runs can be split across machines with -shard i/n, which runs
+the i'th of n parts of the tests along with their dependencies. Adding -json
+<file> saves the results, and 'test161 merge-results' combines the results of
+every shard into one summary.
+
+
+'test161 merge-results' combines the JSON results of each shard of a sharded
+'test161 run' and prints the summary, including target scores, for the whole
+run. Adding -json <file> saves the combined results.
+
+
+'test161 show' prints saved results the same way 'test161 run' would, without
+running anything. The results can be a file saved with 'test161 run -json' (or
+'merge-results -json'), or, with -submission <id>, a submission's results from
+the server. Staff can see any submission, and students can see their own. By
+default, each test's output is printed, followed by the summary and what's
+missing from each incorrect command; -v quiet and -v whisper print less, like
+they do for 'test161 run'. Adding -explain shows each test's configuration and
+expected output instead (-explain-format works as it does for 'test161 run'),
+and -json <file> saves the results, which is handy for keeping a copy of a
+submission's. Adding -timing shows the timing of the tests, like it does for
+'test161 run'.
+
+
+'test161 history' lists your most recent runs, newest first, with the Git commit
+of your source tree (marked with + if it had changes) and the scores. Every
+'test161 run' is saved in your history, in ~/.test161/history. Adding -n
+<count> lists more runs, or every run with -n 0.
+
+
+'test161 compare' shows how the scores changed between two runs from your
+history, and which tests regressed or started passing. Runs are given by their
+ID from 'test161 history', or as 'last' (your most recent run) or 'last~N' (N
+runs before it). Without arguments, it compares your last two runs; with one,
+it compares that run with your last run. Adding -v loud also lists the tests
+that were only run in one of the runs. The exit status is 1 if any tests
+regressed.
 
 
 'test161 submit' creates a submission for <target> on the test161.ops-class.org
@@ -135,7 +245,25 @@ shows the local targets available to test161; adding -r will show the remote
 targets instead. 'test161 list tags' shows a listing of tags, their
 descriptions, and tests for each tag. Adding -shprt will print the tests for a
 concise table of tag names and descriptions. 'test161 list tests' lists all
-tests available to test161 along with their descriptions.
+tests available to test161 along with their descriptions; adding -v shows each
+test's effective configuration after inheritance (extends) and defaults. Test
+expressions can be given to only list the matching tests. 'test161 list deps'
+prints the dependency graph of a target, some tests, or all tests as Graphviz
+DOT, Mermaid, or JSON. Nodes can be annotated with -points (target points),
+-tags, and -results, which colors the results of the last 'test161 run' and
+highlights the tests that are blocked by a failed dependency. Adding -reverse
+shows which tests, and how many points of each target, are blocked if the given
+tests fail.
+
+
+'test161 lint' checks the test161 directory for problems without running
+anything: malformed or unknown front matter keys, commands with no template,
+templates that fail to expand, unresolvable dependencies and cycles, target
+tests, command indexes and points that don't add up, duplicate tags and
+commands, and unused command templates. Each problem is printed with its file
+and line. By default the configured test161 directory is checked; a different
+directory can be given as an argument. Use -format json for machine-readable
+output. The exit status is 1 if any errors (not warnings) are found.
 
 
 'test161 config' is used to view and change test161 configuration. When run with
@@ -195,6 +323,26 @@ var cmdTable = map[string]*test161Command{
 	"help": &test161Command{
 		cmd: doHelp,
 	},
+	"lint": &test161Command{
+		cmd: doLint,
+	},
+	"merge-results": &test161Command{
+		cmd:      doMergeResults,
+		reqEnv:   true,
+		reqTests: true,
+	},
+	"show": &test161Command{
+		cmd:    doShow,
+		reqEnv: true,
+	},
+	"history": &test161Command{
+		cmd:    doHistory,
+		reqEnv: true,
+	},
+	"compare": &test161Command{
+		cmd:    doCompare,
+		reqEnv: true,
+	},
 	"upload-usage": &test161Command{
 		cmd:    doUploadUsage,
 		reqEnv: true,
@@ -206,10 +354,32 @@ func doVersion() int {
 	return 0
 }
 
+// Parse the flags that come before the command, and remove them from os.Args
+// so that each command finds its own flags where it expects them.
+func getGlobalArgs() error {
+	flags := flag.NewFlagSet("test161", flag.ExitOnError)
+	flags.Usage = usage
+	format := flags.String("format", FORMAT_TEXT, "")
+
+	flags.Parse(os.Args[1:]) // this may exit
+
+	if !isValidFormat(*format) {
+		return fmt.Errorf("format must be one of '%v', '%v', '%v', or '%v'",
+			FORMAT_TEXT, FORMAT_CSV, FORMAT_MARKDOWN, FORMAT_JSON)
+	}
+	defaultPrintConf.Format = *format
+
+	os.Args = append(os.Args[:1], flags.Args()...)
+	return nil
+}
+
 func main() {
 	exitcode := 2
 
-	if len(os.Args) == 1 {
+	if err := getGlobalArgs(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		usage()
+	} else if len(os.Args) == 1 {
 		usage()
 	} else {
 		// Get the sub-command
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+
+	"github.com/jay1999ke/test161"
+)
+
+// 'test161 merge-results' flags
+var mergeCommandVars struct {
+	verbose  string
+	jsonFile string
+	files    []string
+}
+
+// Write a group's results, as written by 'test161 run -json'.
+func writeResultsJSON(tg *test161.TestGroup, file string) error {
+	text, err := tg.OutputJSON()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, []byte(text+"\n"), 0664)
+}
+
+func getMergeArgs() error {
+	flags := flag.NewFlagSet("test161 merge-results", flag.ExitOnError)
+	flags.Usage = usage
+	flags.StringVar(&mergeCommandVars.verbose, "verbose", VERBOSE_QUIET, "")
+	flags.StringVar(&mergeCommandVars.verbose, "v", VERBOSE_QUIET, "")
+	flags.StringVar(&mergeCommandVars.jsonFile, "json", "", "")
+
+	flags.Parse(os.Args[2:]) // this may exit
+
+	mergeCommandVars.files = flags.Args()
+	if len(mergeCommandVars.files) == 0 {
+		return errors.New("test161 merge-results needs the results of each shard")
+	}
+
+	switch mergeCommandVars.verbose {
+	case VERBOSE_QUIET:
+	case VERBOSE_WHISPER:
+	default:
+		return errors.New("verbose flag must be one of 'quiet' or 'whisper'")
+	}
+
+	return nil
+}
+
+// test161 merge-results [-verbose quiet|whisper] [-json <file>] <files>
+//
+// Combine the results of a sharded run ('test161 run -shard i/n -json <file>'
+// on each machine) and print the summary for the whole run. Returns 1 unless
+// every test passed.
+func doMergeResults() int {
+	if err := getMergeArgs(); err != nil {
+		printRunError(err)
+		return 1
+	}
+
+	shards := make([]*test161.TestGroup, 0, len(mergeCommandVars.files))
+	for _, file := range mergeCommandVars.files {
+		tg, err := test161.LoadResults(file)
+		if err != nil {
+			printRunError(err)
+			return 1
+		}
+		shards = append(shards, tg)
+	}
+
+	tg, err := test161.MergeShards(shards)
+	if err != nil {
+		printRunError(err)
+		return 1
+	}
+
+	printRunSummary(tg, mergeCommandVars.verbose, false, false)
+
+	if len(mergeCommandVars.jsonFile) > 0 {
+		if err = writeResultsJSON(tg, mergeCommandVars.jsonFile); err != nil {
+			printRunError(err)
+			return 1
+		}
+	}
+
+	for _, test := range tg.Tests {
+		if test.Result != test161.TEST_RESULT_CORRECT {
+			return 1
+		}
+	}
+	return 0
+}
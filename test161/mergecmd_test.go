@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path"
+	"testing"
+
+	"github.com/jay1999ke/test161"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultsJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	files := []string{path.Join(dir, "shard1.json"), path.Join(dir, "shard2.json")}
+
+	for i, file := range files {
+		test, err := test161.TestFromString("q")
+		assert.Nil(err)
+		test.DependencyID = file
+		test.Result = test161.TEST_RESULT_CORRECT
+		test.PointsAvailable = 5
+		test.PointsEarned = 5
+
+		tg := test161.EmptyGroup()
+		tg.Config = &test161.GroupConfig{Name: "asst1", Shard: test161.Shard{Index: i + 1, Count: 2}}
+		tg.Tests[test.DependencyID] = test
+		assert.Nil(writeResultsJSON(tg, file))
+	}
+
+	shards := make([]*test161.TestGroup, 0)
+	for _, file := range files {
+		tg, err := test161.LoadResults(file)
+		assert.Nil(err)
+		shards = append(shards, tg)
+	}
+
+	merged, err := test161.MergeShards(shards)
+	assert.Nil(err)
+	assert.Equal("asst1", merged.Config.Name)
+	assert.Equal(2, len(merged.Tests))
+	assert.Equal(uint(10), merged.EarnedPoints())
+
+	_, err = test161.LoadResults(path.Join(dir, "missing.json"))
+	assert.NotNil(err)
+}
@@ -1,13 +1,26 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	color "gopkg.in/fatih/color.v0"
+	"io"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
+	"unicode"
+)
+
+// Table formats, set with the global -format flag. Text is for people; the
+// others are for pasting into forum posts or reading from scripts.
+const (
+	FORMAT_TEXT     = "text"
+	FORMAT_CSV      = "csv"
+	FORMAT_MARKDOWN = "markdown"
+	FORMAT_JSON     = "json"
 )
 
 type Heading struct {
@@ -34,12 +47,16 @@ type PrintConfig struct {
 	NumSpaceSep   int
 	UnderlineChar string
 	BoldHeadings  bool
+	Format        string
 }
 
 type PrintData struct {
 	Headings []*Heading
 	Rows     Rows
 	Config   PrintConfig
+
+	// The table's key when several tables are printed as one JSON object
+	Name string
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -48,6 +65,23 @@ var defaultPrintConf = PrintConfig{
 	NumSpaceSep:   3,
 	UnderlineChar: "-",
 	BoldHeadings:  true,
+	Format:        FORMAT_TEXT,
+}
+
+func isValidFormat(format string) bool {
+	switch format {
+	case FORMAT_TEXT, FORMAT_CSV, FORMAT_MARKDOWN, FORMAT_JSON:
+		return true
+	default:
+		return false
+	}
+}
+
+// Whether tables are being printed for people, along with the blank lines,
+// totals, and other text around them. Commands leave those out for the
+// other formats so that the output can be parsed.
+func printingText() bool {
+	return defaultPrintConf.Format == FORMAT_TEXT || defaultPrintConf.Format == ""
 }
 
 // Get the number of columns available on the terminal. We'll try to squeeze
@@ -239,7 +273,7 @@ func (pd *PrintData) splitRows() {
 	pd.Rows = newRows
 }
 
-func (pd *PrintData) Print() error {
+func (pd *PrintData) checkColumns() error {
 	// Do we have the right number of columns in the data? This is a
 	// programming error if we don't.
 	for _, row := range pd.Rows {
@@ -247,7 +281,62 @@ func (pd *PrintData) Print() error {
 			return errors.New("Wrong number of columns")
 		}
 	}
+	return nil
+}
+
+// Print the table to stdout in the configured format.
+func (pd *PrintData) Print() error {
+	if err := pd.checkColumns(); err != nil {
+		return err
+	}
+
+	switch pd.Config.Format {
+	case FORMAT_CSV:
+		return pd.printCSV(os.Stdout)
+	case FORMAT_MARKDOWN:
+		return pd.printMarkdown(os.Stdout)
+	case FORMAT_JSON:
+		return pd.printJSON(os.Stdout)
+	default:
+		return pd.printText()
+	}
+}
+
+// Print a table on its own, with a blank line before and after it for
+// people.
+func printTable(pd *PrintData) error {
+	if printingText() {
+		fmt.Println()
+		defer fmt.Println()
+	}
+	return pd.Print()
+}
+
+// Print several tables. JSON tables are combined into one object, keyed by
+// each table's name, and the others are separated by a blank line.
+func printTables(tables ...*PrintData) error {
+	for _, pd := range tables {
+		if err := pd.checkColumns(); err != nil {
+			return err
+		}
+	}
+
+	if len(tables) > 0 && tables[0].Config.Format == FORMAT_JSON {
+		return printJSONTables(os.Stdout, tables...)
+	}
 
+	for i, pd := range tables {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := pd.Print(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pd *PrintData) printText() error {
 	// Calculate min/max column widths and split up cells if needed
 	pd.calcWidths()
 	pd.splitRows()
@@ -299,3 +388,107 @@ func (pd *PrintData) Print() error {
 
 	return nil
 }
+
+func (pd *PrintData) printCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+
+	record := make([]string, 0, len(pd.Headings))
+	for _, h := range pd.Headings {
+		record = append(record, h.Text)
+	}
+	out.Write(record)
+
+	for _, row := range pd.Rows {
+		record = record[:0]
+		for _, cell := range row {
+			record = append(record, cell.Text)
+		}
+		out.Write(record)
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// Escape a cell so that it stays in its column and on its row.
+func markdownEscape(text string) string {
+	text = strings.Replace(text, "|", "\\|", -1)
+	return strings.Replace(text, "\n", " ", -1)
+}
+
+func (pd *PrintData) printMarkdown(w io.Writer) error {
+	headings := make([]string, 0, len(pd.Headings))
+	align := make([]string, 0, len(pd.Headings))
+	for _, h := range pd.Headings {
+		headings = append(headings, markdownEscape(h.Text))
+		if h.RightJustified {
+			align = append(align, "---:")
+		} else {
+			align = append(align, "---")
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "| %v |\n", strings.Join(headings, " | ")); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "| %v |\n", strings.Join(align, " | ")); err != nil {
+		return err
+	}
+
+	for _, row := range pd.Rows {
+		cells := make([]string, 0, len(row))
+		for _, cell := range row {
+			cells = append(cells, markdownEscape(cell.Text))
+		}
+		if _, err := fmt.Fprintf(w, "| %v |\n", strings.Join(cells, " | ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The JSON key for a heading, e.g. "Test ID" -> "test_id" and "Wall/Sim" ->
+// "wall_sim"
+func jsonKey(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "_")
+}
+
+// Each row as an object, keyed by its headings
+func (pd *PrintData) jsonRows() []map[string]string {
+	rows := make([]map[string]string, 0, len(pd.Rows))
+	for _, row := range pd.Rows {
+		obj := make(map[string]string)
+		for col, cell := range row {
+			obj[jsonKey(pd.Headings[col].Text)] = cell.Text
+		}
+		rows = append(rows, obj)
+	}
+	return rows
+}
+
+func writeJSON(w io.Writer, data interface{}) error {
+	text, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(text))
+	return err
+}
+
+// Print the table as a list of row objects.
+func (pd *PrintData) printJSON(w io.Writer) error {
+	return writeJSON(w, pd.jsonRows())
+}
+
+// Print the tables as an object with a list for each table.
+func printJSONTables(w io.Writer, tables ...*PrintData) error {
+	all := make(map[string]interface{})
+	for _, pd := range tables {
+		all[jsonKey(pd.Name)] = pd.jsonRows()
+	}
+	return writeJSON(w, all)
+}
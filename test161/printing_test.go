@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func printingTestData() *PrintData {
+	return &PrintData{
+		Headings: []*Heading{
+			&Heading{
+				Text: "Test ID",
+			},
+			&Heading{
+				Text:           "Score",
+				RightJustified: true,
+			},
+		},
+		Rows: Rows{
+			Row{&Cell{Text: "boot.t"}, &Cell{Text: "0/0"}},
+			Row{&Cell{Text: "sync/sem1.t"}, &Cell{Text: "a, \"b\" | c"}},
+		},
+		Config: defaultPrintConf,
+		Name:   "Tests",
+	}
+}
+
+func TestPrintCSV(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.Nil(printingTestData().printCSV(&buf))
+	assert.Equal("Test ID,Score\nboot.t,0/0\nsync/sem1.t,\"a, \"\"b\"\" | c\"\n", buf.String())
+}
+
+func TestPrintMarkdown(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.Nil(printingTestData().printMarkdown(&buf))
+	expected := "| Test ID | Score |\n" +
+		"| --- | ---: |\n" +
+		"| boot.t | 0/0 |\n" +
+		"| sync/sem1.t | a, \"b\" \\| c |\n"
+	assert.Equal(expected, buf.String())
+}
+
+func TestPrintJSON(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.Nil(printingTestData().printJSON(&buf))
+
+	rows := []map[string]string{}
+	assert.Nil(json.Unmarshal(buf.Bytes(), &rows))
+	assert.Equal([]map[string]string{
+		{"test_id": "boot.t", "score": "0/0"},
+		{"test_id": "sync/sem1.t", "score": "a, \"b\" | c"},
+	}, rows)
+
+	// Several tables are one object
+	scores := &PrintData{
+		Headings: []*Heading{&Heading{Text: "Target"}},
+		Rows:     Rows{},
+		Name:     "Scores",
+	}
+	buf.Reset()
+	assert.Nil(printJSONTables(&buf, printingTestData(), scores))
+
+	tables := map[string][]map[string]string{}
+	assert.Nil(json.Unmarshal(buf.Bytes(), &tables))
+	assert.Equal(2, len(tables["tests"]))
+	assert.NotNil(tables["scores"])
+	assert.Equal(0, len(tables["scores"]))
+}
+
+func TestJSONKey(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	assert.Equal("test_id", jsonKey("Test ID"))
+	assert.Equal("wall_sim", jsonKey("Wall/Sim"))
+	assert.Equal("points_available", jsonKey(" Points  Available "))
+}
+
+func TestPrintColumns(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	pd := printingTestData()
+	pd.Rows = append(pd.Rows, Row{&Cell{Text: "too short"}})
+	assert.NotNil(pd.Print())
+	assert.NotNil(printTables(pd))
+}
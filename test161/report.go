@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jay1999ke/test161"
+)
+
+// A report requested with 'test161 run -report format=file'
+type reportSpec struct {
+	format   string
+	reporter test161.Reporter
+	file     string // "-" for stdout
+}
+
+// Parse a comma-separated list of format=file reports.
+func parseReportSpecs(arg string) ([]*reportSpec, error) {
+	specs := make([]*reportSpec, 0)
+	for _, entry := range strings.Split(arg, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, fmt.Errorf("Invalid report '%v', expected format=file", entry)
+		}
+		reporter, err := test161.GetReporter(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, &reportSpec{parts[0], reporter, parts[1]})
+	}
+	return specs, nil
+}
+
+func (spec *reportSpec) write(tg *test161.TestGroup) error {
+	var w io.Writer = os.Stdout
+	if spec.file != "-" {
+		file, err := os.Create(spec.file)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := spec.reporter.Report(w, tg); err != nil {
+		return fmt.Errorf("Unable to write %v report: %v", spec.format, err)
+	}
+	return nil
+}
+
+func writeReports(tg *test161.TestGroup, specs []*reportSpec) {
+	for _, spec := range specs {
+		if err := spec.write(tg); err != nil {
+			printRunError(err)
+		}
+	}
+}
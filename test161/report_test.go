@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReportSpecs(t *testing.T) {
+	assert := assert.New(t)
+
+	specs, err := parseReportSpecs("junit=out.xml, tap=-")
+	assert.Nil(err)
+	if assert.Equal(2, len(specs)) {
+		assert.Equal("junit", specs[0].format)
+		assert.Equal("out.xml", specs[0].file)
+		assert.Equal("tap", specs[1].format)
+		assert.Equal("-", specs[1].file)
+	}
+
+	for _, arg := range []string{"junit", "junit=", "=out.xml", "xml=out.xml"} {
+		_, err = parseReportSpecs(arg)
+		assert.NotNil(err, arg)
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"strings"
@@ -15,13 +17,26 @@ import (
 
 // 'test161 run' flags
 var runCommandVars struct {
-	dryRun     bool
-	explain    bool
-	sequential bool
-	nodeps     bool
-	verbose    string
-	isTag      bool
-	tests      []string
+	dryRun        bool
+	explain       bool
+	explainFormat string
+	sequential    bool
+	nodeps        bool
+	verbose       string
+	isTag         bool
+	cache         bool
+	watch         bool
+	shardSpec     string
+	shard         test161.Shard
+	jsonFile      string
+	report        string
+	html          string
+	reports       []*reportSpec
+	eventsArg     string
+	events        *eventsSpec
+	ui            bool
+	timing        bool
+	tests         []string
 }
 
 type scoreMapEntry struct {
@@ -75,6 +90,7 @@ func getRunArgs() error {
 	runFlags.BoolVar(&runCommandVars.dryRun, "d", false, "")
 	runFlags.BoolVar(&runCommandVars.explain, "explain", false, "")
 	runFlags.BoolVar(&runCommandVars.explain, "x", false, "")
+	runFlags.StringVar(&runCommandVars.explainFormat, "explain-format", "", "")
 	runFlags.BoolVar(&runCommandVars.sequential, "sequential", false, "")
 	runFlags.BoolVar(&runCommandVars.sequential, "s", false, "")
 	runFlags.BoolVar(&runCommandVars.nodeps, "no-dependencies", false, "")
@@ -82,6 +98,15 @@ func getRunArgs() error {
 	runFlags.StringVar(&runCommandVars.verbose, "verbose", "loud", "")
 	runFlags.StringVar(&runCommandVars.verbose, "v", "loud", "")
 	runFlags.BoolVar(&runCommandVars.isTag, "tag", false, "")
+	runFlags.BoolVar(&runCommandVars.cache, "cache", false, "")
+	runFlags.BoolVar(&runCommandVars.watch, "watch", false, "")
+	runFlags.StringVar(&runCommandVars.shardSpec, "shard", "", "")
+	runFlags.StringVar(&runCommandVars.jsonFile, "json", "", "")
+	runFlags.StringVar(&runCommandVars.report, "report", "", "")
+	runFlags.StringVar(&runCommandVars.html, "html", "", "")
+	runFlags.StringVar(&runCommandVars.eventsArg, "events", "", "")
+	runFlags.BoolVar(&runCommandVars.ui, "ui", false, "")
+	runFlags.BoolVar(&runCommandVars.timing, "timing", false, "")
 
 	runFlags.Parse(os.Args[2:]) // this may exit
 
@@ -91,6 +116,75 @@ func getRunArgs() error {
 		return errors.New("At least one test or target must be specified")
 	}
 
+	// -explain-format implies -explain
+	if len(runCommandVars.explainFormat) > 0 {
+		if !isValidExplainFormat(runCommandVars.explainFormat) {
+			return errors.New("explain-format must be one of 'text', 'json', or 'yaml'")
+		}
+		runCommandVars.explain = true
+	}
+
+	if runCommandVars.watch && (runCommandVars.dryRun || runCommandVars.explain) {
+		return errors.New("-watch can't be combined with -dry-run or -explain")
+	}
+
+	if len(runCommandVars.shardSpec) > 0 {
+		if runCommandVars.watch {
+			return errors.New("-shard can't be combined with -watch")
+		}
+		shard, err := test161.ParseShard(runCommandVars.shardSpec)
+		if err != nil {
+			return err
+		}
+		runCommandVars.shard = shard
+	}
+
+	// -html <file> is short for -report html=<file>
+	if len(runCommandVars.html) > 0 {
+		if len(runCommandVars.report) > 0 {
+			runCommandVars.report += ","
+		}
+		runCommandVars.report += "html=" + runCommandVars.html
+	}
+
+	if len(runCommandVars.report) > 0 {
+		if runCommandVars.watch {
+			return errors.New("-report and -html can't be combined with -watch")
+		}
+		reports, err := parseReportSpecs(runCommandVars.report)
+		if err != nil {
+			return err
+		}
+		runCommandVars.reports = reports
+	}
+
+	if len(runCommandVars.eventsArg) > 0 {
+		if runCommandVars.watch || runCommandVars.dryRun || runCommandVars.explain {
+			return errors.New("-events can't be combined with -watch, -dry-run or -explain")
+		}
+		events, err := parseEventsSpec(runCommandVars.eventsArg)
+		if err != nil {
+			return err
+		}
+		if events.toStdout() {
+			for _, spec := range runCommandVars.reports {
+				if spec.file == "-" {
+					return errors.New("-events and -report can't both write to stdout")
+				}
+			}
+		}
+		runCommandVars.events = events
+	}
+
+	if runCommandVars.ui {
+		if runCommandVars.watch || runCommandVars.dryRun || runCommandVars.explain {
+			return errors.New("-ui can't be combined with -watch, -dry-run or -explain")
+		}
+		if runCommandVars.events != nil {
+			return errors.New("-ui can't be combined with -events")
+		}
+	}
+
 	switch runCommandVars.verbose {
 	case VERBOSE_LOUD:
 	case VERBOSE_QUIET:
@@ -111,13 +205,35 @@ func runTestGroup(tg *test161.TestGroup, useDeps bool, desc string) int {
 	}
 
 	if runCommandVars.sequential {
-		test161.SetManagerCapacity(1)
+		test161.SetManagerCapacity(test161.Resources{Tests: 1})
 	} else {
-		test161.SetManagerCapacity(0)
+		test161.SetManagerCapacity(test161.Resources{})
 	}
 
-	// Set up a PersistenceManager that just outputs to the console
-	if runCommandVars.verbose == VERBOSE_LOUD {
+	// Set up a PersistenceManager that just outputs to the console, or
+	// streams events for other tools, or shows the dashboard if we're on a
+	// terminal
+	var events *test161.EventPersistence
+	var ui *dashboard
+	if runCommandVars.ui && isTerminal(os.Stdin) && isTerminal(os.Stdout) {
+		title := desc
+		if len(title) == 0 {
+			title = tg.Config.Name
+		}
+		ui = newDashboard(tg, title, useDeps)
+		env.Persistence = ui
+	} else if runCommandVars.events != nil {
+		var closer io.Closer
+		var err error
+		if events, closer, err = runCommandVars.events.open(); err != nil {
+			printRunError(err)
+			return 1
+		}
+		if closer != nil {
+			defer closer.Close()
+		}
+		env.Persistence = events
+	} else if runCommandVars.verbose == VERBOSE_LOUD && printingText() {
 		// Compute the max witdth for pretty-printing lines
 		max := 0
 		for _, t := range tg.Tests {
@@ -128,6 +244,31 @@ func runTestGroup(tg *test161.TestGroup, useDeps bool, desc string) int {
 		env.Persistence = &ConsolePersistence{max}
 	}
 
+	// Historical wall times, so the dependency runner can start long
+	// chains of tests first. These are updated when the run finishes.
+	if wt, err := test161.LoadWallTimes(WALLTIMES_FILE); err != nil {
+		printRunError(err)
+	} else {
+		env.WallTimes = wt
+	}
+
+	// Reuse results of tests that passed before if nothing they depend on
+	// has changed.
+	if runCommandVars.cache {
+		env.ResultCache = test161.NewResultCache(RESULT_CACHE_DIR)
+	}
+
+	// The dashboard has the screen to itself while the tests run, so
+	// anything logged waits until it's closed.
+	var logged bytes.Buffer
+	if ui != nil {
+		if err := ui.start(); err != nil {
+			printRunError(fmt.Errorf("Unable to start the dashboard: %v", err))
+			return 1
+		}
+		env.Log.SetOutput(&logged)
+	}
+
 	// Run it
 	test161.StartManager()
 	startTime := time.Now()
@@ -137,19 +278,53 @@ func runTestGroup(tg *test161.TestGroup, useDeps bool, desc string) int {
 	// For reurn val
 	allCorrect := true
 
+	runErrs := make([]string, 0)
 	for res := range done {
 		if res.Test.Result != test161.TEST_RESULT_CORRECT {
 			allCorrect = false
 		}
 		if res.Err != nil {
-			fmt.Fprintf(os.Stderr, "Error running %v: %v\n", res.Test.DependencyID, res.Err)
+			runErrs = append(runErrs, fmt.Sprintf("Error running %v: %v", res.Test.DependencyID, res.Err))
+			if ui == nil {
+				fmt.Fprintln(os.Stderr, runErrs[len(runErrs)-1])
+			}
 		}
 	}
 
 	test161.StopManager()
 
-	printRunSummary(tg, runCommandVars.verbose, useDeps)
+	if ui != nil {
+		ui.finish()
+		env.Log.SetOutput(os.Stderr)
+		os.Stderr.Write(logged.Bytes())
+		for _, msg := range runErrs {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+	}
+
+	if events != nil {
+		if err := events.RunSummary(tg); err != nil {
+			printRunError(err)
+		}
+	}
+
+	// The event stream replaces the human output on stdout
+	if events == nil || !runCommandVars.events.toStdout() {
+		printRunSummary(tg, runCommandVars.verbose, useDeps, runCommandVars.timing)
+	}
 	logUsageStat(tg, desc, startTime, endTime)
+	if err := saveLastRun(tg, desc, endTime); err != nil {
+		printRunError(err)
+	}
+	if err := saveHistory(newHistoryRun(tg, desc, endTime)); err != nil {
+		printRunError(err)
+	}
+	if len(runCommandVars.jsonFile) > 0 {
+		if err := writeResultsJSON(tg, runCommandVars.jsonFile); err != nil {
+			printRunError(err)
+		}
+	}
+	writeReports(tg, runCommandVars.reports)
 
 	if allCorrect {
 		return 0
@@ -158,7 +333,9 @@ func runTestGroup(tg *test161.TestGroup, useDeps bool, desc string) int {
 	}
 }
 
-func printRunSummary(tg *test161.TestGroup, verbosity string, tryDependOrder bool) {
+// Print the results of each test, the totals, and target scores. With timing,
+// the summary also shows where the wall clock time went.
+func printRunSummary(tg *test161.TestGroup, verbosity string, tryDependOrder bool, timing bool) {
 	pd := &PrintData{
 		Headings: []*Heading{
 			&Heading{
@@ -208,8 +385,11 @@ func printRunSummary(tg *test161.TestGroup, verbosity string, tryDependOrder boo
 		status := string(test.Result)
 
 		if test.Result == test161.TEST_RESULT_SKIP {
-			// Try to find a failed dependency
+			// Try to find a failed (hard) dependency
 			for _, dep := range test.ExpandedDeps {
+				if test.DependencyKind(dep.DependencyID) != test161.DEP_HARD {
+					continue
+				}
 				if dep.Result == test161.TEST_RESULT_INCORRECT ||
 					dep.Result == test161.TEST_RESULT_SKIP {
 
@@ -217,6 +397,12 @@ func printRunSummary(tg *test161.TestGroup, verbosity string, tryDependOrder boo
 					break
 				}
 			}
+		} else if len(test.FailedPrereqs) > 0 {
+			// Ran anyway, but a weak dependency didn't pass
+			status += " (failed prerequisite: " + strings.Join(test.FailedPrereqs, ", ") + ")"
+		}
+		if test.Cached {
+			status += " (cached)"
 		}
 
 		leak := "---"
@@ -253,6 +439,21 @@ func printRunSummary(tg *test161.TestGroup, verbosity string, tryDependOrder boo
 
 	scores := splitScores(tg)
 
+	// Other formats get the tests and target scores, without the text. JSON
+	// always has the scores, even if there aren't any.
+	if !printingText() {
+		pd.Name = "Tests"
+		tables := []*PrintData{pd}
+		if len(scores) > 0 || pd.Config.Format == FORMAT_JSON {
+			tables = append(tables, scoresTable(scores))
+		}
+		if timing {
+			tables = append(tables, timingTables(tg.TimingSummary(TIMING_SLOWEST))...)
+		}
+		printTables(tables...)
+		return
+	}
+
 	if verbosity != VERBOSE_WHISPER {
 		// Chop off the score if it's not a graded target
 		if len(scores) == 0 {
@@ -265,9 +466,17 @@ func printRunSummary(tg *test161.TestGroup, verbosity string, tryDependOrder boo
 		pd.Print()
 	}
 
+	if verbosity == VERBOSE_LOUD {
+		printFailureDiffs(tests)
+	}
+
 	// Print totals
 	fmt.Println()
 
+	if tg.Config != nil && tg.Config.Shard.Enabled() {
+		fmt.Printf("%-15v: %v\n", "Shard", tg.Config.Shard)
+	}
+
 	// Total correct/incorrect/etc.
 	for i := 0; i < len(desc); i++ {
 		if i == 0 || totals[i] > 0 {
@@ -292,6 +501,70 @@ func printRunSummary(tg *test161.TestGroup, verbosity string, tryDependOrder boo
 	}
 
 	fmt.Println()
+
+	if timing {
+		printTiming(tg.TimingSummary(TIMING_SLOWEST))
+	}
+}
+
+// The points earned for each target, for the formats other than text
+func scoresTable(scores []*scoreMapEntry) *PrintData {
+	pd := &PrintData{
+		Headings: []*Heading{
+			&Heading{
+				Text: "Target",
+			},
+			&Heading{
+				Text:           "Points Earned",
+				RightJustified: true,
+			},
+			&Heading{
+				Text:           "Points Available",
+				RightJustified: true,
+			},
+		},
+		Config: defaultPrintConf,
+		Rows:   make(Rows, 0),
+		Name:   "Scores",
+	}
+
+	for _, entry := range scores {
+		name := entry.TargetName
+		if entry.IsMeta {
+			name = "(" + name + ")"
+		}
+		pd.Rows = append(pd.Rows, []*Cell{
+			&Cell{Text: name},
+			&Cell{Text: fmt.Sprintf("%v", entry.Earned)},
+			&Cell{Text: fmt.Sprintf("%v", entry.Avail)},
+		})
+	}
+
+	return pd
+}
+
+// Explain why each incorrect command failed, showing its expected output
+// among its actual output.
+func printFailureDiffs(tests []*test161.Test) {
+	bold := color.New(color.Bold).SprintFunc()
+	for _, test := range tests {
+		for _, cmd := range test.Commands {
+			if len(cmd.Diff) == 0 {
+				continue
+			}
+			fmt.Println()
+			fmt.Println(bold(test.DependencyID))
+			for _, line := range strings.Split(strings.TrimRight(cmd.Diff, "\n"), "\n") {
+				switch {
+				case strings.HasPrefix(line, "- "), strings.HasPrefix(line, "! "):
+					line = COLOR_FAIL.SprintFunc()(line)
+				case strings.HasPrefix(line, "= "):
+					line = COLOR_SUCCESS.SprintFunc()(line)
+				}
+				fmt.Println("    " + line)
+			}
+		}
+	}
 }
 
 func runTests() (int, []error) {
@@ -304,6 +577,11 @@ func runTests() (int, []error) {
 	if len(runCommandVars.tests) == 1 && !runCommandVars.isTag {
 		if target, ok = env.Targets[runCommandVars.tests[0]]; ok {
 			tg, errs := target.Instance(env)
+			if len(errs) == 0 {
+				if err := tg.ApplyShard(runCommandVars.shard); err != nil {
+					errs = []error{err}
+				}
+			}
 			if len(errs) > 0 {
 				return 1, errs
 			} else {
@@ -311,6 +589,16 @@ func runTests() (int, []error) {
 					exitcode, errs = explain(tg)
 				} else if runCommandVars.dryRun {
 					printDryRun(tg)
+				} else if runCommandVars.watch {
+					w := &watcher{
+						build:    &test161.BuildConf{KConfig: target.KConfig},
+						userland: target.RequiresUserland,
+						useDeps:  true,
+						newGroup: func() (*test161.TestGroup, []error) {
+							return target.Instance(env)
+						},
+					}
+					exitcode = w.run()
 				} else {
 					runTestGroup(tg, true, runCommandVars.tests[0])
 				}
@@ -325,6 +613,7 @@ func runTests() (int, []error) {
 		UseDeps: !runCommandVars.nodeps,
 		Tests:   runCommandVars.tests,
 		Env:     env,
+		Shard:   runCommandVars.shard,
 	}
 
 	if tg, errs := test161.GroupFromConfig(config); len(errs) > 0 {
@@ -332,7 +621,9 @@ func runTests() (int, []error) {
 	} else {
 		desc := ""
 		for _, t := range runCommandVars.tests {
-			if !strings.HasSuffix(t, ".t") {
+			// Tags and test expressions, but not plain test files
+			isFile := strings.HasSuffix(t, ".t") || strings.HasSuffix(t, "]")
+			if !isFile || strings.ContainsAny(t, " \t") {
 				if len(desc) == 0 {
 					desc = t
 				} else {
@@ -345,6 +636,20 @@ func runTests() (int, []error) {
 			exitcode, errs = explain(tg)
 		} else if runCommandVars.dryRun {
 			printDryRun(tg)
+		} else if runCommandVars.watch {
+			kconfig, err := installedKConfig(clientConf.RootDir)
+			if err != nil {
+				return 1, []error{err}
+			}
+			w := &watcher{
+				build:    &test161.BuildConf{KConfig: kconfig},
+				userland: true,
+				useDeps:  config.UseDeps,
+				newGroup: func() (*test161.TestGroup, []error) {
+					return test161.GroupFromConfig(config)
+				},
+			}
+			exitcode = w.run()
 		} else {
 			exitcode = runTestGroup(tg, config.UseDeps, desc)
 		}
@@ -394,111 +699,157 @@ func printDryRun(tg *test161.TestGroup) {
 		})
 	}
 
-	fmt.Println()
-	pd.Print()
-	fmt.Println()
+	printTable(pd)
 }
 
 func explain(tg *test161.TestGroup) (int, []error) {
+	return explainTests(getPrintOrder(tg, true), runCommandVars.explainFormat)
+}
 
-	tests := getPrintOrder(tg, true)
-
-	fmt.Println()
-
-	for _, test := range tests {
-		if test.IsDependency {
-			fmt.Printf("%-30v (dependency)\n", test.DependencyID)
-		}
+// Print the configuration and expected output of each test that isn't just a
+// dependency, in one of the explain formats. Without one, the other table
+// formats get tables and everything else gets text.
+func explainTests(tests []*test161.Test, format string) (int, []error) {
+	// Saved results already have their defaults merged
+	e, err := test161.ExplainTests(tests, env)
+	if err != nil {
+		return 1, []error{err}
 	}
 
-	for _, test := range tests {
-		if test.IsDependency {
-			continue
+	if len(format) == 0 {
+		if !printingText() {
+			return explainTables(e)
 		}
+		format = test161.EXPLAIN_FORMAT_TEXT
+	}
 
-		fmt.Println()
+	if err = e.Write(os.Stdout, format); err != nil {
+		return 1, []error{err}
+	}
+	return 0, nil
+}
 
-		// Merge in test161 defaults for any missing configuration values
-		test.SetEnv(env)
-		if err := test.MergeAllDefaults(); err != nil {
-			return 1, []error{err}
-		}
-
-		// Test ID
-		fmt.Println(test.DependencyID)
-		fmt.Println(strings.Repeat("-", 60))
-		fmt.Println("Name        :", test.Name)
-		fmt.Println("Description :", strings.TrimSpace(test.Description))
-
-		// Monitor
-		if test.Monitor.Enabled == "true" {
-			fmt.Println("\ntest161 Monitor Conf:")
-			fmt.Println("  Progress Timeout :", test.Monitor.ProgressTimeout)
-			fmt.Println("  Command Timeout  :", test.Monitor.CommandTimeout)
-			fmt.Println("  Window           :", test.Monitor.Window)
-			if test.Monitor.Kernel.EnableMin == "true" {
-				fmt.Println("  Kernel Min       :", test.Monitor.Kernel.Min)
-			} else {
-				fmt.Println("  Kernel Min       : disabled")
-			}
-			fmt.Println("  Kernel Max       :", test.Monitor.Kernel.Max)
+func isValidExplainFormat(format string) bool {
+	switch format {
+	case test161.EXPLAIN_FORMAT_TEXT, test161.EXPLAIN_FORMAT_JSON, test161.EXPLAIN_FORMAT_YAML:
+		return true
+	default:
+		return false
+	}
+}
 
-			if test.Monitor.User.EnableMin == "true" {
-				fmt.Println("  User Min         :", test.Monitor.User.Min)
-			} else {
-				fmt.Println("  User Min         : disabled")
-			}
-			fmt.Println("  User Max         :", test.Monitor.User.Max)
-		}
+// Explain the tests as a table of tests and a table of their commands, for
+// the formats other than text.
+func explainTables(e *test161.Explanation) (int, []error) {
+	testsPD := &PrintData{
+		Headings: []*Heading{
+			&Heading{
+				Text: "Test ID",
+			},
+			&Heading{
+				Text: "Name",
+			},
+			&Heading{
+				Text: "Description",
+			},
+			&Heading{
+				Text:           "Points",
+				RightJustified: true,
+			},
+			&Heading{
+				Text: "Scoring",
+			},
+			&Heading{
+				Text: "Dependencies",
+			},
+		},
+		Rows:   make(Rows, 0),
+		Config: defaultPrintConf,
+		Name:   "Tests",
+	}
 
-		// Sys161
-		fmt.Println("\nsys161 Conf:")
-		conf, _ := test.PrintConf()
-		fmt.Println(strings.TrimSpace(conf))
-		fmt.Println()
+	cmdsPD := &PrintData{
+		Headings: []*Heading{
+			&Heading{
+				Text: "Test ID",
+			},
+			&Heading{
+				Text: "Command",
+			},
+			&Heading{
+				Text: "Panics",
+			},
+			&Heading{
+				Text: "Times Out",
+			},
+			&Heading{
+				Text:           "Timeout",
+				RightJustified: true,
+			},
+			&Heading{
+				Text:           "Points",
+				RightJustified: true,
+			},
+			&Heading{
+				Text: "Expected Output",
+			},
+		},
+		Rows:   make(Rows, 0),
+		Config: defaultPrintConf,
+		Name:   "Commands",
+	}
 
-		// Points/scoring
-		if test.PointsAvailable > 0 {
-			fmt.Println("Points      : ", test.PointsAvailable)
-			fmt.Println("Scoring     : ", test.ScoringMethod)
+	for _, test := range e.Tests {
+		if test.IsDependency {
+			testsPD.Rows = append(testsPD.Rows, []*Cell{
+				&Cell{Text: test.ID},
+				&Cell{Text: test.Name},
+				&Cell{Text: test.Description},
+				&Cell{Text: "(dependency)"},
+				&Cell{Text: ""},
+				&Cell{Text: ""},
+			})
+			continue
 		}
 
-		// Dependencies
-		if len(test.ExpandedDeps) > 0 {
-			sorted := make([]*test161.Test, 0)
-			for _, dep := range test.ExpandedDeps {
-				sorted = append(sorted, dep)
-			}
-			sort.Sort(testsByID(sorted))
-
-			fmt.Println("Dependencies:")
-			for _, dep := range sorted {
-				fmt.Println("    ", dep.DependencyID)
+		deps := make([]string, 0, len(test.Dependencies))
+		for _, dep := range test.Dependencies {
+			if dep.Kind != test161.DEP_HARD {
+				deps = append(deps, fmt.Sprintf("%v (%v)", dep.ID, dep.Kind))
+			} else {
+				deps = append(deps, dep.ID)
 			}
 		}
 
-		// Commands
-		fmt.Println("Commands:")
+		testsPD.Rows = append(testsPD.Rows, []*Cell{
+			&Cell{Text: test.ID},
+			&Cell{Text: test.Name},
+			&Cell{Text: test.Description},
+			&Cell{Text: fmt.Sprintf("%v", test.Points)},
+			&Cell{Text: test.Scoring},
+			&Cell{Text: strings.Join(deps, ", ")},
+		})
 
 		for _, cmd := range test.Commands {
-			// Instantiate the command so we get the expected output
-			fmt.Println("    Cmd Line    :", cmd.Input.Line)
-			fmt.Println("      Panics    :", cmd.Panic)
-			fmt.Println("      Times Out :", cmd.TimesOut)
-			fmt.Println("      Timeout   :", cmd.Timeout)
-			fmt.Println("      Points    :", cmd.PointsAvailable)
-			if len(cmd.ExpectedOutput) > 0 {
-				fmt.Println("      Output    :")
-				for _, output := range cmd.ExpectedOutput {
-					fmt.Println("            Text     :", output.Text)
-					fmt.Println("            Trusted  :", output.Trusted)
-					fmt.Println("            KeyID    :", output.KeyName)
-				}
+			expected := make([]string, 0, len(cmd.ExpectedOutput))
+			for _, output := range cmd.ExpectedOutput {
+				expected = append(expected, output.Text)
 			}
+			cmdsPD.Rows = append(cmdsPD.Rows, []*Cell{
+				&Cell{Text: test.ID},
+				&Cell{Text: cmd.Line},
+				&Cell{Text: cmd.Panics},
+				&Cell{Text: cmd.TimesOut},
+				&Cell{Text: fmt.Sprintf("%v", cmd.Timeout)},
+				&Cell{Text: fmt.Sprintf("%v", cmd.Points)},
+				&Cell{Text: strings.Join(expected, "; ")},
+			})
 		}
 	}
 
-	fmt.Println()
+	if err := printTables(testsPD, cmdsPD); err != nil {
+		return 1, []error{err}
+	}
 	return 0, nil
 }
 
@@ -577,6 +928,9 @@ func splitScores(tg *test161.TestGroup) []*scoreMapEntry {
 	}
 
 	// See if we can create an entry for the metatarget too.
+	if env == nil {
+		return scoresSlice
+	}
 	if target, ok := env.Targets[scoresSlice[0].TargetName]; ok {
 		if len(target.MetaName) > 0 {
 			if metaTarget, ok := env.Targets[target.MetaName]; ok {
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/jay1999ke/test161"
+)
+
+// 'test161 show' flags
+var showCommandVars struct {
+	verbose       string
+	explain       bool
+	explainFormat string
+	submission    bool
+	timing        bool
+	jsonFile      string
+	source        string
+}
+
+func getShowArgs() error {
+	flags := flag.NewFlagSet("test161 show", flag.ExitOnError)
+	flags.Usage = usage
+	flags.StringVar(&showCommandVars.verbose, "verbose", VERBOSE_LOUD, "")
+	flags.StringVar(&showCommandVars.verbose, "v", VERBOSE_LOUD, "")
+	flags.BoolVar(&showCommandVars.explain, "explain", false, "")
+	flags.BoolVar(&showCommandVars.explain, "x", false, "")
+	flags.StringVar(&showCommandVars.explainFormat, "explain-format", "", "")
+	flags.BoolVar(&showCommandVars.submission, "submission", false, "")
+	flags.BoolVar(&showCommandVars.submission, "s", false, "")
+	flags.StringVar(&showCommandVars.jsonFile, "json", "", "")
+	flags.BoolVar(&showCommandVars.timing, "timing", false, "")
+
+	flags.Parse(os.Args[2:]) // this may exit
+
+	args := flags.Args()
+	if len(args) != 1 {
+		return errors.New("test161 show needs a results file, or a submission ID with -submission")
+	}
+	showCommandVars.source = args[0]
+
+	// -explain-format implies -explain
+	if len(showCommandVars.explainFormat) > 0 {
+		if !isValidExplainFormat(showCommandVars.explainFormat) {
+			return errors.New("explain-format must be one of 'text', 'json', or 'yaml'")
+		}
+		showCommandVars.explain = true
+	}
+
+	switch showCommandVars.verbose {
+	case VERBOSE_LOUD:
+	case VERBOSE_QUIET:
+	case VERBOSE_WHISPER:
+	default:
+		return errors.New("verbose flag must be one of 'loud', 'quiet', or 'whisper'")
+	}
+
+	return nil
+}
+
+// Get the tests of a submission from the server. The users in the client
+// configuration need to be staff, or the submission's users.
+func fetchSubmissionTests(id string) (*test161.TestGroup, error) {
+	if len(clientConf.Users) == 0 {
+		return nil, errors.New("No users configured; use 'test161 config add-user' to add your username and token")
+	}
+
+	req := &test161.SubmissionTestsRequest{
+		Users:        clientConf.Users,
+		SubmissionID: id,
+	}
+
+	pr := NewPostRequest(ApiEndpointSubmissionTests)
+	pr.SetType(PostTypeJSON)
+	if err := pr.QueueJSON(req, ""); err != nil {
+		return nil, err
+	}
+
+	resp, body, errs := pr.Submit()
+	if len(errs) > 0 {
+		errs = connectionError(pr.Endpoint, errs)
+		return nil, errs[0]
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return test161.ResultsFromJSON([]byte(body))
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("The server doesn't have a submission %v, or is too old to send its tests", id)
+	default:
+		return nil, fmt.Errorf("The server could not process your request: %v. \nData: %v",
+			resp.Status, body)
+	}
+}
+
+// Print each test's output, as it would have been printed while running.
+func printTestOutput(tests []*test161.Test) {
+	width := 0
+	for _, test := range tests {
+		if width < len(test.DependencyID) {
+			width = len(test.DependencyID)
+		}
+	}
+
+	for _, test := range tests {
+		for _, cmd := range test.Commands {
+			for _, line := range cmd.Output {
+				fmt.Println(fmt.Sprintf(lineFmt, width, test.DependencyID, line.SimTime, line.Line))
+			}
+		}
+		for _, status := range test.Status {
+			str := fmt.Sprintf(lineFmt, width, test.DependencyID, status.SimTime, status.Status)
+			if status.Message != "" {
+				str += fmt.Sprintf(": %s", status.Message)
+			}
+			fmt.Println(str)
+		}
+	}
+}
+
+// test161 show [-verbose loud|quiet|whisper] [-explain] [-json <file>] <source>
+//
+// Show saved results, from a file written by 'test161 run -json' or the
+// submission on the server with -submission, the same way 'test161 run'
+// would.
+func doShow() int {
+	if err := getShowArgs(); err != nil {
+		printRunError(err)
+		return 1
+	}
+
+	var tg *test161.TestGroup
+	var err error
+	if showCommandVars.submission {
+		tg, err = fetchSubmissionTests(showCommandVars.source)
+	} else {
+		tg, err = test161.LoadResults(showCommandVars.source)
+	}
+	if err != nil {
+		printRunError(err)
+		return 1
+	}
+
+	tests := getPrintOrder(tg, false)
+	if showCommandVars.explain {
+		if _, errs := explainTests(tests, showCommandVars.explainFormat); len(errs) > 0 {
+			printRunErrors(errs)
+			return 1
+		}
+	} else {
+		if showCommandVars.verbose == VERBOSE_LOUD && printingText() {
+			printTestOutput(tests)
+		}
+		printRunSummary(tg, showCommandVars.verbose, false, showCommandVars.timing)
+	}
+
+	if len(showCommandVars.jsonFile) > 0 {
+		if err = writeResultsJSON(tg, showCommandVars.jsonFile); err != nil {
+			printRunError(err)
+			return 1
+		}
+	}
+
+	return 0
+}
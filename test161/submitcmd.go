@@ -58,7 +58,7 @@ func localSubmitTest(req *test161.SubmissionRequest) (scores []*scoreMapEntry, e
 		return
 	}
 
-	test161.SetManagerCapacity(0)
+	test161.SetManagerCapacity(test161.Resources{})
 	test161.StartManager()
 	defer test161.StopManager()
 
@@ -67,7 +67,7 @@ func localSubmitTest(req *test161.SubmissionRequest) (scores []*scoreMapEntry, e
 		return
 	}
 
-	printRunSummary(submission.Tests, VERBOSE_LOUD, true)
+	printRunSummary(submission.Tests, VERBOSE_LOUD, true, false)
 
 	scores = splitScores(submission.Tests)
 
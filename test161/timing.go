@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jay1999ke/test161"
+	color "gopkg.in/fatih/color.v0"
+)
+
+// The number of tests and commands -timing lists
+const TIMING_SLOWEST = 10
+
+func secondsString(t test161.TimeFixedPoint) string {
+	return fmt.Sprintf("%.2fs", float64(t))
+}
+
+func ratioString(ratio float64) string {
+	if ratio == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", ratio)
+}
+
+// The slowest tests and commands, as tables
+func timingTables(summary *test161.TimingSummary) []*PrintData {
+	tests := &PrintData{
+		Headings: []*Heading{
+			&Heading{
+				Text:     "Test",
+				MinWidth: 30,
+			},
+			&Heading{
+				Text:           "Wall",
+				RightJustified: true,
+			},
+			&Heading{
+				Text:           "Sim",
+				RightJustified: true,
+			},
+			&Heading{
+				Text:           "Wall/Sim",
+				RightJustified: true,
+			},
+			&Heading{
+				Text:           "Typing",
+				RightJustified: true,
+			},
+			&Heading{
+				Text:           "Executing",
+				RightJustified: true,
+			},
+			&Heading{
+				Text:           "Queued",
+				RightJustified: true,
+			},
+		},
+		Rows:   make(Rows, 0),
+		Config: defaultPrintConf,
+		Name:   "Slowest Tests",
+	}
+
+	for _, entry := range summary.SlowestTests {
+		tests.Rows = append(tests.Rows, []*Cell{
+			&Cell{Text: entry.Test},
+			&Cell{Text: secondsString(entry.WallTime)},
+			&Cell{Text: secondsString(entry.SimTime)},
+			&Cell{Text: ratioString(entry.Ratio)},
+			&Cell{Text: secondsString(entry.TypingTime)},
+			&Cell{Text: secondsString(entry.ExecTime)},
+			&Cell{Text: secondsString(entry.QueueWait)},
+		})
+	}
+
+	cmds := &PrintData{
+		Headings: []*Heading{
+			&Heading{
+				Text:     "Test",
+				MinWidth: 30,
+			},
+			&Heading{
+				Text: "Command",
+			},
+			&Heading{
+				Text:           "Wall",
+				RightJustified: true,
+			},
+			&Heading{
+				Text:           "Sim",
+				RightJustified: true,
+			},
+			&Heading{
+				Text:           "Wall/Sim",
+				RightJustified: true,
+			},
+			&Heading{
+				Text:           "Typing",
+				RightJustified: true,
+			},
+			&Heading{
+				Text:           "Executing",
+				RightJustified: true,
+			},
+		},
+		Rows:   make(Rows, 0),
+		Config: defaultPrintConf,
+		Name:   "Slowest Commands",
+	}
+
+	for _, entry := range summary.SlowestCommands {
+		cmds.Rows = append(cmds.Rows, []*Cell{
+			&Cell{Text: entry.Test},
+			&Cell{Text: entry.Line},
+			&Cell{Text: secondsString(entry.WallTime)},
+			&Cell{Text: secondsString(entry.SimTime)},
+			&Cell{Text: ratioString(entry.Ratio)},
+			&Cell{Text: secondsString(entry.TypingTime)},
+			&Cell{Text: secondsString(entry.ExecTime)},
+		})
+	}
+
+	return []*PrintData{tests, cmds}
+}
+
+// Print where the wall clock time of a run went, and the slowest tests and
+// commands. Tests with cached results are left out.
+func printTiming(summary *test161.TimingSummary) {
+	bold := color.New(color.Bold).SprintFunc()
+
+	fmt.Println(bold("Timing"))
+	if summary.Tests == 0 {
+		fmt.Println("No timing information; tests with cached results aren't timed.")
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("%-15v: %v\n", "Tests Timed", summary.Tests)
+	fmt.Printf("%-15v: %v\n", "Wall Time", secondsString(summary.WallTime))
+	fmt.Printf("%-15v: %v\n", "Sim Time", secondsString(summary.SimTime))
+	fmt.Printf("%-15v: %v\n", "Wall/Sim", ratioString(summary.Ratio))
+	fmt.Printf("%-15v: %v\n", "Typing", secondsString(summary.TypingTime))
+	fmt.Printf("%-15v: %v\n", "Executing", secondsString(summary.ExecTime))
+	fmt.Printf("%-15v: %v total, %v max\n", "Queue Wait",
+		secondsString(summary.QueueWait), secondsString(summary.MaxQueueWait))
+
+	for _, pd := range timingTables(summary) {
+		fmt.Println()
+		fmt.Println(bold(pd.Name))
+		pd.Print()
+	}
+	fmt.Println()
+}
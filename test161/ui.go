@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jay1999ke/test161"
+	color "gopkg.in/fatih/color.v0"
+)
+
+// A full-screen dashboard for 'test161 run -ui', with a row for each test
+// showing where it's at. Selecting a test shows its output. It's a
+// PersistenceManager so that it hears about everything the tests do, but it
+// only records what happened; the screen is redrawn on a timer.
+
+const UI_REFRESH = 200 * time.Millisecond
+
+// The most output lines kept for each test
+const UI_MAX_OUTPUT = 1000
+
+// Where a test is at, before it has a result
+const (
+	UI_WAITING = "waiting" // for its dependencies
+	UI_QUEUED  = "queued"
+	UI_RUNNING = "running"
+	UI_DONE    = "done"
+)
+
+// Terminal escapes
+const (
+	ESC_ALT_SCREEN   = "\x1b[?1049h\x1b[?25l" // and hide the cursor
+	ESC_MAIN_SCREEN  = "\x1b[?25h\x1b[?1049l"
+	ESC_HOME         = "\x1b[H"
+	ESC_CLEAR_LINE   = "\x1b[K"
+	ESC_CLEAR_SCREEN = "\x1b[J"
+	ESC_REVERSE      = "\x1b[7m"
+	ESC_RESET        = "\x1b[0m"
+)
+
+type uiTest struct {
+	id       string
+	state    string
+	command  int // The command that's running, starting at 1
+	commands int
+	cmdLine  string
+	simTime  test161.TimeFixedPoint
+	earned   uint
+	avail    uint
+	result   test161.TestResult
+	output   []string
+}
+
+type dashboard struct {
+	l     sync.Mutex
+	title string
+	tests []*uiTest
+	byID  map[string]*uiTest
+	began time.Time
+
+	// Manager stats, updated on each redraw
+	stats *test161.ManagerStats
+
+	// The screen
+	rows, cols int
+	selected   int
+	top        int  // The first test row on the screen
+	viewing    bool // Showing the selected test's output
+	scroll     int  // Output lines scrolled up from the bottom
+	finished   bool
+
+	stty string // The terminal settings to restore
+	keys chan string
+	done chan bool
+}
+
+// The dashboard only makes sense on a terminal; otherwise, we fall back to
+// printing the output.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func runStty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	res, err := cmd.Output()
+	return strings.TrimSpace(string(res)), err
+}
+
+// The number of rows and columns of the terminal
+func ttySize() (int, int) {
+	if res, err := runStty("size"); err == nil {
+		tokens := strings.Split(res, " ")
+		if len(tokens) == 2 {
+			rows, _ := strconv.Atoi(tokens[0])
+			cols, _ := strconv.Atoi(tokens[1])
+			return rows, cols
+		}
+	}
+	return 24, 80
+}
+
+func newDashboard(tg *test161.TestGroup, title string, useDeps bool) *dashboard {
+	d := &dashboard{
+		title: title,
+		tests: make([]*uiTest, 0, len(tg.Tests)),
+		byID:  make(map[string]*uiTest),
+		began: time.Now(),
+		stats: &test161.ManagerStats{},
+		rows:  24,
+		cols:  80,
+		keys:  make(chan string),
+		done:  make(chan bool),
+	}
+	for _, test := range getPrintOrder(tg, useDeps) {
+		t := &uiTest{
+			id:       test.DependencyID,
+			state:    UI_WAITING,
+			commands: len(test.Commands),
+			avail:    test.PointsAvailable,
+			output:   make([]string, 0),
+		}
+		d.tests = append(d.tests, t)
+		d.byID[t.id] = t
+	}
+	return d
+}
+
+////////  PersistenceManager
+
+func (d *dashboard) addOutput(t *uiTest, simTime test161.TimeFixedPoint, line string) {
+	t.output = append(t.output, fmt.Sprintf("%.6f  %v", simTime, line))
+	if len(t.output) > UI_MAX_OUTPUT {
+		t.output = t.output[len(t.output)-UI_MAX_OUTPUT:]
+	}
+}
+
+func (d *dashboard) Notify(entity interface{}, msg, what int) error {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	switch entity.(type) {
+	case *test161.Test:
+		test := entity.(*test161.Test)
+		t, ok := d.byID[test.DependencyID]
+		if !ok {
+			return nil
+		}
+		switch {
+		case msg == test161.MSG_PERSIST_QUEUED:
+			t.state = UI_QUEUED
+		case msg == test161.MSG_PERSIST_COMPLETE:
+			t.state = UI_DONE
+			t.result = test.Result
+			t.earned = test.PointsEarned
+			t.avail = test.PointsAvailable
+			t.simTime = test.SimTime
+		case msg == test161.MSG_PERSIST_UPDATE && what&test161.MSG_FIELD_STATUSES != 0:
+			if len(test.Status) > 0 {
+				status := test.Status[len(test.Status)-1]
+				line := "[" + status.Status + "]"
+				if len(status.Message) > 0 {
+					line += " " + status.Message
+				}
+				d.addOutput(t, status.SimTime, line)
+			}
+		case msg == test161.MSG_PERSIST_UPDATE && what&test161.MSG_FIELD_STATUS != 0:
+			if test.Result == test161.TEST_RESULT_RUNNING {
+				t.state = UI_RUNNING
+			}
+		}
+
+	case *test161.Command:
+		cmd := entity.(*test161.Command)
+		if msg != test161.MSG_PERSIST_UPDATE || cmd.Test == nil {
+			return nil
+		}
+		t, ok := d.byID[cmd.Test.DependencyID]
+		if !ok {
+			return nil
+		}
+		if what&test161.MSG_FIELD_OUTPUT != 0 && len(cmd.Output) > 0 {
+			line := cmd.Output[len(cmd.Output)-1]
+			t.simTime = line.SimTime
+			d.addOutput(t, line.SimTime, line.Line)
+		}
+		if what&test161.MSG_FIELD_STATUS != 0 && cmd.Status == test161.COMMAND_STATUS_RUNNING {
+			for i, c := range cmd.Test.Commands {
+				if c == cmd {
+					t.command = i + 1
+					break
+				}
+			}
+			t.cmdLine = cmd.Input.Line
+		}
+		if what&test161.MSG_FIELD_SCORE != 0 {
+			t.earned = cmd.Test.PointsEarned
+		}
+	}
+
+	return nil
+}
+
+func (d *dashboard) Close() {
+}
+
+func (d *dashboard) CanRetrieve() bool {
+	return false
+}
+
+func (d *dashboard) Retrieve(what int, who map[string]interface{},
+	filter map[string]interface{}, res interface{}) error {
+	return nil
+}
+
+////////  Drawing
+
+// Fit s into width columns
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	s = strings.Replace(s, "\t", "  ", -1)
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return s + strings.Repeat(" ", width-len(runes))
+}
+
+func (t *uiTest) stateString() (string, *color.Color) {
+	switch t.state {
+	case UI_RUNNING:
+		return fmt.Sprintf("running %v/%v", t.command, t.commands), nil
+	case UI_DONE:
+		switch t.result {
+		case test161.TEST_RESULT_CORRECT:
+			return string(t.result), COLOR_SUCCESS
+		case test161.TEST_RESULT_SKIP:
+			return string(t.result), COLOR_SKIPPED
+		default:
+			return string(t.result), COLOR_FAIL
+		}
+	}
+	return t.state, nil
+}
+
+// The lines of the screen
+func (d *dashboard) render() []string {
+	lines := make([]string, 0, d.rows)
+	body := d.rows - 3
+	if body < 1 {
+		body = 1
+	}
+
+	earned, avail, done := uint(0), uint(0), 0
+	for _, t := range d.tests {
+		earned += t.earned
+		avail += t.avail
+		if t.state == UI_DONE {
+			done += 1
+		}
+	}
+	header := fmt.Sprintf("test161: %v   %v   %v/%v done   running %v   queued %v",
+		d.title, time.Since(d.began).Truncate(time.Second), done, len(d.tests),
+		d.stats.Running, d.stats.Queued)
+	if avail > 0 {
+		header += fmt.Sprintf("   points %v/%v", earned, avail)
+	}
+	lines = append(lines, ESC_REVERSE+fit(header, d.cols)+ESC_RESET)
+
+	if d.viewing && d.selected < len(d.tests) {
+		t := d.tests[d.selected]
+		state, _ := t.stateString()
+		lines = append(lines, fit(fmt.Sprintf("%v: %v", t.id, state), d.cols))
+
+		end := len(t.output) - d.scroll
+		start := end - body
+		if start < 0 {
+			start = 0
+		}
+		for _, line := range t.output[start:end] {
+			lines = append(lines, fit(line, d.cols))
+		}
+		for len(lines) < d.rows-1 {
+			lines = append(lines, fit("", d.cols))
+		}
+		lines = append(lines, fit("up/down scroll   enter/esc back", d.cols))
+		return lines
+	}
+
+	// The table
+	width := len("Test")
+	for _, t := range d.tests {
+		if len(t.id) > width {
+			width = len(t.id)
+		}
+	}
+	lines = append(lines, fit(fmt.Sprintf("%-*v   %-13v   %12v   %7v   %v",
+		width, "Test", "State", "Sim Time", "Points", "Command"), d.cols))
+
+	// Keep the selection on the screen
+	if d.selected < d.top {
+		d.top = d.selected
+	} else if d.selected >= d.top+body {
+		d.top = d.selected - body + 1
+	}
+	for i := d.top; i < len(d.tests) && i < d.top+body; i++ {
+		t := d.tests[i]
+		state, paint := t.stateString()
+		cmdLine := ""
+		if t.state == UI_RUNNING {
+			cmdLine = t.cmdLine
+		}
+		points := ""
+		if t.avail > 0 {
+			points = fmt.Sprintf("%v/%v", t.earned, t.avail)
+		}
+		simTime := ""
+		if t.simTime > 0 {
+			simTime = fmt.Sprintf("%.2f s", t.simTime)
+		}
+
+		left := fmt.Sprintf("%-*v   ", width, t.id)
+		stateCol := fmt.Sprintf("%-13v", state)
+		right := fit(fmt.Sprintf("   %12v   %7v   %v", simTime, points, cmdLine), d.cols-len(left)-len(stateCol))
+		if len(left) >= d.cols {
+			lines = append(lines, fit(left, d.cols))
+			continue
+		}
+		if len(left)+len(stateCol) > d.cols {
+			stateCol = fit(stateCol, d.cols-len(left))
+		}
+
+		if i == d.selected {
+			lines = append(lines, ESC_REVERSE+left+stateCol+right+ESC_RESET)
+		} else {
+			if paint != nil {
+				stateCol = paint.SprintFunc()(stateCol)
+			}
+			lines = append(lines, left+stateCol+right)
+		}
+	}
+	for len(lines) < d.rows-1 {
+		lines = append(lines, fit("", d.cols))
+	}
+
+	footer := "up/down select   enter show output"
+	if d.finished {
+		footer += "   q quit"
+	} else {
+		footer += "   ctrl-c stop"
+	}
+	lines = append(lines, fit(footer, d.cols))
+	return lines
+}
+
+func (d *dashboard) draw(w *bufio.Writer) {
+	d.l.Lock()
+	d.stats = test161.GetManagerStats()
+	lines := d.render()
+	d.l.Unlock()
+
+	w.WriteString(ESC_HOME)
+	for i, line := range lines {
+		w.WriteString(line + ESC_CLEAR_LINE)
+		if i < len(lines)-1 {
+			w.WriteString("\r\n")
+		}
+	}
+	w.WriteString(ESC_CLEAR_SCREEN)
+	w.Flush()
+}
+
+////////  Input
+
+// Handle a key. Returns true if the dashboard should close.
+func (d *dashboard) handleKey(key string) bool {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	page := d.rows - 3
+	if page < 1 {
+		page = 1
+	}
+
+	if d.viewing {
+		t := d.tests[d.selected]
+		switch key {
+		case "up", "k":
+			if d.scroll < len(t.output)-page {
+				d.scroll += 1
+			}
+		case "down", "j":
+			if d.scroll > 0 {
+				d.scroll -= 1
+			}
+		case "pgup":
+			d.scroll += page
+			if d.scroll > len(t.output)-page {
+				d.scroll = len(t.output) - page
+			}
+			if d.scroll < 0 {
+				d.scroll = 0
+			}
+		case "pgdn":
+			d.scroll -= page
+			if d.scroll < 0 {
+				d.scroll = 0
+			}
+		case "enter", "esc", "q":
+			d.viewing = false
+		}
+		return false
+	}
+
+	switch key {
+	case "up", "k":
+		if d.selected > 0 {
+			d.selected -= 1
+		}
+	case "down", "j":
+		if d.selected < len(d.tests)-1 {
+			d.selected += 1
+		}
+	case "pgup":
+		d.selected -= page
+		if d.selected < 0 {
+			d.selected = 0
+		}
+	case "pgdn":
+		d.selected += page
+		if d.selected >= len(d.tests) {
+			d.selected = len(d.tests) - 1
+		}
+	case "enter":
+		if len(d.tests) > 0 {
+			d.viewing = true
+			d.scroll = 0
+		}
+	case "q":
+		return d.finished
+	}
+	return false
+}
+
+// Turn the bytes read from the terminal into keys
+func parseKeys(input string) []string {
+	keys := make([]string, 0)
+	escapes := []struct {
+		seq string
+		key string
+	}{
+		{"\x1b[A", "up"},
+		{"\x1b[B", "down"},
+		{"\x1bOA", "up"},
+		{"\x1bOB", "down"},
+		{"\x1b[5~", "pgup"},
+		{"\x1b[6~", "pgdn"},
+	}
+
+	for len(input) > 0 {
+		found := false
+		for _, esc := range escapes {
+			if strings.HasPrefix(input, esc.seq) {
+				keys = append(keys, esc.key)
+				input = input[len(esc.seq):]
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		switch input[0] {
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case '\x1b':
+			keys = append(keys, "esc")
+		default:
+			keys = append(keys, string(input[0]))
+		}
+		input = input[1:]
+	}
+	return keys
+}
+
+func (d *dashboard) readKeys() {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, key := range parseKeys(string(buf[:n])) {
+			d.keys <- key
+		}
+	}
+}
+
+////////  Running
+
+// Take over the terminal and start drawing.
+func (d *dashboard) start() error {
+	stty, err := runStty("-g")
+	if err != nil {
+		return err
+	}
+	if _, err = runStty("-icanon", "-echo", "min", "1"); err != nil {
+		return err
+	}
+	d.stty = stty
+	d.rows, d.cols = ttySize()
+
+	w := bufio.NewWriter(os.Stdout)
+	w.WriteString(ESC_ALT_SCREEN)
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	go d.readKeys()
+	go func() {
+		ticker := time.NewTicker(UI_REFRESH)
+		defer ticker.Stop()
+		for {
+			d.draw(w)
+			select {
+			case <-ticker.C:
+			case <-winch:
+				rows, cols := ttySize()
+				d.l.Lock()
+				d.rows, d.cols = rows, cols
+				d.l.Unlock()
+			case key := <-d.keys:
+				if d.handleKey(key) {
+					d.restore()
+					close(d.done)
+					return
+				}
+			case <-interrupt:
+				d.restore()
+				os.Exit(1)
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *dashboard) restore() {
+	signal.Reset(syscall.SIGWINCH, os.Interrupt)
+	fmt.Print(ESC_MAIN_SCREEN)
+	runStty(d.stty)
+}
+
+// The run is over. Wait for the user to close the dashboard.
+func (d *dashboard) finish() {
+	d.l.Lock()
+	d.finished = true
+	d.l.Unlock()
+	<-d.done
+}
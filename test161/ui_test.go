@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jay1999ke/test161"
+	"github.com/stretchr/testify/assert"
+)
+
+func uiTestGroup(t *testing.T) *test161.TestGroup {
+	tg := test161.EmptyGroup()
+	tg.Config = &test161.GroupConfig{Name: "test"}
+	for _, id := range []string{"boot.t", "sync/sem1.t"} {
+		test, err := test161.TestFromString("sem1\nq")
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.DependencyID = id
+		tg.Tests[id] = test
+	}
+	return tg
+}
+
+func TestDashboardNotify(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	tg := uiTestGroup(t)
+	d := newDashboard(tg, "test", false)
+	test := tg.Tests["sync/sem1.t"]
+	ui := d.byID["sync/sem1.t"]
+	assert.Equal(UI_WAITING, ui.state)
+
+	d.Notify(test, test161.MSG_PERSIST_QUEUED, 0)
+	assert.Equal(UI_QUEUED, ui.state)
+
+	test.Result = test161.TEST_RESULT_RUNNING
+	d.Notify(test, test161.MSG_PERSIST_UPDATE, test161.MSG_FIELD_STATUS)
+	assert.Equal(UI_RUNNING, ui.state)
+
+	cmd := test.Commands[1]
+	cmd.Status = test161.COMMAND_STATUS_RUNNING
+	d.Notify(cmd, test161.MSG_PERSIST_UPDATE, test161.MSG_FIELD_STATUS)
+	cmd.Output = []*test161.OutputLine{{SimTime: 1.5, Line: "sem1: SUCCESS"}}
+	d.Notify(cmd, test161.MSG_PERSIST_UPDATE, test161.MSG_FIELD_OUTPUT)
+	assert.Equal(2, ui.command)
+	assert.Equal("sem1", ui.cmdLine)
+	assert.Equal(test161.TimeFixedPoint(1.5), ui.simTime)
+	assert.Equal([]string{"1.500000  sem1: SUCCESS"}, ui.output)
+
+	d.rows, d.cols = 10, 80
+	lines := d.render()
+	assert.Equal(10, len(lines))
+	assert.Contains(lines[0], "test161: test")
+	assert.Contains(lines[0], "0/2 done")
+	assert.True(strings.HasPrefix(lines[1], "Test "))
+	assert.Contains(lines[3], "sync/sem1.t   running 2/3")
+	assert.Contains(lines[3], "1.50 s")
+	assert.Equal(80, len(lines[3]))
+	assert.True(strings.HasSuffix(strings.TrimRight(lines[3], " "), "   sem1"))
+	assert.Contains(lines[9], "ctrl-c stop")
+
+	test.Result = test161.TEST_RESULT_CORRECT
+	d.Notify(test, test161.MSG_PERSIST_COMPLETE, 0)
+	assert.Equal(UI_DONE, ui.state)
+	assert.Contains(d.render()[0], "1/2 done")
+}
+
+func TestDashboardKeys(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	assert.Equal([]string{"up", "down", "enter", "esc", "q", "pgdn"},
+		parseKeys("\x1b[A\x1bOB\r\x1bq\x1b[6~"))
+
+	tg := uiTestGroup(t)
+	d := newDashboard(tg, "test", false)
+	d.rows, d.cols = 10, 40
+	d.byID["sync/sem1.t"].output = []string{"line 1", "line 2"}
+
+	assert.False(d.handleKey("up"))
+	assert.Equal(0, d.selected)
+	assert.False(d.handleKey("down"))
+	assert.False(d.handleKey("down"))
+	assert.Equal(1, d.selected)
+
+	// Show the output
+	assert.False(d.handleKey("enter"))
+	assert.True(d.viewing)
+	lines := d.render()
+	assert.Equal(fit("sync/sem1.t: waiting", 40), lines[1])
+	assert.Equal(fit("line 1", 40), lines[2])
+	assert.Equal(fit("line 2", 40), lines[3])
+
+	// q goes back, and only quits once the run is over
+	assert.False(d.handleKey("q"))
+	assert.False(d.viewing)
+	assert.False(d.handleKey("q"))
+	d.finished = true
+	assert.True(d.handleKey("q"))
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jay1999ke/test161"
+)
+
+// 'test161 run -watch' rebuilds the OS/161 sources and reruns the selected
+// tests whenever the sources change. The source tree is polled rather than
+// watched with inotify, which is plenty fast for a tree this size and works
+// on every file system.
+
+// How often to check the source tree for changes
+const WATCH_POLL_INTERVAL = 500 * time.Millisecond
+
+// The number of output lines to show for a failed build command
+const WATCH_BUILD_OUTPUT_LINES = 20
+
+// A file's modification time and size, which is enough to notice edits
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+// The files in a source tree, by path relative to the tree
+type srcSnapshot map[string]fileStamp
+
+// Whether a path in the source tree should be ignored, either because it's
+// build output or because it doesn't affect the build.
+func watchIgnore(rel string, info os.FileInfo) bool {
+	name := info.Name()
+	if info.IsDir() {
+		return name == ".git" || name == "build" || rel == "kern/compile"
+	}
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") ||
+		strings.HasSuffix(name, ".o") || strings.HasSuffix(name, ".a") ||
+		name == "tags" || strings.HasPrefix(name, "cscope.")
+}
+
+func snapshotSources(dir string) (srcSnapshot, error) {
+	snap := make(srcSnapshot)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files come and go while editors save them
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if watchIgnore(rel, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			snap[rel] = fileStamp{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+	return snap, err
+}
+
+// The files that were added, removed or modified since prev, sorted.
+func (snap srcSnapshot) changes(prev srcSnapshot) []string {
+	changed := make([]string, 0)
+	for file, stamp := range snap {
+		if old, ok := prev[file]; !ok || old != stamp {
+			changed = append(changed, file)
+		}
+	}
+	for file := range prev {
+		if _, ok := snap[file]; !ok {
+			changed = append(changed, file)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Figure out what needs to be rebuilt for a set of changed files. Kernel and
+// userland changes only rebuild those, and anything else (shared code, make
+// files) rebuilds both. Userland is only rebuilt if the tests need it.
+func buildStepsFor(changed []string, userland bool) test161.LocalBuildSteps {
+	steps := test161.LocalBuildSteps{}
+	for _, file := range changed {
+		switch {
+		case strings.HasPrefix(file, "kern/conf/"):
+			steps.Kernel = true
+			steps.KernelConfigure = true
+		case strings.HasPrefix(file, "kern/"):
+			steps.Kernel = true
+		case strings.HasPrefix(file, "userland/"):
+			steps.Userland = true
+		default:
+			steps.Kernel = true
+			steps.Userland = true
+		}
+	}
+	steps.Userland = steps.Userland && userland
+	return steps
+}
+
+// Describe what changed, briefly
+func describeChanges(changed []string) string {
+	if len(changed) == 1 {
+		return changed[0]
+	}
+	return fmt.Sprintf("%v (and %v more)", changed[0], len(changed)-1)
+}
+
+func describeSteps(steps test161.LocalBuildSteps) string {
+	parts := make([]string, 0)
+	if steps.Userland {
+		parts = append(parts, "userland")
+	}
+	if steps.KernelConfigure {
+		parts = append(parts, "kernel (reconfigured)")
+	} else if steps.Kernel {
+		parts = append(parts, "kernel")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Figure out the kernel configuration from the kernel that's installed, which
+// bmake install links as kernel -> kernel-<CONFIG>.
+func installedKConfig(rootDir string) (string, error) {
+	link, err := os.Readlink(path.Join(rootDir, "kernel"))
+	if err != nil || !strings.HasPrefix(path.Base(link), "kernel-") {
+		return "", errors.New("Unable to determine your kernel configuration from your root directory. Try watching a target instead.")
+	}
+	return strings.TrimPrefix(path.Base(link), "kernel-"), nil
+}
+
+func watchPrintf(format string, args ...interface{}) {
+	fmt.Printf("[%v] %v\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+}
+
+// What 'test161 run -watch' is watching
+type watcher struct {
+	build    *test161.BuildConf
+	userland bool
+	useDeps  bool
+	newGroup func() (*test161.TestGroup, []error)
+
+	// The results from the previous iteration, if there was one
+	prev map[string]test161.TestResult
+}
+
+// Rebuild the sources, printing the output of the command that failed, if
+// one did.
+func (w *watcher) rebuild(steps test161.LocalBuildSteps) bool {
+	if steps == (test161.LocalBuildSteps{}) {
+		return true
+	}
+	watchPrintf("building %v", describeSteps(steps))
+
+	bt := w.build.ToLocalBuildTest(env, clientConf.SrcDir, clientConf.RootDir, steps)
+	if _, err := bt.Run(env); err != nil {
+		for _, cmd := range bt.Commands {
+			if cmd.Status != test161.COMMAND_STATUS_INCORRECT {
+				continue
+			}
+			watchPrintf("build failed: %v", cmd.Input.Line)
+			lines := cmd.Output
+			if len(lines) > WATCH_BUILD_OUTPUT_LINES {
+				lines = lines[len(lines)-WATCH_BUILD_OUTPUT_LINES:]
+			}
+			for _, line := range lines {
+				fmt.Println("    " + line.Line)
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Start running the tests. The results are sent on the returned channel
+// once they've all finished.
+func (w *watcher) start() (*test161.TestGroup, chan map[string]test161.TestResult) {
+	tg, errs := w.newGroup()
+	if len(errs) > 0 {
+		printRunErrors(errs)
+		return nil, nil
+	}
+
+	var r test161.TestRunner
+	if w.useDeps {
+		r = test161.NewDependencyRunner(tg)
+	} else {
+		r = test161.NewSimpleRunner(tg)
+	}
+
+	finished := make(chan map[string]test161.TestResult, 1)
+	go func() {
+		results := make(map[string]test161.TestResult)
+		for res := range r.Run() {
+			results[res.Test.DependencyID] = res.Test.Result
+		}
+		finished <- results
+	}()
+
+	return tg, finished
+}
+
+// Print the results, compared to the previous iteration.
+func (w *watcher) printResults(results map[string]test161.TestResult) {
+	ids := make([]string, 0, len(results))
+	for id := range results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	correct := 0
+	fixed, broken, failing := []string{}, []string{}, []string{}
+	for _, id := range ids {
+		passed := results[id] == test161.TEST_RESULT_CORRECT
+		prev, seen := w.prev[id]
+		if passed {
+			correct += 1
+			if seen && prev != test161.TEST_RESULT_CORRECT {
+				fixed = append(fixed, id)
+			}
+		} else if seen && prev == test161.TEST_RESULT_CORRECT {
+			broken = append(broken, id)
+		} else {
+			failing = append(failing, id)
+		}
+	}
+
+	summary := fmt.Sprintf("%v/%v correct", correct, len(ids))
+	if w.prev != nil {
+		summary += fmt.Sprintf(" (%v fixed, %v broken)", len(fixed), len(broken))
+	}
+	watchPrintf("%v", summary)
+
+	printIDs := func(label string, paint func(...interface{}) string, ids []string) {
+		for _, id := range ids {
+			fmt.Printf("    %v %v (%v)\n", paint(fmt.Sprintf("%-8v", label)), id, results[id])
+		}
+	}
+	printIDs("fixed", COLOR_SUCCESS.SprintFunc(), fixed)
+	printIDs("broken", COLOR_FAIL.SprintFunc(), broken)
+	printIDs("failing", COLOR_FAIL.SprintFunc(), failing)
+
+	w.prev = results
+}
+
+// Poll the source tree until it changes, and then until it settles so we
+// don't rebuild in the middle of a save or checkout.
+func waitForChanges(snap srcSnapshot, ticker *time.Ticker, finished chan map[string]test161.TestResult,
+	onFinish func(map[string]test161.TestResult)) (srcSnapshot, []string) {
+
+	var changed []string
+	cur := snap
+	for {
+		select {
+		case results := <-finished:
+			onFinish(results)
+			finished = nil
+		case <-ticker.C:
+			next, err := snapshotSources(clientConf.SrcDir)
+			if err != nil {
+				printRunError(err)
+				continue
+			}
+			if diff := next.changes(cur); len(diff) > 0 {
+				changed = append(changed, diff...)
+				cur = next
+			} else if len(changed) > 0 {
+				return cur, changed
+			}
+		}
+	}
+}
+
+// Rebuild and rerun tests until interrupted.
+func (w *watcher) run() int {
+	if clientConf.SrcDir == "" {
+		printRunError(errors.New("test161 run -watch needs to find your OS/161 source directory. Run it from inside your source tree."))
+		return 1
+	}
+
+	snap, err := snapshotSources(clientConf.SrcDir)
+	if err != nil {
+		printRunError(err)
+		return 1
+	}
+
+	if runCommandVars.sequential {
+		test161.SetManagerCapacity(test161.Resources{Tests: 1})
+	} else {
+		test161.SetManagerCapacity(test161.Resources{})
+	}
+	if wt, err := test161.LoadWallTimes(WALLTIMES_FILE); err != nil {
+		printRunError(err)
+	} else {
+		env.WallTimes = wt
+	}
+
+	test161.StartManager()
+	defer test161.StopManager()
+
+	watchPrintf("watching %v", clientConf.SrcDir)
+
+	ticker := time.NewTicker(WATCH_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	// Start with an incremental build in case the sources changed since the
+	// last one.
+	steps := test161.LocalBuildSteps{Kernel: true, Userland: w.userland}
+
+	for {
+		var tg *test161.TestGroup
+		var finished chan map[string]test161.TestResult
+		if w.rebuild(steps) {
+			watchPrintf("running tests")
+			tg, finished = w.start()
+		}
+
+		running := finished != nil
+		var changed []string
+		snap, changed = waitForChanges(snap, ticker, finished, func(results map[string]test161.TestResult) {
+			w.printResults(results)
+			running = false
+		})
+
+		watchPrintf("changed: %v", describeChanges(changed))
+		if running {
+			watchPrintf("cancelling tests")
+			tg.Cancel()
+			<-finished
+		}
+
+		steps = buildStepsFor(changed, w.userland)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/jay1999ke/test161"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	write := func(file, text string) {
+		assert.Nil(os.MkdirAll(path.Dir(path.Join(dir, file)), 0770))
+		assert.Nil(ioutil.WriteFile(path.Join(dir, file), []byte(text), 0664))
+	}
+
+	write("kern/thread/thread.c", "thread")
+	write("userland/bin/sh/sh.c", "sh")
+	write("kern/compile/ASST1/thread.o", "object")
+	write("build/userland/bin/sh/sh.o", "object")
+	write(".git/HEAD", "ref")
+	write("kern/thread/.thread.c.swp", "swap")
+
+	snap, err := snapshotSources(dir)
+	assert.Nil(err)
+	assert.Equal(2, len(snap))
+
+	write("kern/thread/thread.c", "new thread")
+	write("kern/compile/ASST1/thread.o", "new object")
+	write("kern/conf/ASST1", "conf")
+	assert.Nil(os.Remove(path.Join(dir, "userland/bin/sh/sh.c")))
+
+	next, err := snapshotSources(dir)
+	assert.Nil(err)
+	assert.Equal([]string{"kern/conf/ASST1", "kern/thread/thread.c", "userland/bin/sh/sh.c"},
+		next.changes(snap))
+	assert.Equal(0, len(next.changes(next)))
+}
+
+func TestWatchBuildSteps(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(test161.LocalBuildSteps{Kernel: true},
+		buildStepsFor([]string{"kern/thread/thread.c"}, true))
+	assert.Equal(test161.LocalBuildSteps{Kernel: true, KernelConfigure: true},
+		buildStepsFor([]string{"kern/conf/ASST1", "kern/main/main.c"}, true))
+	assert.Equal(test161.LocalBuildSteps{Userland: true},
+		buildStepsFor([]string{"userland/bin/sh/sh.c"}, true))
+	assert.Equal(test161.LocalBuildSteps{},
+		buildStepsFor([]string{"userland/bin/sh/sh.c"}, false))
+	assert.Equal(test161.LocalBuildSteps{Kernel: true, Userland: true},
+		buildStepsFor([]string{"common/libc/string/strlen.c"}, true))
+}
+
+func TestWatchKConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	_, err := installedKConfig(dir)
+	assert.NotNil(err)
+
+	assert.Nil(os.Symlink("kernel-ASST2", path.Join(dir, "kernel")))
+	kconfig, err := installedKConfig(dir)
+	assert.Nil(err)
+	assert.Equal("ASST2", kconfig)
+}
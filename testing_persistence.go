@@ -13,6 +13,10 @@ var testStudent = &Student{
 
 type TestingPersistence struct {
 	Verbose bool
+
+	// What submission and test lookups find
+	Submissions []*Submission
+	Tests       []*Test
 }
 
 func (p *TestingPersistence) Close() {
@@ -49,6 +53,25 @@ func (d *TestingPersistence) Retrieve(what int, who map[string]interface{},
 		}
 
 		return nil
+
+	case PERSIST_TYPE_SUBMISSIONS:
+		submissions := res.(*[]*Submission)
+		for _, s := range d.Submissions {
+			if id, _ := who["_id"]; id == s.ID {
+				*submissions = append(*submissions, s)
+			}
+		}
+		return nil
+
+	case PERSIST_TYPE_TESTS:
+		tests := res.(*[]*Test)
+		for _, t := range d.Tests {
+			if id, _ := who["submission_id"]; id == t.SubmissionID {
+				*tests = append(*tests, t)
+			}
+		}
+		return nil
+
 	default:
 		return errors.New("Persistence: Invalid data type")
 	}
@@ -0,0 +1,158 @@
+package test161
+
+import (
+	"sort"
+)
+
+// Timing breaks down where the wall clock time of a test went: how long each
+// command took, in wall clock and simulated time, how much of that was spent
+// typing the command into sys161 rather than running it, and how long the
+// test waited in the manager's queue before it started. Tests keep their
+// timing in their JSON output, and TimingSummary aggregates it for a group.
+type TestTiming struct {
+	WallTime  TimeFixedPoint `json:"walltime" bson:"walltime"`
+	SimTime   TimeFixedPoint `json:"simtime" bson:"simtime"`
+	Ratio     float64        `json:"wall_sim_ratio" bson:"wall_sim_ratio"`
+	QueueWait TimeFixedPoint `json:"queue_wait" bson:"queue_wait"`
+
+	// Wall clock time spent typing commands and running them
+	TypingTime TimeFixedPoint `json:"typing_walltime" bson:"typing_walltime"`
+	ExecTime   TimeFixedPoint `json:"exec_walltime" bson:"exec_walltime"`
+
+	Commands []*CommandTiming `json:"commands" bson:"commands"`
+}
+
+type CommandTiming struct {
+	Line       string         `json:"line" bson:"line"`
+	WallTime   TimeFixedPoint `json:"walltime" bson:"walltime"`
+	SimTime    TimeFixedPoint `json:"simtime" bson:"simtime"`
+	Ratio      float64        `json:"wall_sim_ratio" bson:"wall_sim_ratio"`
+	TypingTime TimeFixedPoint `json:"typing_walltime" bson:"typing_walltime"`
+	ExecTime   TimeFixedPoint `json:"exec_walltime" bson:"exec_walltime"`
+}
+
+// The ratio of wall clock time to simulated time. sys161 normally runs
+// faster than real time, so a high ratio means a slow or overloaded host.
+func timeRatio(wall, sim TimeFixedPoint) float64 {
+	if sim <= 0 {
+		return 0
+	}
+	return float64(wall) / float64(sim)
+}
+
+// Compute the test's timing once sys161 has stopped.
+func (t *Test) updateTiming() {
+	timing := &TestTiming{
+		WallTime:  t.WallTime,
+		SimTime:   t.SimTime,
+		QueueWait: t.queueWait,
+		Commands:  make([]*CommandTiming, 0, len(t.Commands)),
+	}
+	timing.Ratio = timeRatio(timing.WallTime, timing.SimTime)
+
+	for _, cmd := range t.Commands {
+		// Commands that never started
+		if cmd.wallEndTime == 0 {
+			continue
+		}
+		ct := &CommandTiming{
+			Line:       cmd.Input.Line,
+			WallTime:   cmd.wallEndTime - cmd.wallStartTime,
+			SimTime:    cmd.EndTime - cmd.StartTime,
+			TypingTime: cmd.typingTime,
+		}
+		ct.ExecTime = ct.WallTime - ct.TypingTime
+		ct.Ratio = timeRatio(ct.WallTime, ct.SimTime)
+
+		timing.TypingTime += ct.TypingTime
+		timing.ExecTime += ct.ExecTime
+		timing.Commands = append(timing.Commands, ct)
+	}
+
+	t.Timing = timing
+}
+
+// Timing of the tests in a group, and the slowest tests and commands.
+type TimingSummary struct {
+	Tests        int            `json:"tests"`
+	WallTime     TimeFixedPoint `json:"walltime"`
+	SimTime      TimeFixedPoint `json:"simtime"`
+	Ratio        float64        `json:"wall_sim_ratio"`
+	TypingTime   TimeFixedPoint `json:"typing_walltime"`
+	ExecTime     TimeFixedPoint `json:"exec_walltime"`
+	QueueWait    TimeFixedPoint `json:"queue_wait"`
+	MaxQueueWait TimeFixedPoint `json:"max_queue_wait"`
+
+	SlowestTests    []*TestTimingEntry    `json:"slowest_tests"`
+	SlowestCommands []*CommandTimingEntry `json:"slowest_commands"`
+}
+
+type TestTimingEntry struct {
+	Test string `json:"test"`
+	*TestTiming
+}
+
+type CommandTimingEntry struct {
+	Test string `json:"test"`
+	*CommandTiming
+}
+
+// TimingSummary adds up the timing of the tests that ran, leaving out tests
+// with cached results, and finds the n slowest tests and commands by wall
+// clock time.
+func (tg *TestGroup) TimingSummary(n int) *TimingSummary {
+	summary := &TimingSummary{
+		SlowestTests:    make([]*TestTimingEntry, 0),
+		SlowestCommands: make([]*CommandTimingEntry, 0),
+	}
+
+	for id, test := range tg.Tests {
+		if test.Timing == nil || test.Cached {
+			continue
+		}
+		timing := test.Timing
+		summary.Tests += 1
+		summary.WallTime += timing.WallTime
+		summary.SimTime += timing.SimTime
+		summary.TypingTime += timing.TypingTime
+		summary.ExecTime += timing.ExecTime
+		summary.QueueWait += timing.QueueWait
+		if timing.QueueWait > summary.MaxQueueWait {
+			summary.MaxQueueWait = timing.QueueWait
+		}
+
+		summary.SlowestTests = append(summary.SlowestTests, &TestTimingEntry{id, timing})
+		for _, cmd := range timing.Commands {
+			summary.SlowestCommands = append(summary.SlowestCommands, &CommandTimingEntry{id, cmd})
+		}
+	}
+	summary.Ratio = timeRatio(summary.WallTime, summary.SimTime)
+
+	// Slowest first, by ID for ties so the order is stable
+	sort.Slice(summary.SlowestTests, func(i, j int) bool {
+		a, b := summary.SlowestTests[i], summary.SlowestTests[j]
+		if a.WallTime != b.WallTime {
+			return a.WallTime > b.WallTime
+		}
+		return a.Test < b.Test
+	})
+	sort.Slice(summary.SlowestCommands, func(i, j int) bool {
+		a, b := summary.SlowestCommands[i], summary.SlowestCommands[j]
+		if a.WallTime != b.WallTime {
+			return a.WallTime > b.WallTime
+		}
+		if a.Test != b.Test {
+			return a.Test < b.Test
+		}
+		return a.Line < b.Line
+	})
+
+	if len(summary.SlowestTests) > n {
+		summary.SlowestTests = summary.SlowestTests[:n]
+	}
+	if len(summary.SlowestCommands) > n {
+		summary.SlowestCommands = summary.SlowestCommands[:n]
+	}
+
+	return summary
+}
@@ -0,0 +1,131 @@
+package test161
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func timingTest(id string, wall TimeFixedPoint) *Test {
+	test := &Test{
+		DependencyID: id,
+		WallTime:     wall,
+		SimTime:      wall / 2,
+		queueWait:    1.5,
+	}
+	boot := &Command{
+		Input:       InputLine{Line: "boot"},
+		EndTime:     wall / 4,
+		wallEndTime: wall / 2,
+	}
+	cmd := &Command{
+		Input:         InputLine{Line: "sem1"},
+		StartTime:     wall / 4,
+		EndTime:       wall / 2,
+		wallStartTime: wall / 2,
+		wallEndTime:   wall,
+		typingTime:    wall / 8,
+	}
+	never := &Command{
+		Input: InputLine{Line: "q"},
+	}
+	test.Commands = []*Command{boot, cmd, never}
+	return test
+}
+
+func TestTestTiming(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	test := timingTest("sync/sem1.t", 8.0)
+	test.updateTiming()
+
+	timing := test.Timing
+	if !assert.NotNil(timing) {
+		return
+	}
+	assert.Equal(TimeFixedPoint(8.0), timing.WallTime)
+	assert.Equal(TimeFixedPoint(4.0), timing.SimTime)
+	assert.Equal(2.0, timing.Ratio)
+	assert.Equal(TimeFixedPoint(1.5), timing.QueueWait)
+	assert.Equal(TimeFixedPoint(1.0), timing.TypingTime)
+	assert.Equal(TimeFixedPoint(7.0), timing.ExecTime)
+
+	// The last command never ran
+	if assert.Equal(2, len(timing.Commands)) {
+		boot, cmd := timing.Commands[0], timing.Commands[1]
+		assert.Equal("boot", boot.Line)
+		assert.Equal(TimeFixedPoint(4.0), boot.WallTime)
+		assert.Equal(TimeFixedPoint(2.0), boot.SimTime)
+		assert.Equal(TimeFixedPoint(0.0), boot.TypingTime)
+
+		assert.Equal("sem1", cmd.Line)
+		assert.Equal(TimeFixedPoint(4.0), cmd.WallTime)
+		assert.Equal(TimeFixedPoint(2.0), cmd.SimTime)
+		assert.Equal(2.0, cmd.Ratio)
+		assert.Equal(TimeFixedPoint(1.0), cmd.TypingTime)
+		assert.Equal(TimeFixedPoint(3.0), cmd.ExecTime)
+	}
+
+	// The timing is part of the JSON output
+	text, err := test.OutputJSON()
+	assert.Nil(err)
+	res := &Test{}
+	if assert.Nil(json.Unmarshal([]byte(text), res)) && assert.NotNil(res.Timing) {
+		assert.Equal(timing.ExecTime, res.Timing.ExecTime)
+		assert.Equal(2, len(res.Timing.Commands))
+	}
+
+	// Workers and cached results keep their timing, but not their queue wait
+	remote := timingTest("sync/sem1.t", 8.0)
+	remote.queueWait = 0.0
+	remote.updateTiming()
+	test.Timing = nil
+	assert.Nil(test.applyRemote(remote))
+	if assert.NotNil(test.Timing) {
+		assert.Equal(TimeFixedPoint(1.5), test.Timing.QueueWait)
+		assert.Equal(TimeFixedPoint(0.0), remote.Timing.QueueWait)
+	}
+}
+
+func TestTimingSummary(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	tg := EmptyGroup()
+	for _, test := range []*Test{
+		timingTest("a.t", 2.0),
+		timingTest("b.t", 8.0),
+		timingTest("c.t", 4.0),
+		timingTest("d.t", 16.0),
+		timingTest("e.t", 1.0),
+	} {
+		test.updateTiming()
+		tg.Tests[test.DependencyID] = test
+	}
+	tg.Tests["d.t"].Cached = true
+	tg.Tests["e.t"].Timing = nil
+
+	summary := tg.TimingSummary(2)
+	assert.Equal(3, summary.Tests)
+	assert.Equal(TimeFixedPoint(14.0), summary.WallTime)
+	assert.Equal(TimeFixedPoint(7.0), summary.SimTime)
+	assert.Equal(2.0, summary.Ratio)
+	assert.Equal(TimeFixedPoint(4.5), summary.QueueWait)
+	assert.Equal(TimeFixedPoint(1.5), summary.MaxQueueWait)
+	assert.Equal(summary.WallTime, summary.TypingTime+summary.ExecTime)
+
+	if assert.Equal(2, len(summary.SlowestTests)) {
+		assert.Equal("b.t", summary.SlowestTests[0].Test)
+		assert.Equal("c.t", summary.SlowestTests[1].Test)
+	}
+
+	// b.t's commands take the same time, so they're in order
+	if assert.Equal(2, len(summary.SlowestCommands)) {
+		assert.Equal("b.t", summary.SlowestCommands[0].Test)
+		assert.Equal("boot", summary.SlowestCommands[0].Line)
+		assert.Equal("b.t", summary.SlowestCommands[1].Test)
+		assert.Equal("sem1", summary.SlowestCommands[1].Line)
+	}
+}
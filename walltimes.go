@@ -0,0 +1,183 @@
+package test161
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/jay1999ke/test161/graph"
+)
+
+// WallTimes keeps track of how long each test has taken to run in the past,
+// indexed by test ID. The DependencyRunner uses these to start the tests on
+// the longest remaining path through the dependency graph first.
+type WallTimes struct {
+	Times map[string]float64 `json:"times"` // Protected by l
+
+	file string
+	l    sync.Mutex
+}
+
+// How much weight a new wall time gets in the moving average
+const WALLTIME_WEIGHT = 0.3
+
+// The expected wall time of a test we have no history for, if we also have
+// no history for any other test.
+const DEFAULT_WALLTIME = 1.0
+
+// Create a new, empty set of wall times that will be saved to file. If file
+// is empty, the wall times are only kept in memory.
+func NewWallTimes(file string) *WallTimes {
+	return &WallTimes{
+		Times: make(map[string]float64),
+		file:  file,
+	}
+}
+
+// Load wall times from file. It's not an error if the file doesn't exist yet.
+func LoadWallTimes(file string) (*WallTimes, error) {
+	wt := NewWallTimes(file)
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return wt, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, wt); err != nil {
+		return nil, err
+	}
+	if wt.Times == nil {
+		wt.Times = make(map[string]float64)
+	}
+	return wt, nil
+}
+
+// Save the wall times back to the file they were loaded from.
+func (wt *WallTimes) Save() error {
+	if wt == nil || wt.file == "" {
+		return nil
+	}
+
+	wt.l.Lock()
+	defer wt.l.Unlock()
+
+	data, err := json.MarshalIndent(wt, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(path.Dir(wt.file), 0770); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(wt.file, data, 0664)
+}
+
+// Save the environment's wall times, if it has any. Errors are logged since
+// they shouldn't affect the test results.
+func (env *TestEnvironment) saveWallTimes() {
+	if err := env.WallTimes.Save(); err != nil && env.Log != nil {
+		env.Log.Println("Error saving wall times:", err)
+	}
+}
+
+// Get the expected wall time of a test, if we have one.
+func (wt *WallTimes) Get(id string) (float64, bool) {
+	if wt == nil {
+		return 0, false
+	}
+
+	wt.l.Lock()
+	defer wt.l.Unlock()
+
+	t, ok := wt.Times[id]
+	return t, ok
+}
+
+// Record the wall time of a test that has finished running. Tests that were
+// skipped or aborted don't tell us anything, so they're ignored.
+func (wt *WallTimes) Record(test *Test) {
+	if wt == nil {
+		return
+	}
+	if test.Result != TEST_RESULT_CORRECT && test.Result != TEST_RESULT_INCORRECT {
+		return
+	}
+
+	wt.l.Lock()
+	defer wt.l.Unlock()
+
+	cur := float64(test.WallTime)
+	if prev, ok := wt.Times[test.DependencyID]; ok {
+		cur = WALLTIME_WEIGHT*cur + (1-WALLTIME_WEIGHT)*prev
+	}
+	wt.Times[test.DependencyID] = cur
+}
+
+// The expected wall time of each of the tests in the group. Tests we haven't
+// seen before are assumed to take the average time of the ones we have.
+func (wt *WallTimes) expected(tg *TestGroup) map[string]float64 {
+	res := make(map[string]float64, len(tg.Tests))
+	unknown := make([]string, 0)
+	total := 0.0
+
+	for id := range tg.Tests {
+		if t, ok := wt.Get(id); ok {
+			res[id] = t
+			total += t
+		} else {
+			unknown = append(unknown, id)
+		}
+	}
+
+	def := DEFAULT_WALLTIME
+	if known := len(res); known > 0 {
+		def = total / float64(known)
+	}
+	for _, id := range unknown {
+		res[id] = def
+	}
+
+	return res
+}
+
+// Compute the scheduling priority of each test in the group. A test's
+// priority is the expected wall time of the longest path from the test
+// through the tests that depend on it, including the test itself. Running
+// the tests with the highest priority first keeps the critical path moving.
+func (tg *TestGroup) criticalPathPriorities(wt *WallTimes) map[string]float64 {
+	expected := wt.expected(tg)
+	priorities := make(map[string]float64, len(tg.Tests))
+
+	// Without a valid graph, everything is equally important. Runners only
+	// see groups that passed GroupFromConfig, so this shouldn't happen.
+	g, err := tg.DependencyGraph()
+	if err != nil {
+		return priorities
+	} else if _, err = g.TopSort(); err != nil {
+		return priorities
+	}
+
+	var visit func(n *graph.Node) float64
+	visit = func(n *graph.Node) float64 {
+		if p, ok := priorities[n.Name]; ok {
+			return p
+		}
+		longest := 0.0
+		for _, dependent := range n.EdgesIn {
+			if p := visit(dependent); p > longest {
+				longest = p
+			}
+		}
+		priorities[n.Name] = expected[n.Name] + longest
+		return priorities[n.Name]
+	}
+
+	for _, n := range g.NodeMap {
+		visit(n)
+	}
+
+	return priorities
+}
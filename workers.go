@@ -0,0 +1,566 @@
+package test161
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/kevinburke/go.uuid"
+)
+
+// This file lets the test manager run jobs on remote workers (test161-worker)
+// as well as locally. The server registers workers, which then poll for jobs.
+// A job is sent with everything the worker needs to run the test except the
+// OS/161 root directory, which the worker downloads separately and caches by
+// its RootID. While the test runs, the worker sends updates with the state of
+// the test, which are copied back into the server's test and persisted.
+//
+// Workers that stop polling or sending updates for longer than the manager's
+// worker timeout are considered lost, and their jobs are re-queued.
+
+// How long a worker can go without contacting the server
+const DEFAULT_WORKER_TIMEOUT = 60 * time.Second
+
+// How often a worker sends updates while a test is running
+const WORKER_UPDATE_INTERVAL = 2 * time.Second
+
+// How long the server holds a worker's poll open waiting for jobs
+const WORKER_POLL_TIMEOUT = 20 * time.Second
+
+// The HTTP header workers use to authenticate with the server
+const WORKER_TOKEN_HEADER = "X-Test161-Worker-Token"
+
+var ErrUnknownWorker = errors.New("Unknown worker")
+var ErrUnknownWorkerJob = errors.New("Unknown worker job")
+
+// WorkerRegistration is sent by a worker when it starts, and the server
+// replies with the worker's ID.
+type WorkerRegistration struct {
+	ID       string    `json:"id,omitempty"`
+	Name     string    `json:"name"`
+	Capacity Resources `json:"capacity"`
+}
+
+// A remote worker registered with the manager. Protected by manager.l.
+type remoteWorker struct {
+	ID       string
+	Name     string
+	Capacity Resources
+
+	used     Resources
+	jobs     map[string]*test161Job // Assigned and unfinished, by remote ID
+	pending  []*test161Job          // Assigned, but not sent to the worker yet
+	wake     chan struct{}          // Wakes up the worker's poll
+	lastSeen time.Time
+}
+
+// WorkerStats describes a remote worker in ManagerStats.
+type WorkerStats struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Capacity Resources `json:"capacity"`
+	InUse    Resources `json:"in_use"`
+	Running  uint      `json:"running"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// WorkerJob is a test sent to a remote worker.
+type WorkerJob struct {
+	ID     string `json:"id"`
+	RootID string `json:"root_id"` // Jobs with the same RootID share a root directory
+
+	// The test, and what it needs to run that isn't part of its JSON
+	Test             *Test                       `json:"test"`
+	Content          string                      `json:"content"`
+	CommandOverrides []*CommandTemplate          `json:"command_overrides"`
+	Commands         map[string]*CommandTemplate `json:"commands"`
+	Keys             map[string]string           `json:"keys"`
+}
+
+// WorkerUpdate is sent by a remote worker with the current state of a test.
+// The last update for a job has Complete set, and Error if the test couldn't
+// be run.
+type WorkerUpdate struct {
+	Test     *Test  `json:"test"`
+	Complete bool   `json:"complete"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Whether there's room on the worker for a job that costs cost. Like the
+// local capacity, an idle worker takes any job.
+func (w *remoteWorker) hasCapacity(cost Resources) bool {
+	return w.used.Tests == 0 || w.Capacity.fits(w.used, cost)
+}
+
+// Find the least busy worker with room for a job. The caller must hold l.
+func (m *manager) findWorker(cost Resources) *remoteWorker {
+	var best *remoteWorker
+	for _, w := range m.workers {
+		if !w.hasCapacity(cost) {
+			continue
+		}
+		if best == nil || w.used.Tests < best.used.Tests ||
+			(w.used.Tests == best.used.Tests && w.ID < best.ID) {
+			best = w
+		}
+	}
+	return best
+}
+
+// Copy a test through its JSON representation, which is also what we send to
+// and receive from workers.
+func copyTest(t *Test) (*Test, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	res := &Test{}
+	if err = json.Unmarshal(data, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Copy the configuration and results of a test run by a worker.
+func (t *Test) applyRemote(r *Test) error {
+	if r == nil {
+		return errors.New("Missing test in worker update")
+	} else if len(r.Commands) != len(t.Commands) {
+		return fmt.Errorf("Worker update has %v commands, expected %v", len(r.Commands), len(t.Commands))
+	}
+
+	t.Sys161 = r.Sys161
+	t.Stat = r.Stat
+	t.Monitor = r.Monitor
+	t.Misc = r.Misc
+	t.ConfString = r.ConfString
+	t.WallTime = r.WallTime
+	t.SimTime = r.SimTime
+	t.Status = r.Status
+	t.Result = r.Result
+	t.PointsEarned = r.PointsEarned
+	t.MemLeakBytes = r.MemLeakBytes
+	t.MemLeakChecked = r.MemLeakChecked
+	t.MemLeakDeducted = r.MemLeakDeducted
+
+	// The time spent in our queue is ours to know
+	t.Timing = nil
+	if r.Timing != nil {
+		timing := *r.Timing
+		timing.QueueWait = t.queueWait
+		t.Timing = &timing
+	}
+
+	for i, c := range t.Commands {
+		rc := r.Commands[i]
+		c.Input = rc.Input
+		c.Panic = rc.Panic
+		c.Timeout = rc.Timeout
+		c.TimesOut = rc.TimesOut
+		c.ExpectedOutput = rc.ExpectedOutput
+		c.Output = rc.Output
+		c.SummaryStats = rc.SummaryStats
+		c.AllStats = rc.AllStats
+		c.StartTime = rc.StartTime
+		c.EndTime = rc.EndTime
+		c.TimedOut = rc.TimedOut
+		c.Status = rc.Status
+		c.PointsEarned = rc.PointsEarned
+	}
+
+	return nil
+}
+
+// Send a job to a worker. The caller must hold l.
+func (m *manager) assignJob(job *test161Job, w *remoteWorker) {
+	// Keep the original state around in case we need to re-queue the job.
+	// This can't fail for tests we loaded, but if it does, we just can't
+	// reset the test.
+	job.initial, _ = copyTest(job.Test)
+	job.worker = w
+	job.remoteID = uuid.NewV4().String()
+
+	w.used = w.used.add(job.Cost)
+	w.jobs[job.remoteID] = job
+	w.pending = append(w.pending, job)
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Forget a worker and re-queue its jobs. The caller must hold l.
+func (m *manager) removeWorker(w *remoteWorker) {
+	delete(m.workers, w.ID)
+
+	// Re-queue in the order the jobs were assigned
+	jobs := make([]*test161Job, 0, len(w.jobs))
+	for _, job := range w.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].queued.Before(jobs[j].queued)
+	})
+
+	for _, job := range jobs {
+		if job.initial != nil {
+			job.Test.applyRemote(job.initial)
+		}
+		job.worker = nil
+		job.remoteID = ""
+		job.initial = nil
+
+		m.stats.Running -= 1
+		m.stats.Requeued += 1
+		m.queue.finished(job)
+		m.enqueue(job)
+	}
+
+	m.dispatch()
+}
+
+// Periodically remove workers we haven't heard from.
+func (m *manager) reapWorkers(done chan struct{}) {
+	ticker := time.NewTicker(m.workerTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			m.l.Lock()
+			for _, w := range m.workers {
+				if now.Sub(w.lastSeen) > m.workerTimeout {
+					m.removeWorker(w)
+				}
+			}
+			m.l.Unlock()
+		}
+	}
+}
+
+// The stats for each worker, sorted by ID. The caller must hold l.
+func (m *manager) workerStats() []*WorkerStats {
+	res := make([]*WorkerStats, 0, len(m.workers))
+	for _, w := range m.workers {
+		res = append(res, &WorkerStats{
+			ID:       w.ID,
+			Name:     w.Name,
+			Capacity: w.Capacity,
+			InUse:    w.used,
+			Running:  w.used.Tests,
+			LastSeen: w.lastSeen,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+func (m *manager) registerWorker(name string, capacity Resources) string {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	w := &remoteWorker{
+		ID:       uuid.NewV4().String(),
+		Name:     name,
+		Capacity: capacity,
+		jobs:     make(map[string]*test161Job),
+		wake:     make(chan struct{}, 1),
+		lastSeen: time.Now(),
+	}
+	m.workers[w.ID] = w
+
+	// Start anything that's been waiting for room
+	m.dispatch()
+
+	return w.ID
+}
+
+func (m *manager) unregisterWorker(id string) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	w, ok := m.workers[id]
+	if !ok {
+		return ErrUnknownWorker
+	}
+	m.removeWorker(w)
+	return nil
+}
+
+// Wait up to timeout for jobs for a worker, and return them.
+func (m *manager) pollWorker(id string, timeout time.Duration) ([]*WorkerJob, error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	w, ok := m.workers[id]
+	if !ok {
+		return nil, ErrUnknownWorker
+	}
+	w.lastSeen = time.Now()
+
+	if len(w.pending) == 0 {
+		wake := w.wake
+		m.l.Unlock()
+		select {
+		case <-wake:
+		case <-time.After(timeout):
+		}
+		m.l.Lock()
+
+		// The worker could have timed out, which is unlikely but possible
+		if w, ok = m.workers[id]; !ok {
+			return nil, ErrUnknownWorker
+		}
+		w.lastSeen = time.Now()
+	}
+
+	jobs := make([]*WorkerJob, 0, len(w.pending))
+	for _, job := range w.pending {
+		keys := make(map[string]string, len(job.Env.keyMap))
+		for k, v := range job.Env.keyMap {
+			keys[k] = v
+		}
+		jobs = append(jobs, &WorkerJob{
+			ID:               job.remoteID,
+			RootID:           fmt.Sprintf("%x", sha1.Sum([]byte(job.Env.RootDir))),
+			Test:             job.Test,
+			Content:          job.Test.Content,
+			CommandOverrides: job.Test.CommandOverrides,
+			Commands:         job.Env.Commands,
+			Keys:             keys,
+		})
+	}
+	w.pending = nil
+
+	return jobs, nil
+}
+
+// Find a worker's job. The caller must hold l.
+func (m *manager) workerJob(id, jobID string) (*remoteWorker, *test161Job, error) {
+	w, ok := m.workers[id]
+	if !ok {
+		return nil, nil, ErrUnknownWorker
+	}
+	w.lastSeen = time.Now()
+
+	job, ok := w.jobs[jobID]
+	if !ok {
+		return nil, nil, ErrUnknownWorkerJob
+	}
+	return w, job, nil
+}
+
+// Apply an update from a worker, finishing the job if it's complete.
+func (m *manager) updateWorkerJob(id, jobID string, update *WorkerUpdate) error {
+	m.l.Lock()
+
+	w, job, err := m.workerJob(id, jobID)
+	if err != nil {
+		m.l.Unlock()
+		return err
+	}
+
+	var runErr error
+	if update.Error != "" {
+		runErr = errors.New(update.Error)
+	}
+
+	if err = job.Test.applyRemote(update.Test); err != nil {
+		if !update.Complete {
+			m.l.Unlock()
+			return err
+		}
+		// We need to finish the job regardless
+		job.Test.Result = TEST_RESULT_ABORT
+		runErr = err
+	}
+
+	if update.Complete {
+		delete(w.jobs, jobID)
+		w.used = w.used.sub(job.Cost)
+		job.worker = nil
+		job.initial = nil
+
+		m.stats.Running -= 1
+		m.stats.Finished += 1
+		m.queue.finished(job)
+		m.dispatch()
+	}
+
+	m.l.Unlock()
+
+	env := job.Env
+	if !update.Complete {
+		env.notifyAndLogErr("Worker Test Update", job.Test, MSG_PERSIST_UPDATE, MSG_FIELD_STATUS|MSG_FIELD_SCORE)
+		for _, cmd := range job.Test.Commands {
+			env.notifyAndLogErr("Worker Command Update", cmd, MSG_PERSIST_UPDATE,
+				MSG_FIELD_OUTPUT|MSG_FIELD_STATUS|MSG_FIELD_SCORE)
+		}
+		return nil
+	}
+
+	if runErr == nil {
+		env.WallTimes.Record(job.Test)
+	}
+
+	// Don't make the worker wait for the runner
+	go func() {
+		env.notifyAndLogErr("Test Complete", job.Test, MSG_PERSIST_COMPLETE, 0)
+		job.DoneChan <- &Test161JobResult{job.Test, runErr}
+	}()
+
+	return nil
+}
+
+// Get the root directory for a worker's job.
+func (m *manager) workerJobRoot(id, jobID string) (string, error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	_, job, err := m.workerJob(id, jobID)
+	if err != nil {
+		return "", err
+	}
+	return job.Env.RootDir, nil
+}
+
+// Exported shared test manager functions for test161-server
+
+// Register a remote worker with the shared test manager, returning its ID.
+func RegisterWorker(name string, capacity Resources) string {
+	return testManager.registerWorker(name, capacity)
+}
+
+// Remove a remote worker, re-queueing any jobs it was running.
+func UnregisterWorker(id string) error {
+	return testManager.unregisterWorker(id)
+}
+
+// Wait up to timeout for jobs for a remote worker. Each poll also tells the
+// manager that the worker is still alive.
+func PollWorker(id string, timeout time.Duration) ([]*WorkerJob, error) {
+	return testManager.pollWorker(id, timeout)
+}
+
+// Apply an update from a remote worker to one of its jobs.
+func UpdateWorkerJob(id, jobID string, update *WorkerUpdate) error {
+	return testManager.updateWorkerJob(id, jobID, update)
+}
+
+// Get the root directory a remote worker needs for a job.
+func WorkerJobRoot(id, jobID string) (string, error) {
+	return testManager.workerJobRoot(id, jobID)
+}
+
+////////  Worker side
+
+// A PersistenceManager that sends the state of a test to the server
+// periodically while it runs on a worker.
+type workerPersistence struct {
+	test   *Test
+	update func(data []byte, complete bool)
+	last   time.Time
+}
+
+func (p *workerPersistence) Close() {
+}
+
+func (p *workerPersistence) Notify(entity interface{}, msg, what int) error {
+	// The final update is sent by RunWorkerJob
+	if msg == MSG_PERSIST_COMPLETE || time.Now().Sub(p.last) < WORKER_UPDATE_INTERVAL {
+		return nil
+	}
+	p.last = time.Now()
+
+	data, err := json.Marshal(&WorkerUpdate{Test: p.test})
+	if err != nil {
+		return err
+	}
+	p.update(data, false)
+	return nil
+}
+
+func (p *workerPersistence) CanRetrieve() bool {
+	return false
+}
+
+func (p *workerPersistence) Retrieve(what int, who map[string]interface{},
+	filter map[string]interface{}, res interface{}) error {
+	return errors.New("workerPersistence does not support retrieval")
+}
+
+// Create the final update for a job that couldn't be run on a worker.
+func WorkerJobFailed(job *WorkerJob, err error) []byte {
+	job.Test.Result = TEST_RESULT_ABORT
+	data, _ := json.Marshal(&WorkerUpdate{
+		Test:     job.Test,
+		Complete: true,
+		Error:    err.Error(),
+	})
+	return data
+}
+
+// RunWorkerJob runs a job from the server on a worker, using the job's
+// root directory in rootDir. update is called with JSON encoded WorkerUpdates
+// while the test runs, and once more with the final update, for which
+// complete is set. update should not block.
+func RunWorkerJob(job *WorkerJob, rootDir string, logger *log.Logger, update func(data []byte, complete bool)) {
+	t := job.Test
+	if t == nil {
+		update(WorkerJobFailed(&WorkerJob{Test: &Test{}}, errors.New("Missing test in worker job")), true)
+		return
+	}
+
+	// Recreate the commands, which are mostly set up from the content, but
+	// keep their IDs and points so the server can match them up.
+	remote := t.Commands
+	t.Commands = nil
+	t.Content = job.Content
+	t.CommandOverrides = job.CommandOverrides
+	t.requiredBy = make(map[string]bool)
+
+	if err := t.initCommands(); err != nil {
+		t.Commands = remote
+		update(WorkerJobFailed(job, err), true)
+		return
+	} else if len(t.Commands) != len(remote) {
+		t.Commands = remote
+		update(WorkerJobFailed(job, errors.New("Command mismatch in worker job")), true)
+		return
+	}
+	for i, c := range t.Commands {
+		c.ID = remote[i].ID
+		c.PointsAvailable = remote[i].PointsAvailable
+	}
+
+	env := &TestEnvironment{
+		Commands:    job.Commands,
+		RootDir:     rootDir,
+		Log:         logger,
+		keyMap:      job.Keys,
+		Persistence: &workerPersistence{test: t, update: update},
+	}
+	if env.keyMap == nil {
+		env.keyMap = make(map[string]string)
+	}
+
+	var errMsg string
+	if err := t.Run(env); err != nil {
+		errMsg = err.Error()
+	}
+
+	data, err := json.Marshal(&WorkerUpdate{Test: t, Complete: true, Error: errMsg})
+	if err != nil {
+		data = WorkerJobFailed(job, err)
+	}
+	update(data, true)
+}
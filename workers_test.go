@@ -0,0 +1,154 @@
+package test161
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Poll each worker once, returning the ID of the worker that got a job.
+func pollForJob(m *manager, ids ...string) (string, *WorkerJob) {
+	for _, id := range ids {
+		if jobs, err := m.pollWorker(id, 10*time.Millisecond); err == nil && len(jobs) > 0 {
+			return id, jobs[0]
+		}
+	}
+	return "", nil
+}
+
+func TestRemoteWorkers(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	m := newManager()
+	m.Capacity = Resources{Tests: 1}
+	m.workerTimeout = 100 * time.Millisecond
+	m.start()
+	defer m.stop()
+
+	// Pretend something is running locally so the job goes to a worker
+	m.l.Lock()
+	m.stats.Running = 1
+	m.used = Resources{Tests: 1}
+	m.l.Unlock()
+
+	one := m.registerWorker("one", Resources{Tests: 1})
+	two := m.registerWorker("two", Resources{Tests: 1})
+
+	test, err := TestFromString("q")
+	assert.Nil(err)
+	if err != nil {
+		return
+	}
+	numCommands := len(test.Commands)
+
+	done := make(chan *Test161JobResult, 1)
+	m.submit(&test161Job{Test: test, Env: defaultEnv, DoneChan: done})
+
+	first, job := pollForJob(m, one, two)
+	assert.NotNil(job)
+	if job == nil {
+		return
+	}
+	assert.Equal("q", job.Content)
+	assert.Equal(numCommands, len(job.Test.Commands))
+	assert.NotEqual("", job.RootID)
+
+	other := two
+	if first == two {
+		other = one
+	}
+
+	// Keep the other worker alive and let the first one time out. Its job
+	// should be re-queued and sent to the other worker.
+	var requeued *WorkerJob
+	for start := time.Now(); requeued == nil && time.Since(start) < 5*time.Second; {
+		_, requeued = pollForJob(m, other)
+	}
+	assert.NotNil(requeued)
+	if requeued == nil {
+		return
+	}
+	assert.NotEqual(job.ID, requeued.ID)
+
+	stats := m.Stats()
+	assert.Equal(uint(1), stats.Requeued)
+	assert.Equal(1, len(stats.Workers))
+
+	// The lost worker can't send results anymore
+	assert.Equal(ErrUnknownWorker, m.updateWorkerJob(first, job.ID, &WorkerUpdate{Test: test}))
+	assert.Equal(ErrUnknownWorkerJob, m.updateWorkerJob(other, job.ID, &WorkerUpdate{Test: test}))
+
+	// Updates with the wrong commands are rejected
+	assert.NotNil(m.updateWorkerJob(other, requeued.ID, &WorkerUpdate{Test: &Test{}}))
+
+	// Finish the job
+	result, err := copyTest(test)
+	assert.Nil(err)
+	result.Result = TEST_RESULT_CORRECT
+	result.Commands[0].Status = COMMAND_STATUS_CORRECT
+	assert.Nil(m.updateWorkerJob(other, requeued.ID, &WorkerUpdate{Test: result, Complete: true}))
+
+	res := <-done
+	assert.Nil(res.Err)
+	assert.Equal(test, res.Test)
+	assert.Equal(TEST_RESULT_CORRECT, test.Result)
+	assert.Equal(COMMAND_STATUS_CORRECT, test.Commands[0].Status)
+
+	stats = m.Stats()
+	assert.Equal(uint(1), stats.Finished)
+	assert.Equal(uint(1), stats.Running)
+	if len(stats.Workers) == 1 {
+		assert.Equal(Resources{}, stats.Workers[0].InUse)
+	}
+}
+
+func TestRemoteWorkerFailure(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	m := newManager()
+	m.Capacity = Resources{Tests: 1}
+	m.start()
+	defer m.stop()
+
+	m.l.Lock()
+	m.stats.Running = 1
+	m.used = Resources{Tests: 1}
+	m.l.Unlock()
+
+	id := m.registerWorker("worker", Resources{})
+
+	test, err := TestFromString("q")
+	assert.Nil(err)
+	if err != nil {
+		return
+	}
+
+	done := make(chan *Test161JobResult, 1)
+	m.submit(&test161Job{Test: test, Env: defaultEnv, DoneChan: done})
+
+	_, job := pollForJob(m, id)
+	assert.NotNil(job)
+	if job == nil {
+		return
+	}
+
+	// A job that couldn't run is aborted with the worker's error
+	update := &WorkerUpdate{}
+	assert.Nil(json.Unmarshal(WorkerJobFailed(job, errors.New("no sys161")), update))
+	assert.True(update.Complete)
+	assert.Nil(m.updateWorkerJob(id, job.ID, update))
+
+	res := <-done
+	assert.NotNil(res.Err)
+	assert.Equal(TEST_RESULT_ABORT, res.Test.Result)
+
+	// Unregistering doesn't re-queue finished jobs
+	assert.Nil(m.unregisterWorker(id))
+	assert.Equal(ErrUnknownWorker, m.unregisterWorker(id))
+	assert.Equal(uint(0), m.Stats().Requeued)
+}